@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
+	contextApi "github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+)
+
+// Backend is the part of the fabric network used by the client: requests to
+// chaincodes, lookups in the ledger and subscriptions to committed blocks.
+// The client only talks to fabric through it, so tests can run the client
+// against a fake network.
+type Backend interface {
+	// Execute endorses request and waits until its transaction is committed
+	Execute(request channel.Request) (channel.Response, error)
+	// Query evaluates request without sending a transaction
+	Query(request channel.Request) (channel.Response, error)
+	QueryBlockByTxID(txID fab.TransactionID) (*common.Block, error)
+	QueryConfig() (fab.ChannelCfg, error)
+	// RegisterBlockEvent subscribes the blocks passing filter, the channel is
+	// closed once the registration is unregistered
+	RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error)
+	Unregister(reg fab.Registration)
+	Close()
+}
+
+// sdkBackend is the backend on top of the fabric sdk
+type sdkBackend struct {
+	sdk             *fabsdk.FabricSDK
+	channelProvider contextApi.ChannelProvider
+	channelClient   *channel.Client
+	eventLock       sync.Mutex
+	eventClient     *event.Client
+}
+
+var _ Backend = (*sdkBackend)(nil)
+
+func newSDKBackend(configPath string, meta *ContractMeta) (*sdkBackend, error) {
+	configProvider := config.FromFile(filepath.Join(configPath, "config.yaml"))
+	sdk, err := fabsdk.New(configProvider)
+	if err != nil {
+		return nil, fmt.Errorf("create sdk fail: %s\n", err)
+	}
+
+	channelProvider := sdk.ChannelContext(meta.ChannelID, fabsdk.WithUser(meta.Username), fabsdk.WithOrg(meta.ORG))
+
+	channelClient, err := channel.New(channelProvider)
+	if err != nil {
+		sdk.Close()
+		return nil, fmt.Errorf("create channel fabcli fail: %s\n", err.Error())
+	}
+
+	return &sdkBackend{
+		sdk:             sdk,
+		channelProvider: channelProvider,
+		channelClient:   channelClient,
+	}, nil
+}
+
+func (b *sdkBackend) Execute(request channel.Request) (channel.Response, error) {
+	return b.channelClient.Execute(request)
+}
+
+func (b *sdkBackend) Query(request channel.Request) (channel.Response, error) {
+	return b.channelClient.Query(request)
+}
+
+func (b *sdkBackend) QueryBlockByTxID(txID fab.TransactionID) (*common.Block, error) {
+	l, err := ledger.New(b.channelProvider)
+	if err != nil {
+		return nil, err
+	}
+	return l.QueryBlockByTxID(txID)
+}
+
+func (b *sdkBackend) QueryConfig() (fab.ChannelCfg, error) {
+	l, err := ledger.New(b.channelProvider)
+	if err != nil {
+		return nil, err
+	}
+	return l.QueryConfig()
+}
+
+func (b *sdkBackend) RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	ec, err := b.ensureEventClient()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ec.RegisterBlockEvent(filter...)
+}
+
+func (b *sdkBackend) Unregister(reg fab.Registration) {
+	b.eventLock.Lock()
+	defer b.eventLock.Unlock()
+
+	if b.eventClient != nil {
+		b.eventClient.Unregister(reg)
+	}
+}
+
+func (b *sdkBackend) Close() {
+	b.sdk.Close()
+}
+
+func (b *sdkBackend) ensureEventClient() (*event.Client, error) {
+	b.eventLock.Lock()
+	defer b.eventLock.Unlock()
+
+	if b.eventClient != nil {
+		return b.eventClient, nil
+	}
+
+	ec, err := event.New(b.channelProvider, event.WithBlockEvents())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fabcli, error: %v", err)
+	}
+	b.eventClient = ec
+	return ec, nil
+}
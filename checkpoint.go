@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+const (
+	CheckpointDir = "checkpoint"
+
+	interchainCheckpointPrefix = "interchain-"
+	receiptCheckpointPrefix    = "receipt-"
+	offChainCheckpointPrefix   = "offchain-"
+)
+
+// Checkpoint records the index of the last ibtp and off-chain data request
+// delivered to pier for each service pair, so that delivery resumes where it
+// stopped after a restart
+type Checkpoint struct {
+	store storage.Storage
+}
+
+func NewCheckpoint(path string) (*Checkpoint, error) {
+	store, err := leveldb.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoint store %s: %w", path, err)
+	}
+
+	return &Checkpoint{store: store}, nil
+}
+
+// Save records ibtp as the last delivered one of its service pair
+func (cp *Checkpoint) Save(ibtp *pb.IBTP) {
+	servicePair := genServicePair(ibtp.From, ibtp.To)
+	if ibtp.Type == pb.IBTP_INTERCHAIN {
+		cp.SetInterchain(servicePair, ibtp.Index)
+	} else {
+		cp.SetReceipt(servicePair, ibtp.Index)
+	}
+}
+
+func (cp *Checkpoint) SetInterchain(servicePair string, index uint64) {
+	cp.store.Put([]byte(interchainCheckpointPrefix+servicePair), uint64ToBytes(index))
+}
+
+func (cp *Checkpoint) SetReceipt(servicePair string, index uint64) {
+	cp.store.Put([]byte(receiptCheckpointPrefix+servicePair), uint64ToBytes(index))
+}
+
+func (cp *Checkpoint) SetOffChain(servicePair string, index uint64) {
+	cp.store.Put([]byte(offChainCheckpointPrefix+servicePair), uint64ToBytes(index))
+}
+
+// Interchains returns the last delivered interchain index of each service pair
+func (cp *Checkpoint) Interchains() map[string]uint64 {
+	return cp.load(interchainCheckpointPrefix)
+}
+
+// Receipts returns the last delivered receipt index of each service pair
+func (cp *Checkpoint) Receipts() map[string]uint64 {
+	return cp.load(receiptCheckpointPrefix)
+}
+
+// OffChains returns the last delivered off-chain data request index of each
+// service pair
+func (cp *Checkpoint) OffChains() map[string]uint64 {
+	return cp.load(offChainCheckpointPrefix)
+}
+
+func (cp *Checkpoint) Close() error {
+	return cp.store.Close()
+}
+
+func (cp *Checkpoint) load(prefix string) map[string]uint64 {
+	indexes := make(map[string]uint64)
+	it := cp.store.Prefix([]byte(prefix))
+	for it.Next() {
+		servicePair := strings.TrimPrefix(string(it.Key()), prefix)
+		indexes[servicePair] = binary.BigEndian.Uint64(it.Value())
+	}
+
+	return indexes
+}
+
+func uint64ToBytes(i uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return b
+}
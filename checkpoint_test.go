@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	cp, err := NewCheckpoint(dir)
+	require.Nil(t, err)
+
+	outPair := genServicePair(testLocalService, testRemote)
+	inPair := genServicePair(testRemote, testLocalService)
+	cp.Save(&pb.IBTP{From: testLocalService, To: testRemote, Index: 1, Type: pb.IBTP_INTERCHAIN})
+	cp.Save(&pb.IBTP{From: testLocalService, To: testRemote, Index: 2, Type: pb.IBTP_INTERCHAIN})
+	cp.Save(&pb.IBTP{From: testRemote, To: testLocalService, Index: 3, Type: pb.IBTP_RECEIPT_SUCCESS})
+	cp.SetOffChain(outPair, 4)
+
+	// each kind of index is kept under its own prefix
+	require.Equal(t, map[string]uint64{outPair: 2}, cp.Interchains())
+	require.Equal(t, map[string]uint64{inPair: 3}, cp.Receipts())
+	require.Equal(t, map[string]uint64{outPair: 4}, cp.OffChains())
+
+	// the indexes survive a restart
+	require.Nil(t, cp.Close())
+	cp, err = NewCheckpoint(dir)
+	require.Nil(t, err)
+	defer cp.Close()
+	require.Equal(t, map[string]uint64{outPair: 2}, cp.Interchains())
+	require.Equal(t, map[string]uint64{inPair: 3}, cp.Receipts())
+	require.Equal(t, map[string]uint64{outPair: 4}, cp.OffChains())
+
+	// delivery resumes from the checkpoint, pairs never delivered start from
+	// the index on chain
+	newPair := genServicePair(testLocalService, "1356:chain2:mychannel&transfer")
+	indexes, err := resumeIndexes(map[string]uint64{outPair: 5, newPair: 7}, cp.Interchains())
+	require.Nil(t, err)
+	require.Equal(t, map[string]uint64{outPair: 2, newPair: 7}, indexes)
+
+	_, err = resumeIndexes(map[string]uint64{outPair: 1}, cp.Interchains())
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "regressed")
+	_, err = resumeIndexes(map[string]uint64{}, cp.Receipts())
+	require.NotNil(t, err)
+}
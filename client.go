@@ -1,25 +1,24 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/Rican7/retry"
-	"github.com/Rican7/retry/strategy"
-	"github.com/golang/protobuf/proto"
 	"github.com/hashicorp/go-hclog"
 	"github.com/hyperledger/fabric-chaincode-go/shim"
-	"github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
-	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
 	"github.com/hyperledger/fabric/common/util"
 	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/pier-client-fabric/proof"
 	"github.com/meshplus/pier/pkg/plugins"
 )
 
@@ -38,18 +37,28 @@ const (
 	GetOutMetaMethod                     = "getOuterMeta"       // get last index of each receiving chain crosschain event
 	GetCallbackMetaMethod                = "getCallbackMeta"    // get last index of each receiving chain callback tx
 	GetDstRollbackMeta                   = "getDstRollbackMeta" // get last index of each receiving chain dst roll back tx
+	GetSrcRollbackMeta                   = "getSrcRollbackMeta" // get last index of each receiving chain src roll back tx
 	GetLocalServices                     = "getLocalServices"
 	GetChainId                           = "getChainId"
 	GetInMessageMethod                   = "getInMessage"
 	GetOutMessageMethod                  = "getOutMessage"
+	GetInMessagesMethod                  = "getInMessages"
+	GetOutMessagesMethod                 = "getOutMessages"
 	PollingEventMethod                   = "pollingEvent"
 	InvokeInterchainMethod               = "invokeInterchain"
 	InvokeInterchainsMethod              = "invokeInterchains"
 	InvokeReceiptMethod                  = "invokeReceipt"
+	InvokeReceiptsMethod                 = "invokeReceipts"
 	InvokeIndexUpdateMethod              = "invokeIndexUpdate"
 	InvokeGetDirectTransactionMetaMethod = "getDirectTransactionMeta"
 	InvokerGetAppchainInfoMethod         = "getAppchainInfo"
+	GetOffChainDataMetaMethod            = "getOffChainDataMeta"
+	GetOffChainDataRequestMethod         = "getOffChainDataRequest"
+	SubmitOffChainDataMethod             = "submitOffChainData"
 	FabricType                           = "fabric"
+
+	// stopTimeout bounds how long Stop waits for the goroutines of the client
+	stopTimeout = 10 * time.Second
 )
 
 type ContractMeta struct {
@@ -67,23 +76,35 @@ type DirectTransactionMeta struct {
 
 type Client struct {
 	meta          *ContractMeta
+	backend       Backend
 	consumer      *Consumer
 	eventC        chan *pb.IBTP
-	appchainID    string
-	bitxhubID     string
+	ccEventC      chan *pb.IBTP
+	chainIDs      *chainIDs
 	name          string
-	serviceMeta   map[string]*pb.Interchain
+	serviceMeta   *ServiceMeta
 	ticker        *time.Ticker
-	done          chan bool
+	ctx           context.Context
+	cancel        context.CancelFunc
+	wg            sync.WaitGroup
 	timeoutHeight int64
 	config        *Config
+	dataReqC      chan *pb.GetDataRequest
+	dataStore     DataStore
+	receiveStore  DataStore
+	offChainMeta  map[string]uint64
+	updateC       chan *pb.UpdateMeta
+	checkpoint    *Checkpoint
+	validatorSrv  *ValidatorServer
 }
 
 type Validator struct {
-	Cid      string   `json:"cid"`
-	ChainId  string   `json:"chain_id"`
-	Policy   string   `json:"policy"`
-	ConfByte []string `json:"conf_byte"`
+	Cid     string `json:"cid"`
+	ChainId string `json:"chain_id"`
+	Policy  string `json:"policy"`
+	// OrdererPolicy is the policy the orderers signing blocks must satisfy
+	OrdererPolicy string   `json:"orderer_policy"`
+	ConfByte      []string `json:"conf_byte"`
 }
 
 type CallFunc struct {
@@ -104,6 +125,20 @@ type Receipt struct {
 	Encrypt bool          `json:"encrypt"`
 	Typ     uint64        `json:"typ"`
 	Result  peer.Response `json:"result"`
+	TxID    string        `json:"tx_id"`
+	// Migrated marks the legacy receipts the broker knows no transaction of
+	Migrated bool `json:"migrated"`
+}
+
+// results returns the execution status followed by the results of the receipt
+func (r *Receipt) results() [][]byte {
+	results := []string{"true"}
+	if r.Result.Status == shim.ERROR {
+		results = []string{"false"}
+	}
+	results = append(results, strings.Split(string(r.Result.Payload), ",")...)
+
+	return util.ToChaincodeArgs(results...)
 }
 
 func (c *Client) Initialize(configPath string, extra []byte, mode string) error {
@@ -113,6 +148,13 @@ func (c *Client) Initialize(configPath string, extra []byte, mode string) error
 		return fmt.Errorf("unmarshal config for plugin :%w", err)
 	}
 	fabricConfig := config.Fabric
+	var validatorSrv *ValidatorServer
+	if fabricConfig.ServerPort != "" {
+		validatorSrv, err = NewValidatorServer(fabricConfig.ServerPort)
+		if err != nil {
+			return err
+		}
+	}
 	contractmeta := &ContractMeta{
 		Username:  fabricConfig.Username,
 		CCID:      fabricConfig.CCID,
@@ -120,36 +162,71 @@ func (c *Client) Initialize(configPath string, extra []byte, mode string) error
 		ORG:       fabricConfig.Org,
 	}
 
-	m := make(map[string]*pb.Interchain)
-	// if err := json.Unmarshal(extra, &m); err != nil {
-	// 	return fmt.Errorf("unmarshal extra for plugin :%w", err)
-	// }
-	// if m == nil {
-	// 	m = make(map[string]*pb.Interchain)
-	// }
+	dataPath := config.OffChain.DataPath
+	if !filepath.IsAbs(dataPath) {
+		dataPath = filepath.Join(configPath, dataPath)
+	}
+	dataStore, err := NewFileStore(dataPath, config.OffChain.MaxSize)
+	if err != nil {
+		return err
+	}
+	receivePath := config.OffChain.ReceivePath
+	if !filepath.IsAbs(receivePath) {
+		receivePath = filepath.Join(configPath, receivePath)
+	}
+	receiveStore, err := NewFileStore(receivePath, config.OffChain.MaxSize)
+	if err != nil {
+		return err
+	}
 
-	mgh, err := newFabricHandler(contractmeta.EventFilter, eventC)
+	checkpointPath := filepath.Join(configPath, CheckpointDir)
+	if fabricConfig.Backend == BackendFake {
+		// the fake fabric starts empty every time, so does its checkpoint
+		if err := os.RemoveAll(checkpointPath); err != nil {
+			return err
+		}
+	}
+	checkpoint, err := NewCheckpoint(checkpointPath)
 	if err != nil {
 		return err
 	}
 
-	done := make(chan bool)
-	csm, err := NewConsumer(configPath, contractmeta, mgh, done)
+	// ctx is cancelled by Stop, it reaches every goroutine of the client
+	ctx, cancel := context.WithCancel(context.Background())
+	ccEventC := make(chan *pb.IBTP, 1024)
+	mgh, err := newFabricHandler(ctx, fabricConfig.TimeoutHeight, ccEventC)
 	if err != nil {
+		cancel()
+		checkpoint.Close()
+		return err
+	}
+	backend, err := newBackend(configPath, config, contractmeta)
+	if err != nil {
+		cancel()
+		checkpoint.Close()
 		return err
 	}
 
-	c.consumer = csm
+	c.backend = backend
+	c.consumer = NewConsumer(backend, contractmeta, mgh)
 	c.eventC = eventC
+	c.ccEventC = ccEventC
 	c.meta = contractmeta
 	c.name = fabricConfig.Name
-	c.serviceMeta = m
-	c.ticker = time.NewTicker(2 * time.Second)
-	c.done = done
+	c.serviceMeta = NewServiceMeta()
+	c.ticker = time.NewTicker(fabricConfig.PollingInterval)
+	c.ctx = ctx
+	c.cancel = cancel
 	c.timeoutHeight = fabricConfig.TimeoutHeight
 	c.config = config
-	c.appchainID = ""
-	c.bitxhubID = ""
+	c.chainIDs = &chainIDs{resolve: c.GetChainID}
+	c.dataReqC = make(chan *pb.GetDataRequest)
+	c.dataStore = dataStore
+	c.receiveStore = receiveStore
+	c.offChainMeta = make(map[string]uint64)
+	c.updateC = make(chan *pb.UpdateMeta, 1)
+	c.checkpoint = checkpoint
+	c.validatorSrv = validatorSrv
 	return nil
 }
 
@@ -160,7 +237,52 @@ func (c *Client) Start() error {
 		logger.Error("client do service meta init error: %s", err.Error())
 		return err
 	}
-	go c.polling()
+	if err := c.startValidatorWatcher(); err != nil {
+		return err
+	}
+	if c.config.Fabric.EventDriven {
+		if err := c.consumer.Start(c.ctx); err != nil {
+			return err
+		}
+	}
+	if c.validatorSrv != nil {
+		if err := c.validatorSrv.Start(); err != nil {
+			return err
+		}
+		logger.Info("Validator server started", "port", c.config.Fabric.ServerPort)
+	}
+	c.run(c.polling)
+	c.run(c.pollingOffChain)
+	return nil
+}
+
+// run starts f in a goroutine which Stop waits for, f must return once the
+// context of the client is done
+func (c *Client) run(f func()) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		f()
+	}()
+}
+
+func (c *Client) startValidatorWatcher() error {
+	validator, err := queryValidator(c.backend, c.meta.ChannelID, c.meta.CCID, c.config.Fabric.Policy, c.config.Fabric.OrdererPolicy)
+	if err != nil {
+		return fmt.Errorf("query validator: %w", err)
+	}
+	last, err := json.Marshal(validator)
+	if err != nil {
+		return err
+	}
+
+	notifier, err := c.consumer.RegisterConfigBlock()
+	if err != nil {
+		return err
+	}
+	c.run(func() {
+		c.watchValidator(notifier, last)
+	})
 	return nil
 }
 
@@ -175,209 +297,252 @@ func (c *Client) initServiceMeta() error {
 		logger.Error("client get inMeta error: %s", err.Error())
 		return err
 	}
-	for servicePair, index := range outMeta {
+	interchains, err := resumeIndexes(outMeta, c.checkpoint.Interchains())
+	if err != nil {
+		return fmt.Errorf("resume interchain delivery: %w", err)
+	}
+	receipts, err := resumeIndexes(inMeta, c.checkpoint.Receipts())
+	if err != nil {
+		return fmt.Errorf("resume receipt delivery: %w", err)
+	}
+	for servicePair, index := range interchains {
 		// 这里的src是我自己
-		meta, _, dstChainServiceID, err := c.ensureGetServiceMeta(servicePair)
-		if err != nil {
+		if err := c.serviceMeta.SetIndex(pb.IBTP_INTERCHAIN, servicePair, index); err != nil {
 			return err
 		}
-		meta.InterchainCounter[dstChainServiceID] = index
+		c.checkpoint.SetInterchain(servicePair, index)
 	}
-	for servicePair, index := range inMeta {
+	for servicePair, index := range receipts {
 		// 这里的src是对端链，dst是我自己
-		meta, _, dstChainServiceID, err := c.ensureGetServiceMeta(servicePair)
-		if err != nil {
+		if err := c.serviceMeta.SetIndex(pb.IBTP_RECEIPT_SUCCESS, servicePair, index); err != nil {
 			return err
 		}
-		meta.ReceiptCounter[dstChainServiceID] = index
+		c.checkpoint.SetReceipt(servicePair, index)
+	}
+	offChainMeta, err := c.GetOffChainDataMeta()
+	if err != nil {
+		logger.Error("client get off-chain data meta error", "error", err.Error())
+		return err
+	}
+	offChains, err := resumeIndexes(offChainMeta, c.checkpoint.OffChains())
+	if err != nil {
+		return fmt.Errorf("resume off-chain data request delivery: %w", err)
+	}
+	for servicePair, index := range offChains {
+		c.offChainMeta[servicePair] = index
+		c.checkpoint.SetOffChain(servicePair, index)
 	}
 	return nil
 }
 
-func (c *Client) ensureGetServiceMeta(servicePair string) (*pb.Interchain, string, string, error) {
-	srcChainServiceID, dstChainServiceID, err := parseServicePair(servicePair)
-	if err != nil {
-		logger.Error("Polling out invalid service pair",
-			"servicePair", servicePair,
-			"error", err.Error())
-		return nil, srcChainServiceID, dstChainServiceID, err
-	}
-	meta, ok := c.serviceMeta[srcChainServiceID]
-	if !ok {
-		meta = &pb.Interchain{
-			ID:                      srcChainServiceID,
-			InterchainCounter:       make(map[string]uint64),
-			ReceiptCounter:          make(map[string]uint64),
-			SourceInterchainCounter: make(map[string]uint64),
-			SourceReceiptCounter:    make(map[string]uint64),
+// resumeIndexes decides where delivery resumes for each service pair. The
+// checkpoint wins if there is one, pairs never delivered start from the index
+// on chain and leave the missing ones to the recovery of pier. A chaincode
+// index behind the checkpoint means the chaincode state regressed.
+func resumeIndexes(chainMeta, checkpoint map[string]uint64) (map[string]uint64, error) {
+	for servicePair, delivered := range checkpoint {
+		if chainMeta[servicePair] < delivered {
+			return nil, fmt.Errorf("service pair %s regressed: index %d on chain is behind delivered index %d",
+				servicePair, chainMeta[servicePair], delivered)
+		}
+	}
+
+	indexes := make(map[string]uint64, len(chainMeta))
+	for servicePair, index := range chainMeta {
+		if delivered, ok := checkpoint[servicePair]; ok {
+			index = delivered
 		}
-		c.serviceMeta[srcChainServiceID] = meta
+		indexes[servicePair] = index
 	}
-	return c.serviceMeta[srcChainServiceID], srcChainServiceID, dstChainServiceID, nil
+	return indexes, nil
 }
 
-// polling event from broker
+// polling event from broker, it is only a fallback to fill the gaps when ibtps
+// are delivered by chaincode events. The messages left behind since the last
+// checkpoint are caught up at once instead of waiting for the first tick.
 func (c *Client) polling() {
-	// firstEnter is used to mark this round logic is recover or need init
-	// if pier first start, all meta should be assigned as ledger value, and pier.recover() will handle missing events
-	// and during that phase, all already-in-ledger meta will be assigned to
+	c.catchUpAll()
 	for {
 		select {
+		case ibtp := <-c.ccEventC:
+			c.handleEvent(ibtp)
 		case <-c.ticker.C:
-			outMeta, err := c.GetOutMeta()
-			if err != nil {
-				continue
-			}
-			inMeta, err := c.GetInMeta()
-			if err != nil {
-				continue
-			}
-			for servicePair, index := range outMeta {
-				srcChainServiceID, dstChainServiceID, err := parseServicePair(servicePair)
-				if err != nil {
-					logger.Error("Polling out invalid service pair",
-						"servicePair", servicePair,
-						"index", index,
-						"error", err.Error())
-					continue
-				}
-				meta, ok := c.serviceMeta[srcChainServiceID]
-				if !ok {
-					meta = &pb.Interchain{
-						ID:                      srcChainServiceID,
-						InterchainCounter:       make(map[string]uint64),
-						ReceiptCounter:          make(map[string]uint64),
-						SourceInterchainCounter: make(map[string]uint64),
-						SourceReceiptCounter:    make(map[string]uint64),
-					}
-					c.serviceMeta[srcChainServiceID] = meta
-					// ibtp, err := c.GetOutMessage(servicePair, index)
-					// if err != nil {
-					// 	logger.Error("Polling out message",
-					// 		"servicePair", servicePair,
-					// 		"index", index,
-					// 		"error", err.Error())
-					// 	continue
-					// }
-
-					// c.eventC <- ibtp
-					//meta.InterchainCounter[dstChainServiceID] = index
-					//continue
-				}
-
-				for i := meta.InterchainCounter[dstChainServiceID] + 1; i <= index; i++ {
-					ibtp, err := c.GetOutMessage(servicePair, i)
-					if err != nil {
-						logger.Error("Polling out message",
-							"servicePair", servicePair,
-							"index", i,
-							"error", err.Error())
-						continue
-					}
-
-					c.eventC <- ibtp
-					meta.InterchainCounter[dstChainServiceID]++
-				}
-			}
-			for servicePair, index := range inMeta {
-				srcChainServiceID, dstChainServiceID, err := parseServicePair(servicePair)
-				if err != nil {
-					logger.Error("Polling out invalid service pair",
-						"servicePair", servicePair,
-						"index", index,
-						"error", err.Error())
-					continue
-				}
-				meta, ok := c.serviceMeta[srcChainServiceID]
-				if !ok {
-					meta = &pb.Interchain{
-						ID:                      srcChainServiceID,
-						InterchainCounter:       make(map[string]uint64),
-						ReceiptCounter:          make(map[string]uint64),
-						SourceInterchainCounter: make(map[string]uint64),
-						SourceReceiptCounter:    make(map[string]uint64),
-					}
-					c.serviceMeta[srcChainServiceID] = meta
-					//ibtp, err := c.GetReceiptMessage(servicePair, index)
-					//if err != nil {
-					//	logger.Error("Polling out message",
-					//		"servicePair", servicePair,
-					//		"index", index,
-					//		"error", err.Error())
-					//	continue
-					//}
-					//
-					//c.eventC <- ibtp
-					//meta.ReceiptCounter[dstChainServiceID] = index
-					//continue
-				}
-
-				for i := meta.ReceiptCounter[dstChainServiceID] + 1; i <= index; i++ {
-					ibtp, err := c.GetReceiptMessage(servicePair, i)
-					if err != nil {
-						logger.Error("Polling out message",
-							"servicePair", servicePair,
-							"index", i,
-							"error", err.Error())
-						continue
-					}
-
-					c.eventC <- ibtp
-					meta.ReceiptCounter[dstChainServiceID]++
-				}
-			}
-		case <-c.done:
+			c.catchUpAll()
+		case <-c.ctx.Done():
 			logger.Info("Stop long polling")
 			return
 		}
 	}
 }
 
-func (c *Client) getProof(response channel.Response) ([]byte, error) {
-	var proof []byte
-	var handle = func(response channel.Response) ([]byte, error) {
-		// query proof from fabric
-		l, err := ledger.New(c.consumer.channelProvider)
-		if err != nil {
-			return nil, err
+// catchUpAll delivers the messages of every service pair up to the indexes on
+// chain
+func (c *Client) catchUpAll() {
+	outMeta, err := c.GetOutMeta()
+	if err != nil {
+		logger.Error("Get out meta", "error", err.Error())
+		return
+	}
+	inMeta, err := c.GetInMeta()
+	if err != nil {
+		logger.Error("Get in meta", "error", err.Error())
+		return
+	}
+	for servicePair, index := range outMeta {
+		c.catchUp(servicePair, pb.IBTP_INTERCHAIN, index, c.GetOutMessages)
+	}
+	for servicePair, index := range inMeta {
+		c.catchUp(servicePair, pb.IBTP_RECEIPT_SUCCESS, index, c.GetReceiptMessages)
+	}
+}
+
+// handleEvent delivers the ibtp carried by a chaincode event. Events may be
+// missed while the plugin is down, so the ibtps before it are fetched first to
+// keep each service pair in order.
+func (c *Client) handleEvent(ibtp *pb.IBTP) {
+	servicePair := genServicePair(ibtp.From, ibtp.To)
+	delivered, err := c.serviceMeta.Index(ibtp.Type, servicePair)
+	if err != nil {
+		logger.Error("Invalid service pair of event",
+			"servicePair", servicePair,
+			"error", err.Error())
+		return
+	}
+	if ibtp.Index <= delivered {
+		return
+	}
+
+	fetch := c.GetOutMessages
+	if ibtp.Type != pb.IBTP_INTERCHAIN {
+		fetch = c.GetReceiptMessages
+	}
+	if !c.catchUp(servicePair, ibtp.Type, ibtp.Index-1, fetch) {
+		return
+	}
+
+	if err := c.deliver(ibtp); err != nil {
+		logger.Info("Drop event on stop", "id", ibtp.ID())
+	}
+}
+
+// catchUp fetches the ibtps of servicePair after the counter up to index in
+// parallel and delivers them in order. It stops at the first failure and tells
+// whether index is reached.
+func (c *Client) catchUp(servicePair string, typ pb.IBTP_Type, index uint64, fetch func(string, uint64, uint64) ([]*pb.IBTP, error)) bool {
+	delivered, err := c.serviceMeta.Index(typ, servicePair)
+	if err != nil {
+		logger.Error("Polling out invalid service pair",
+			"servicePair", servicePair,
+			"error", err.Error())
+		return false
+	}
+	if index < delivered {
+		logger.Error("Chaincode index is behind delivered index",
+			"servicePair", servicePair,
+			"index", index,
+			"delivered", delivered)
+		return false
+	}
+	failed, err := fetchOrdered(servicePair, delivered+1, index, messagePageSize, c.config.Fabric.FetchWorkers, fetch, c.deliver)
+	if err != nil {
+		if c.ctx.Err() != nil {
+			return false
 		}
+		logger.Error("Polling message",
+			"servicePair", servicePair,
+			"index", failed,
+			"error", err.Error())
+		return false
+	}
+	return true
+}
+
+// deliver sends ibtp to pier and checkpoints it, it gives up once the client
+// is stopped
+func (c *Client) deliver(ibtp *pb.IBTP) error {
+	select {
+	case c.eventC <- ibtp:
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+	if err := c.serviceMeta.SetIndex(ibtp.Type, genServicePair(ibtp.From, ibtp.To), ibtp.Index); err != nil {
+		logger.Error("Record delivered ibtp", "id", ibtp.ID(), "error", err.Error())
+	}
+	c.checkpoint.Save(ibtp)
+	return nil
+}
 
-		t, err := l.QueryTransaction(response.TransactionID)
+// getMessageProof is getProof of a message of the broker. Messages migrated
+// from the legacy storage of the broker are refused, no transaction known to
+// the broker emitted them.
+func (c *Client) getMessageProof(txID string, migrated bool) ([]byte, error) {
+	if migrated {
+		return nil, fmt.Errorf("message is migrated from the legacy storage of the broker and can not be proven")
+	}
+	return c.getProof(txID)
+}
+
+// getProof builds the proof bundle of transaction txID, which is the one that
+// wrote the message to the broker
+func (c *Client) getProof(txID string) ([]byte, error) {
+	if txID == "" {
+		return nil, fmt.Errorf("message has no transaction id, the broker chaincode may be outdated")
+	}
+
+	var proofBytes []byte
+	var handle = func(txID fab.TransactionID) ([]byte, error) {
+		// query proof from fabric
+		block, err := c.backend.QueryBlockByTxID(txID)
 		if err != nil {
 			return nil, err
 		}
-		pd := &common.Payload{}
-		if err := proto.Unmarshal(t.TransactionEnvelope.Payload, pd); err != nil {
-			return nil, err
-		}
 
-		pt := &peer.Transaction{}
-		if err := proto.Unmarshal(pd.Data, pt); err != nil {
+		p, err := proof.Find(block, string(txID))
+		if err != nil {
 			return nil, err
 		}
 
-		return pt.Actions[0].Payload, nil
+		return p.Marshal()
 	}
 
-	if err := retry.Retry(func(attempt uint) error {
+	if err := c.retry(retryGetProof, func() error {
 		var err error
-		proof, err = handle(response)
-		if err != nil {
-			logger.Error("Can't get proof", "error", err.Error())
-			return err
-		}
-		return nil
-	}, strategy.Wait(2*time.Second)); err != nil {
-		logger.Error("Can't get proof", "error", err.Error())
+		proofBytes, err = handle(fab.TransactionID(txID))
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("get proof of transaction %s: %w", txID, err)
 	}
 
-	return proof, nil
+	return proofBytes, nil
 }
 
+// Stop cancels the context of the client and waits at most stopTimeout for its
+// goroutines. The sdk is closed first, so calls to fabric in flight fail
+// instead of holding the goroutines.
 func (c *Client) Stop() error {
+	c.cancel()
 	c.ticker.Stop()
-	c.done <- true
-	return nil
+	if c.validatorSrv != nil {
+		if err := c.validatorSrv.Stop(); err != nil {
+			logger.Error("Stop validator server", "error", err.Error())
+		}
+	}
+	if err := c.consumer.Shutdown(); err != nil {
+		logger.Error("Shutdown consumer", "error", err.Error())
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(stopTimeout):
+		return fmt.Errorf("client did not stop in %s", stopTimeout)
+	}
+
+	return c.checkpoint.Close()
 }
 
 func (c *Client) Name() string {
@@ -393,7 +558,72 @@ func (c *Client) GetIBTPCh() chan *pb.IBTP {
 }
 
 func (c *Client) SubmitReceiptBatch(to []string, index []uint64, serviceID []string, ibtpType []pb.IBTP_Type, result []*pb.Result, proof []*pb.BxhProof) (*pb.SubmitIBTPResponse, error) {
-	panic("implement me")
+	ret := &pb.SubmitIBTPResponse{Status: true}
+	size := len(to)
+	if len(index) != size || len(serviceID) != size || len(ibtpType) != size || len(result) != size || len(proof) != size {
+		ret.Status = false
+		ret.Message = fmt.Sprintf("receipt batch size mismatch: to %d, index %d, serviceID %d, type %d, result %d, proof %d",
+			len(to), len(index), len(serviceID), len(ibtpType), len(result), len(proof))
+		return ret, nil
+	}
+	if size == 0 {
+		return ret, nil
+	}
+
+	var (
+		typ      []uint64
+		results  [][][]byte
+		txStatus []uint64
+		sign     [][][]byte
+	)
+	for idx := range to {
+		if proof[idx] == nil {
+			ret.Status = false
+			ret.Message = fmt.Sprintf("receipt %s-%s-%d has no proof", to[idx], serviceID[idx], index[idx])
+			return ret, nil
+		}
+		typ = append(typ, uint64(ibtpType[idx]))
+		results = append(results, result[idx].GetData())
+		txStatus = append(txStatus, uint64(proof[idx].TxStatus))
+		sign = append(sign, proof[idx].MultiSign)
+	}
+
+	_, resp, err := c.InvokeReceipts(serviceID, to, index, typ, results, txStatus, sign)
+	if err != nil {
+		ret.Status = false
+		ret.Message = fmt.Sprintf("invoke receipts failed: %s", err.Error())
+		return ret, nil
+	}
+	if !resp.OK {
+		ret.Status, ret.Message = submitStatus(resp)
+		return ret, nil
+	}
+
+	var items []*Response
+	if err := json.Unmarshal(resp.Data, &items); err != nil {
+		ret.Status = false
+		ret.Message = fmt.Sprintf("unmarshal receipt batch results: %s", err.Error())
+		return ret, nil
+	}
+	if len(items) != size {
+		ret.Status = false
+		ret.Message = fmt.Sprintf("receipt batch results size mismatch: expect %d, got %d", size, len(items))
+		return ret, nil
+	}
+
+	// report every failed item instead of failing or passing the whole batch
+	var failed []string
+	for idx, item := range items {
+		if ok, msg := submitStatus(item); !ok {
+			failed = append(failed, fmt.Sprintf("[%d] %s-%s-%d: %s", idx, to[idx], serviceID[idx], index[idx], msg))
+		}
+	}
+	if len(failed) != 0 {
+		ret.Status = false
+		ret.Message = fmt.Sprintf("%d of %d receipts failed: %s", len(failed), size, strings.Join(failed, "; "))
+	}
+
+	return ret, nil
 }
 
 func (c *Client) SubmitIBTPBatch(from []string, index []uint64, serviceID []string, ibtpType []pb.IBTP_Type, content []*pb.Content, proof []*pb.BxhProof, isEncrypted []bool) (*pb.SubmitIBTPResponse, error) {
@@ -419,8 +649,7 @@ func (c *Client) SubmitIBTPBatch(from []string, index []uint64, serviceID []stri
 		ret.Message = fmt.Sprintf("invoke interchains failed: %s", err.Error())
 		return ret, nil
 	}
-	ret.Status = resp.OK
-	ret.Message = resp.Message
+	ret.Status, ret.Message = submitStatus(resp)
 
 	return ret, nil
 }
@@ -431,23 +660,29 @@ func (c *Client) SubmitIBTP(from string, index uint64, serviceID string, ibtpTyp
 	_, resp, err := c.InvokeInterchain(from, index, serviceID, uint64(ibtpType), content.Func, content.Args, uint64(proof.TxStatus), proof.MultiSign, isEncrypted)
 	if err != nil {
 		ret.Status = false
-		ret.Message = fmt.Sprintf("invoke interchain foribtp to call %s: %w", content.Func, err)
+		ret.Message = fmt.Sprintf("invoke interchain foribtp to call %s: %s", content.Func, err)
+		return ret, nil
+	}
+	ret.Status, ret.Message = submitStatus(resp)
+	if !ret.Status {
 		return ret, nil
 	}
-	ret.Status = resp.OK
-	ret.Message = resp.Message
 
-	if c.bitxhubID == "" || c.appchainID == "" {
-		c.bitxhubID, c.appchainID, err = c.GetChainID()
-		if err != nil {
-			ret.Status = false
-			ret.Message = fmt.Sprintf("get id err: %s", err)
-			return ret, nil
-		}
+	// the ibtp is applied from here on, a failed lookup of the receipt is
+	// reported without failing the submit, or pier would submit it again
+	bitxhubID, appchainID, err := c.chainIDs.get()
+	if err != nil {
+		ret.Message = fmt.Sprintf("applied, but get id err: %s", err)
+		return ret, nil
 	}
-	destFullID := c.bitxhubID + ":" + c.appchainID + ":" + serviceID
+	destFullID := bitxhubID + ":" + appchainID + ":" + serviceID
 	servicePair := from + "-" + destFullID
+	// the ibtp is applied already, pier retries the submit to get its receipt
 	ibtp, err := c.GetReceiptMessage(servicePair, index)
+	if err != nil {
+		ret.Message = fmt.Sprintf("applied, but get receipt message of %s#%d: %s", servicePair, index, err)
+		return ret, nil
+	}
 	ret.Result = ibtp
 
 	return ret, nil
@@ -459,11 +694,10 @@ func (c *Client) SubmitReceipt(to string, index uint64, serviceID string, ibtpTy
 	_, resp, err := c.InvokeReceipt(serviceID, to, index, uint64(ibtpType), result.Data, uint64(proof.TxStatus), proof.MultiSign)
 	if err != nil {
 		ret.Status = false
-		ret.Message = fmt.Sprintf("invoke receipt for ibtp to call: %w", err)
+		ret.Message = fmt.Sprintf("invoke receipt for ibtp to call: %s", err)
 		return ret, nil
 	}
-	ret.Status = resp.OK
-	ret.Message = resp.Message
+	ret.Status, ret.Message = submitStatus(resp)
 
 	return ret, nil
 }
@@ -477,7 +711,7 @@ func (c *Client) GetDirectTransactionMeta(IBTPid string) (uint64, uint64, uint64
 		Args:        args,
 	}
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Execute(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return 0, 0, 0, err
 	}
@@ -537,25 +771,13 @@ func (c *Client) InvokeInterchains(srcFullID []string, index []uint64, destAddr
 		Args:        args,
 	}
 
-	// retry executing
-	var res channel.Response
-	if err := retry.Retry(func(attempt uint) error {
-		res, err = c.consumer.ChannelClient.Execute(request)
-		if err != nil {
-			if strings.Contains(err.Error(), "Chaincode status Code: (500)") {
-				res.ChaincodeStatus = shim.ERROR
-				logger.Error("execute request failed", "err", err.Error())
-				return nil
-			}
-			return fmt.Errorf("execute request: %w", err)
-		}
-
-		return nil
-	}, strategy.Wait(2*time.Second)); err != nil {
-		logger.Error("Can't send rollback ibtp back to bitxhub", "error", err.Error())
-	}
-
+	res, err := c.execute(retryInvokeInterchains, request)
 	if err != nil {
+		if response, ok := rejection(err); ok {
+			logger.Warn("Broker rejected interchains", "code", response.Code, "message", response.Message)
+			return nil, response, nil
+		}
+		logger.Error("Can't invoke interchains", "error", err.Error())
 		return nil, nil, err
 	}
 
@@ -587,25 +809,13 @@ func (c *Client) InvokeInterchain(srcFullID string, index uint64, destAddr strin
 		Args:        args,
 	}
 
-	// retry executing
-	var res channel.Response
-	if err := retry.Retry(func(attempt uint) error {
-		res, err = c.consumer.ChannelClient.Execute(request)
-		if err != nil {
-			if strings.Contains(err.Error(), "Chaincode status Code: (500)") {
-				res.ChaincodeStatus = shim.ERROR
-				logger.Error("execute request failed", "err", err.Error())
-				return nil
-			}
-			return fmt.Errorf("execute request: %w", err)
-		}
-
-		return nil
-	}, strategy.Wait(2*time.Second)); err != nil {
-		logger.Error("Can't send rollback ibtp back to bitxhub", "error", err.Error())
-	}
-
+	res, err := c.execute(retryInvokeInterchain, request)
 	if err != nil {
+		if response, ok := rejection(err); ok {
+			logger.Warn("Broker rejected interchain", "code", response.Code, "message", response.Message)
+			return nil, response, nil
+		}
+		logger.Error("Can't invoke interchain", "error", err.Error())
 		return nil, nil, err
 	}
 
@@ -636,25 +846,71 @@ func (c *Client) InvokeReceipt(srcAddr string, dstFullID string, index uint64, r
 		Args:        args,
 	}
 
-	// retry executing
-	var res channel.Response
-	if err := retry.Retry(func(attempt uint) error {
-		res, err = c.consumer.ChannelClient.Execute(request)
-		if err != nil {
-			if strings.Contains(err.Error(), "Chaincode status Code: (500)") {
-				res.ChaincodeStatus = shim.ERROR
-				logger.Error("execute request failed", "err", err.Error())
-				return nil
-			}
-			return fmt.Errorf("execute request: %w", err)
+	res, err := c.execute(retryInvokeReceipt, request)
+	if err != nil {
+		if response, ok := rejection(err); ok {
+			logger.Warn("Broker rejected receipt", "code", response.Code, "message", response.Message)
+			return nil, response, nil
 		}
+		logger.Error("Can't invoke receipt", "error", err.Error())
+		return nil, nil, err
+	}
+
+	logger.Info("response", "cc status", strconv.Itoa(int(res.ChaincodeStatus)), "payload", string(res.Payload))
+	response := &Response{}
+	if err := json.Unmarshal(res.Payload, response); err != nil {
+		return nil, nil, err
+	}
+
+	return &res, response, nil
+}
+
+func (c *Client) InvokeReceipts(srcAddr []string, dstFullID []string, index []uint64, reqType []uint64, result [][][]byte, txStatus []uint64, multiSign [][][]byte) (*channel.Response, *Response, error) {
+	srcAddrBytes, err := json.Marshal(srcAddr)
+	if err != nil {
+		return nil, nil, err
+	}
+	dstFullIDBytes, err := json.Marshal(dstFullID)
+	if err != nil {
+		return nil, nil, err
+	}
+	indexBytes, err := json.Marshal(index)
+	if err != nil {
+		return nil, nil, err
+	}
+	reqTypeBytes, err := json.Marshal(reqType)
+	if err != nil {
+		return nil, nil, err
+	}
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return nil, nil, err
+	}
+	txStatusBytes, err := json.Marshal(txStatus)
+	if err != nil {
+		return nil, nil, err
+	}
+	multiSignBytes, err := json.Marshal(multiSign)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	args := util.ToChaincodeArgs(string(srcAddrBytes), string(dstFullIDBytes), string(indexBytes), string(reqTypeBytes),
+		string(resultBytes), string(txStatusBytes), string(multiSignBytes))
 
-		return nil
-	}, strategy.Wait(2*time.Second)); err != nil {
-		logger.Error("Can't send rollback ibtp back to bitxhub", "error", err.Error())
+	request := channel.Request{
+		ChaincodeID: c.meta.CCID,
+		Fcn:         InvokeReceiptsMethod,
+		Args:        args,
 	}
 
+	res, err := c.execute(retryInvokeReceipts, request)
 	if err != nil {
+		if response, ok := rejection(err); ok {
+			logger.Warn("Broker rejected receipts", "code", response.Code, "message", response.Message)
+			return nil, response, nil
+		}
+		logger.Error("Can't invoke receipts", "error", err.Error())
 		return nil, nil, err
 	}
 
@@ -676,16 +932,44 @@ func (c *Client) GetOutMessage(servicePair string, idx uint64) (*pb.IBTP, error)
 	}
 
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Execute(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return nil, err
 	}
 
-	proof, err := c.getProof(response)
+	return c.unpackIBTP(&response, pb.IBTP_INTERCHAIN)
+}
+
+// GetOutMessages returns the interchain ibtps of servicePair from index from to
+// index to, fewer are returned if the range exceeds the page limit of the broker
+func (c *Client) GetOutMessages(servicePair string, from, to uint64) ([]*pb.IBTP, error) {
+	request := channel.Request{
+		ChaincodeID: c.meta.CCID,
+		Fcn:         GetOutMessagesMethod,
+		Args:        util.ToChaincodeArgs(servicePair, strconv.FormatUint(from, 10), strconv.FormatUint(to, 10)),
+	}
+
+	response, err := c.backend.Query(request)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("query out messages: %w", err)
+	}
+
+	events := make([]*Event, 0)
+	if err := json.Unmarshal(response.Payload, &events); err != nil {
+		return nil, fmt.Errorf("unmarshal out messages: %w", err)
+	}
+
+	ibtps := make([]*pb.IBTP, 0, len(events))
+	for _, event := range events {
+		proof, err := c.getMessageProof(event.TxID, event.Migrated)
+		if err != nil {
+			return nil, err
+		}
+		ibtp := event.Convert2IBTP(c.timeoutHeight, pb.IBTP_INTERCHAIN)
+		ibtp.Proof = proof
+		ibtps = append(ibtps, ibtp)
 	}
-	return c.unpackIBTP(&response, pb.IBTP_INTERCHAIN, proof)
+	return ibtps, nil
 }
 
 func (c *Client) GetInMessage(servicePair string, index uint64) ([][]byte, []byte, bool, uint64, error) {
@@ -696,10 +980,10 @@ func (c *Client) GetInMessage(servicePair string, index uint64) ([][]byte, []byt
 	}
 
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Execute(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
-		logger.Error("GetInMessage:ChannelClient.Execute error:", err.Error())
-		return nil, nil, false, 0, fmt.Errorf("execute req: %w", err)
+		logger.Error("GetInMessage:ChannelClient.Query error:", err.Error())
+		return nil, nil, false, 0, fmt.Errorf("query req: %w", err)
 	}
 
 	resp := &Receipt{}
@@ -708,19 +992,13 @@ func (c *Client) GetInMessage(servicePair string, index uint64) ([][]byte, []byt
 		return nil, nil, false, 0, err
 	}
 
-	results := []string{"true"}
-	if resp.Result.Status == shim.ERROR {
-		results = []string{"false"}
-	}
-	results = append(results, strings.Split(string(resp.Result.Payload), ",")...)
-
-	proof, err := c.getProof(response)
+	proof, err := c.getMessageProof(resp.TxID, resp.Migrated)
 	if err != nil {
 		logger.Error("GetInMessage:getProof error:", err.Error())
 		return nil, nil, false, 0, err
 	}
 
-	return util.ToChaincodeArgs(results...), proof, resp.Encrypt, resp.Typ, nil
+	return resp.results(), proof, resp.Encrypt, resp.Typ, nil
 }
 
 func (c *Client) GetInMeta() (map[string]uint64, error) {
@@ -730,7 +1008,7 @@ func (c *Client) GetInMeta() (map[string]uint64, error) {
 	}
 
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Query(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return nil, err
 	}
@@ -745,7 +1023,7 @@ func (c *Client) GetOutMeta() (map[string]uint64, error) {
 	}
 
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Query(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return nil, err
 	}
@@ -760,7 +1038,7 @@ func (c *Client) GetCallbackMeta() (map[string]uint64, error) {
 	}
 
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Query(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return nil, err
 	}
@@ -789,7 +1067,51 @@ func (c *Client) GetReceiptMessage(servicePair string, idx uint64) (*pb.IBTP, er
 	if err != nil {
 		return nil, err
 	}
-	return c.generateReceipt(srcServiceID, dstServiceID, idx, result[1:], proof, status, encrypt, typ)
+	return generateReceipt(srcServiceID, dstServiceID, idx, result[1:], proof, status, encrypt, typ)
+}
+
+// GetReceiptMessages returns the receipt ibtps of servicePair from index from
+// to index to, fewer are returned if the range exceeds the page limit of the
+// broker
+func (c *Client) GetReceiptMessages(servicePair string, from, to uint64) ([]*pb.IBTP, error) {
+	request := channel.Request{
+		ChaincodeID: c.meta.CCID,
+		Fcn:         GetInMessagesMethod,
+		Args:        util.ToChaincodeArgs(servicePair, strconv.FormatUint(from, 10), strconv.FormatUint(to, 10)),
+	}
+
+	response, err := c.backend.Query(request)
+	if err != nil {
+		return nil, fmt.Errorf("query in messages: %w", err)
+	}
+
+	receipts := make([]*Receipt, 0)
+	if err := json.Unmarshal(response.Payload, &receipts); err != nil {
+		return nil, fmt.Errorf("unmarshal in messages: %w", err)
+	}
+
+	srcServiceID, dstServiceID, err := pb.ParseServicePair(servicePair)
+	if err != nil {
+		return nil, err
+	}
+	ibtps := make([]*pb.IBTP, 0, len(receipts))
+	for i, receipt := range receipts {
+		proof, err := c.getMessageProof(receipt.TxID, receipt.Migrated)
+		if err != nil {
+			return nil, err
+		}
+		result := receipt.results()
+		status, err := strconv.ParseBool(string(result[0]))
+		if err != nil {
+			return nil, err
+		}
+		ibtp, err := generateReceipt(srcServiceID, dstServiceID, from+uint64(i), result[1:], proof, status, receipt.Encrypt, receipt.Typ)
+		if err != nil {
+			return nil, err
+		}
+		ibtps = append(ibtps, ibtp)
+	}
+	return ibtps, nil
 }
 
 func (c *Client) InvokeIndexUpdate(from string, index uint64, serviceId string, category pb.IBTP_Category) (*channel.Response, *Response, error) {
@@ -801,8 +1123,11 @@ func (c *Client) InvokeIndexUpdate(from string, index uint64, serviceId string,
 		Args:        args,
 	}
 
-	res, err := c.consumer.ChannelClient.Execute(request)
+	res, err := c.execute(retryInvokeIndexUpdate, request)
 	if err != nil {
+		if response, ok := rejection(err); ok {
+			return nil, response, nil
+		}
 		return nil, nil, err
 	}
 
@@ -815,7 +1140,18 @@ func (c *Client) InvokeIndexUpdate(from string, index uint64, serviceId string,
 }
 
 func (c *Client) GetSrcRollbackMeta() (map[string]uint64, error) {
-	panic("implement me")
+	request := channel.Request{
+		ChaincodeID: c.meta.CCID,
+		Fcn:         GetSrcRollbackMeta,
+	}
+
+	var response channel.Response
+	response, err := c.backend.Query(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.unpackMap(response)
 }
 
 func (c *Client) GetDstRollbackMeta() (map[string]uint64, error) {
@@ -825,7 +1161,7 @@ func (c *Client) GetDstRollbackMeta() (map[string]uint64, error) {
 	}
 
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Query(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return nil, err
 	}
@@ -840,7 +1176,7 @@ func (c *Client) GetServices() ([]string, error) {
 	}
 
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Query(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return nil, err
 	}
@@ -863,7 +1199,7 @@ func (c *Client) GetChainID() (string, string, error) {
 		Fcn:         GetChainId,
 	}
 
-	response, err := c.consumer.ChannelClient.Query(request)
+	response, err := c.backend.Query(request)
 	if err != nil || response.Payload == nil {
 		return "", "", err
 	}
@@ -874,19 +1210,22 @@ func (c *Client) GetChainID() (string, string, error) {
 	return chainIds[0], chainIds[1], nil
 }
 
-func (c *Client) unpackIBTP(response *channel.Response, ibtpType pb.IBTP_Type, proof []byte) (*pb.IBTP, error) {
+func (c *Client) unpackIBTP(response *channel.Response, ibtpType pb.IBTP_Type) (*pb.IBTP, error) {
 	ret := &Event{}
 	if err := json.Unmarshal(response.Payload, ret); err != nil {
 		return nil, err
 	}
+	proof, err := c.getMessageProof(ret.TxID, ret.Migrated)
+	if err != nil {
+		return nil, err
+	}
 	ibtp := ret.Convert2IBTP(c.timeoutHeight, ibtpType)
 	ibtp.Proof = proof
 	return ibtp, nil
 }
 
 func (c *Client) GetUpdateMeta() chan *pb.UpdateMeta {
-	// TODO: Update fabric validator
-	return nil
+	return c.updateC
 }
 
 func (c *Client) unpackMap(response channel.Response) (map[string]uint64, error) {
@@ -910,7 +1249,7 @@ func (c *Client) GetAppchainInfo(chainID string) (string, []byte, string, error)
 		Args:        args,
 	}
 	var response channel.Response
-	response, err := c.consumer.ChannelClient.Execute(request)
+	response, err := c.backend.Query(request)
 	if err != nil {
 		return "", nil, "", err
 	}
@@ -922,27 +1261,61 @@ func (c *Client) GetAppchainInfo(chainID string) (string, []byte, string, error)
 }
 
 type handler struct {
-	eventFilter string
-	eventC      chan *pb.IBTP
-	ID          string
+	ctx           context.Context
+	timeoutHeight int64
+	eventC        chan *pb.IBTP
 }
 
-func newFabricHandler(eventFilter string, eventC chan *pb.IBTP) (*handler, error) {
+func newFabricHandler(ctx context.Context, timeoutHeight int64, eventC chan *pb.IBTP) (*handler, error) {
 	return &handler{
-		eventC:      eventC,
-		eventFilter: eventFilter,
+		ctx:           ctx,
+		timeoutHeight: timeoutHeight,
+		eventC:        eventC,
 	}, nil
 }
 
+func (h *handler) send(ibtp *pb.IBTP) bool {
+	select {
+	case h.eventC <- ibtp:
+		return true
+	case <-h.ctx.Done():
+		return false
+	}
+}
+
+// HandleMessage converts the events of broker into ibtps, payload is the proof
+// bundle of the emitting transaction
 func (h *handler) HandleMessage(deliveries *fab.CCEvent, payload []byte) {
-	if deliveries.EventName == h.eventFilter {
-		e := &pb.IBTP{}
-		if err := e.Unmarshal(deliveries.Payload); err != nil {
+	switch deliveries.EventName {
+	case interchainEventName:
+		ev := &Event{}
+		if err := json.Unmarshal(deliveries.Payload, ev); err != nil {
+			logger.Error("Unmarshal interchain event", "txid", deliveries.TxID, "error", err.Error())
+			return
+		}
+		ibtp := ev.Convert2IBTP(h.timeoutHeight, pb.IBTP_INTERCHAIN)
+		ibtp.Proof = payload
+
+		h.send(ibtp)
+	case receiptEventName:
+		var events []*ReceiptEvent
+		if err := json.Unmarshal(deliveries.Payload, &events); err != nil {
+			logger.Error("Unmarshal receipt event", "txid", deliveries.TxID, "error", err.Error())
 			return
 		}
-		e.Proof = payload
+		for _, ev := range events {
+			results := ev.Receipt.results()
+			status := ev.Receipt.Result.Status != shim.ERROR
+			ibtp, err := generateReceipt(ev.From, ev.To, ev.Index, results[1:], payload, status, ev.Receipt.Encrypt, ev.Receipt.Typ)
+			if err != nil {
+				logger.Error("Generate receipt", "txid", deliveries.TxID, "error", err.Error())
+				return
+			}
 
-		h.eventC <- e
+			if !h.send(ibtp) {
+				return
+			}
+		}
 	}
 }
 
@@ -967,18 +1340,3 @@ func parseServicePair(servicePair string) (string, string, error) {
 func genServicePair(from, to string) string {
 	return fmt.Sprintf("%s-%s", from, to)
 }
-
-func (c *Client) GetOffChainData(request *pb.GetDataRequest) (*pb.GetDataResponse, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (c *Client) GetOffChainDataReq() chan *pb.GetDataRequest {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (c *Client) SubmitOffChainData(response *pb.GetDataResponse) error {
-	//TODO implement me
-	panic("implement me")
-}
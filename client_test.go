@@ -0,0 +1,633 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/pier-client-fabric/fakefabric"
+	"github.com/meshplus/pier-client-fabric/fakefabric/broker"
+	"github.com/meshplus/pier-client-fabric/internal/testutil"
+	"github.com/meshplus/pier-client-fabric/proof"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testChannel      = "mychannel"
+	testBxhID        = "1356"
+	testAppchainID   = "fabappchain"
+	testServiceName  = "transfer"
+	testService      = testChannel + "&" + testServiceName
+	testLocalService = testBxhID + ":" + testAppchainID + ":" + testService
+	testRemote       = "1356:chain1:mychannel&transfer"
+)
+
+// testBusiness is the business chaincode called by the broker, it records
+// the calls and fails the function "fail"
+type testBusiness struct {
+	lock  sync.Mutex
+	calls []string
+}
+
+func (b *testBusiness) Init(stub shim.ChaincodeStubInterface) peer.Response {
+	return shim.Success(nil)
+}
+
+func (b *testBusiness) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	function, args := stub.GetFunctionAndParameters()
+
+	b.lock.Lock()
+	b.calls = append(b.calls, function)
+	b.lock.Unlock()
+
+	switch function {
+	case "fail":
+		return shim.Error("business failed")
+	case "forge":
+		// send a request to args[0], then replace the event of the broker
+		// by one calling args[1]
+		callArgs, _ := json.Marshal([][]byte{[]byte("alice"), []byte("1")})
+		resp := stub.InvokeChaincode("broker", util.ToChaincodeArgs("EmitInterchainEvent", args[0],
+			"interchainCharge", string(callArgs), "", "[]", "", "[]", "false"), testChannel)
+		if resp.Status != shim.OK {
+			return resp
+		}
+		ev := &Event{}
+		if err := json.Unmarshal(resp.Payload, ev); err != nil {
+			return shim.Error(err.Error())
+		}
+		ev.CallFunc.Func = args[1]
+		forged, _ := json.Marshal(ev)
+		if err := stub.SetEvent(interchainEventName, forged); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	return shim.Success([]byte(strings.Join(args, ",")))
+}
+
+func (b *testBusiness) called(function string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, call := range b.calls {
+		if call == function {
+			return true
+		}
+	}
+	return false
+}
+
+// testNetwork is a channel running the broker in relay mode with one
+// validator, and the business chaincode registered to the broker
+type testNetwork struct {
+	fabric    *fakefabric.Fabric
+	business  *testBusiness
+	validator *ecdsa.PrivateKey
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	fabric, err := fakefabric.New(testChannel)
+	require.Nil(t, err)
+	validator, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	n := &testNetwork{
+		fabric:    fabric,
+		business:  &testBusiness{},
+		validator: validator,
+	}
+
+	require.Nil(t, fabric.Deploy("broker", new(broker.Broker)))
+	require.Nil(t, fabric.Deploy(testServiceName, n.business))
+
+	address := strings.ToLower(crypto.PubkeyToAddress(validator.PublicKey).Hex())
+	n.execute(t, "initialize", testBxhID, testAppchainID, "1", address)
+	_, err = fabric.InvokeFrom(testServiceName, channel.Request{
+		ChaincodeID: "broker",
+		Fcn:         "register",
+		Args:        util.ToChaincodeArgs("false"),
+	})
+	require.Nil(t, err)
+	n.execute(t, "audit", testChannel, testServiceName, "1")
+
+	return n
+}
+
+func (n *testNetwork) execute(t *testing.T, fcn string, args ...string) {
+	_, err := n.fabric.Execute(channel.Request{
+		ChaincodeID: "broker",
+		Fcn:         fcn,
+		Args:        util.ToChaincodeArgs(args...),
+	})
+	require.Nil(t, err)
+}
+
+// emit sends an interchain request from the business chaincode to dst
+func (n *testNetwork) emit(t *testing.T, dst string) {
+	args, err := json.Marshal([][]byte{[]byte("alice"), []byte("1")})
+	require.Nil(t, err)
+
+	_, err = n.fabric.InvokeFrom(testServiceName, channel.Request{
+		ChaincodeID: "broker",
+		Fcn:         "EmitInterchainEvent",
+		Args: util.ToChaincodeArgs(dst, "interchainCharge", string(args),
+			"interchainConfirm", string(args), "interchainRollback", string(args), "false"),
+	})
+	require.Nil(t, err)
+}
+
+// sign signs the message the broker checks for an ibtp with the validator
+func (n *testNetwork) sign(t *testing.T, from, to string, index uint64, typ pb.IBTP_Type, content [][]byte, txStatus pb.TransactionStatus) [][]byte {
+	sig, err := testutil.SignIBTP(n.validator, from, to, index, typ, content, txStatus)
+	require.Nil(t, err)
+	return [][]byte{sig}
+}
+
+func newTestClient(t *testing.T, n *testNetwork) *Client {
+	checkpoint, err := NewCheckpoint(t.TempDir())
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		checkpoint.Close()
+	})
+
+	config := DefaultConfig()
+	config.Retry.MaxAttempts = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Client{
+		meta: &ContractMeta{
+			CCID:      config.Fabric.CCID,
+			ChannelID: testChannel,
+		},
+		backend:       n.fabric,
+		eventC:        make(chan *pb.IBTP),
+		ccEventC:      make(chan *pb.IBTP, 1024),
+		serviceMeta:   NewServiceMeta(),
+		ticker:        time.NewTicker(10 * time.Millisecond),
+		ctx:           ctx,
+		cancel:        cancel,
+		timeoutHeight: config.Fabric.TimeoutHeight,
+		config:        config,
+		offChainMeta:  make(map[string]uint64),
+		checkpoint:    checkpoint,
+	}
+	c.chainIDs = &chainIDs{resolve: c.GetChainID}
+	t.Cleanup(func() {
+		c.cancel()
+		c.ticker.Stop()
+		c.wg.Wait()
+	})
+	return c
+}
+
+func receiveIBTP(t *testing.T, c *Client) *pb.IBTP {
+	select {
+	case ibtp := <-c.eventC:
+		return ibtp
+	case <-time.After(5 * time.Second):
+		t.Fatal("no ibtp is delivered")
+		return nil
+	}
+}
+
+// requireProof checks that p proves a transaction writing to the broker
+func requireProof(t *testing.T, p []byte) {
+	bundle, err := proof.Unmarshal(p)
+	require.Nil(t, err)
+	tx, err := proof.ParseEndorserTx(bundle.Envelope)
+	require.Nil(t, err)
+	require.NotNil(t, tx)
+	require.True(t, proof.WritesNamespace(tx.ChaincodeAction.Results, "broker"))
+}
+
+func TestInitServiceMeta(t *testing.T) {
+	n := newTestNetwork(t)
+	for i := 0; i < 3; i++ {
+		n.emit(t, testRemote)
+	}
+	content := &pb.Content{Func: "interchainCharge", Args: [][]byte{[]byte("bob"), []byte("1")}}
+	sigs := n.sign(t, testRemote, testLocalService, 1, pb.IBTP_INTERCHAIN, append([][]byte{[]byte(content.Func)}, content.Args...), pb.TransactionStatus_BEGIN)
+
+	c := newTestClient(t, n)
+	ret, err := c.SubmitIBTP(testRemote, 1, testService, pb.IBTP_INTERCHAIN, content, &pb.BxhProof{TxStatus: pb.TransactionStatus_BEGIN, MultiSign: sigs}, false)
+	require.Nil(t, err)
+	require.True(t, ret.Status, ret.Message)
+
+	outPair := genServicePair(testLocalService, testRemote)
+	inPair := genServicePair(testRemote, testLocalService)
+
+	// the checkpoint wins over the index on chain
+	c.checkpoint.SetInterchain(outPair, 2)
+	require.Nil(t, c.initServiceMeta())
+
+	index, err := c.serviceMeta.Index(pb.IBTP_INTERCHAIN, outPair)
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), index)
+	index, err = c.serviceMeta.Index(pb.IBTP_RECEIPT_SUCCESS, inPair)
+	require.Nil(t, err)
+	require.Equal(t, uint64(1), index)
+	require.Equal(t, uint64(1), c.checkpoint.Receipts()[inPair])
+
+	// the index on chain is behind the checkpoint
+	c = newTestClient(t, n)
+	c.checkpoint.SetInterchain(outPair, 4)
+	require.NotNil(t, c.initServiceMeta())
+}
+
+func TestPolling(t *testing.T) {
+	n := newTestNetwork(t)
+	for i := 0; i < 3; i++ {
+		n.emit(t, testRemote)
+	}
+
+	c := newTestClient(t, n)
+	require.Nil(t, c.initServiceMeta())
+	// start from scratch to catch up with the messages emitted already
+	outPair := genServicePair(testLocalService, testRemote)
+	require.Nil(t, c.serviceMeta.SetIndex(pb.IBTP_INTERCHAIN, outPair, 0))
+	c.run(c.polling)
+
+	for i := uint64(1); i <= 3; i++ {
+		ibtp := receiveIBTP(t, c)
+		require.Equal(t, i, ibtp.Index)
+		require.Equal(t, testLocalService, ibtp.From)
+		require.Equal(t, testRemote, ibtp.To)
+		require.Equal(t, pb.IBTP_INTERCHAIN, ibtp.Type)
+		requireProof(t, ibtp.Proof)
+	}
+
+	// messages emitted later are picked up on the next tick
+	n.emit(t, testRemote)
+	ibtp := receiveIBTP(t, c)
+	require.Equal(t, uint64(4), ibtp.Index)
+	require.Equal(t, uint64(4), c.checkpoint.Interchains()[outPair])
+}
+
+func TestPollingEventDriven(t *testing.T) {
+	n := newTestNetwork(t)
+	n.emit(t, testRemote)
+
+	c := newTestClient(t, n)
+	// only chaincode events and the catch up at start deliver ibtps
+	c.ticker.Stop()
+	c.ticker = time.NewTicker(time.Hour)
+	handler, err := newFabricHandler(c.ctx, c.timeoutHeight, c.ccEventC)
+	require.Nil(t, err)
+	c.consumer = NewConsumer(n.fabric, c.meta, handler)
+	require.Nil(t, c.initServiceMeta())
+	require.Nil(t, c.consumer.Start(c.ctx))
+	defer c.consumer.Shutdown()
+	c.run(c.polling)
+
+	for i := 0; i < 3; i++ {
+		n.emit(t, testRemote)
+	}
+	for i := uint64(2); i <= 4; i++ {
+		ibtp := receiveIBTP(t, c)
+		require.Equal(t, i, ibtp.Index)
+		requireProof(t, ibtp.Proof)
+	}
+}
+
+func TestEventForged(t *testing.T) {
+	n := newTestNetwork(t)
+	c := newTestClient(t, n)
+	c.ticker.Stop()
+	c.ticker = time.NewTicker(time.Hour)
+	handler, err := newFabricHandler(c.ctx, c.timeoutHeight, c.ccEventC)
+	require.Nil(t, err)
+	c.consumer = NewConsumer(n.fabric, c.meta, handler)
+	require.Nil(t, c.initServiceMeta())
+	require.Nil(t, c.consumer.Start(c.ctx))
+	defer c.consumer.Shutdown()
+	c.run(c.polling)
+
+	// the forged event is dropped, the message written by the broker is
+	// delivered once the next event shows the gap
+	_, err = n.fabric.Execute(channel.Request{
+		ChaincodeID: testServiceName,
+		Fcn:         "forge",
+		Args:        util.ToChaincodeArgs(testRemote, "interchainSteal"),
+	})
+	require.Nil(t, err)
+	n.emit(t, testRemote)
+	for i := uint64(1); i <= 2; i++ {
+		ibtp := receiveIBTP(t, c)
+		require.Equal(t, i, ibtp.Index)
+		payload := &pb.Payload{}
+		require.Nil(t, payload.Unmarshal(ibtp.Payload))
+		content := &pb.Content{}
+		require.Nil(t, content.Unmarshal(payload.Content))
+		require.Equal(t, "interchainCharge", content.Func)
+	}
+
+	// receipt events are checked against the receipts written
+	content := &pb.Content{Func: "interchainCharge", Args: [][]byte{[]byte("bob"), []byte("1")}}
+	sigs := n.sign(t, testRemote, testLocalService, 1, pb.IBTP_INTERCHAIN, append([][]byte{[]byte(content.Func)}, content.Args...), pb.TransactionStatus_BEGIN)
+	ret, err := c.SubmitIBTP(testRemote, 1, testService, pb.IBTP_INTERCHAIN, content, &pb.BxhProof{TxStatus: pb.TransactionStatus_BEGIN, MultiSign: sigs}, false)
+	require.Nil(t, err)
+	require.True(t, ret.Status, ret.Message)
+	ibtp := receiveIBTP(t, c)
+	require.Equal(t, pb.IBTP_RECEIPT_SUCCESS, ibtp.Type)
+	require.Equal(t, uint64(1), ibtp.Index)
+}
+
+func TestCheckEvent(t *testing.T) {
+	ev := &Event{Index: 1, SrcFullID: testLocalService, DstFullID: testRemote, CallFunc: CallFunc{Func: "interchainCharge"}}
+	payload, err := json.Marshal(ev)
+	require.Nil(t, err)
+	key := compositeKey(outMsgPrefix, genServicePair(testLocalService, testRemote), "1")
+
+	require.Nil(t, checkEvent(interchainEventName, payload, map[string][]byte{key: payload}))
+	require.NotNil(t, checkEvent(interchainEventName, payload, map[string][]byte{}))
+	require.NotNil(t, checkEvent(interchainEventName, payload, map[string][]byte{key: []byte("{}")}))
+	require.NotNil(t, checkEvent(interchainEventName, []byte("{"), map[string][]byte{key: payload}))
+
+	receipt := []byte(`{"encrypt":false,"typ":1}`)
+	receipts := []byte(`[{"from":"` + testRemote + `","to":"` + testLocalService + `","index":2,"receipt":` + string(receipt) + `}]`)
+	key = compositeKey(inMsgPrefix, genServicePair(testRemote, testLocalService), "2")
+	require.Nil(t, checkEvent(receiptEventName, receipts, map[string][]byte{key: receipt}))
+	require.NotNil(t, checkEvent(receiptEventName, receipts, map[string][]byte{key: []byte(`{"typ":2}`)}))
+
+	require.NotNil(t, checkEvent("offchain-data-event-name", payload, map[string][]byte{key: payload}))
+}
+
+func TestSubmitIBTP(t *testing.T) {
+	n := newTestNetwork(t)
+	c := newTestClient(t, n)
+
+	content := &pb.Content{Func: "interchainCharge", Args: [][]byte{[]byte("bob"), []byte("1")}}
+	signed := append([][]byte{[]byte(content.Func)}, content.Args...)
+	submit := func(index uint64, serviceID string, sigs [][]byte) *pb.SubmitIBTPResponse {
+		ret, err := c.SubmitIBTP(testRemote, index, serviceID, pb.IBTP_INTERCHAIN, content,
+			&pb.BxhProof{TxStatus: pb.TransactionStatus_BEGIN, MultiSign: sigs}, false)
+		require.Nil(t, err)
+		return ret
+	}
+
+	sigs := n.sign(t, testRemote, testLocalService, 1, pb.IBTP_INTERCHAIN, signed, pb.TransactionStatus_BEGIN)
+	ret := submit(1, testService, sigs)
+	require.True(t, ret.Status, ret.Message)
+	require.True(t, n.business.called("interchainCharge"))
+	require.NotNil(t, ret.Result)
+	require.Equal(t, uint64(1), ret.Result.Index)
+	require.Equal(t, pb.IBTP_RECEIPT_SUCCESS, ret.Result.Type)
+	requireProof(t, ret.Result.Proof)
+
+	// a replayed ibtp is done, not rejected
+	ret = submit(1, testService, sigs)
+	require.True(t, ret.Status, ret.Message)
+	require.Contains(t, ret.Message, "already applied")
+
+	sigs = n.sign(t, testRemote, testLocalService, 3, pb.IBTP_INTERCHAIN, signed, pb.TransactionStatus_BEGIN)
+	ret = submit(3, testService, sigs)
+	require.False(t, ret.Status)
+	require.True(t, strings.HasPrefix(ret.Message, CodeIndexMismatch), ret.Message)
+
+	sigs = n.sign(t, testRemote, testLocalService, 3, pb.IBTP_INTERCHAIN, signed, pb.TransactionStatus_BEGIN)
+	ret = submit(2, testService, sigs)
+	require.False(t, ret.Status)
+	require.True(t, strings.HasPrefix(ret.Message, CodeBadSignature), ret.Message)
+
+	ret = submit(2, testChannel+"&unknown", sigs)
+	require.False(t, ret.Status)
+	require.True(t, strings.HasPrefix(ret.Message, CodeServiceNotWhitelisted), ret.Message)
+
+	// an applied ibtp is not failed by the lookup of its receipt
+	c.backend = &noBlockBackend{n.fabric}
+	sigs = n.sign(t, testRemote, testLocalService, 2, pb.IBTP_INTERCHAIN, signed, pb.TransactionStatus_BEGIN)
+	ret = submit(2, testService, sigs)
+	require.True(t, ret.Status, ret.Message)
+	require.Contains(t, ret.Message, "applied, but get receipt message")
+	require.Nil(t, ret.Result)
+	c.backend = n.fabric
+	ret = submit(2, testService, sigs)
+	require.True(t, ret.Status, ret.Message)
+	require.Contains(t, ret.Message, "already applied")
+	require.NotNil(t, ret.Result)
+}
+
+// noBlockBackend finds no block of any transaction, so no proof can be built
+type noBlockBackend struct {
+	Backend
+}
+
+func (b *noBlockBackend) QueryBlockByTxID(txID fab.TransactionID) (*common.Block, error) {
+	return nil, fmt.Errorf("block of %s not found", txID)
+}
+
+func TestSubmitReceipt(t *testing.T) {
+	n := newTestNetwork(t)
+	n.emit(t, testRemote)
+	n.emit(t, testRemote)
+	c := newTestClient(t, n)
+
+	result := &pb.Result{Data: [][]byte{[]byte("true")}}
+	submit := func(index uint64, typ pb.IBTP_Type, txStatus pb.TransactionStatus) *pb.SubmitIBTPResponse {
+		sigs := n.sign(t, testLocalService, testRemote, index, typ, result.Data, txStatus)
+		ret, err := c.SubmitReceipt(testRemote, index, testService, typ, result,
+			&pb.BxhProof{TxStatus: txStatus, MultiSign: sigs})
+		require.Nil(t, err)
+		return ret
+	}
+
+	ret := submit(1, pb.IBTP_RECEIPT_SUCCESS, pb.TransactionStatus_SUCCESS)
+	require.True(t, ret.Status, ret.Message)
+	require.True(t, n.business.called("interchainConfirm"))
+
+	ret = submit(1, pb.IBTP_RECEIPT_SUCCESS, pb.TransactionStatus_SUCCESS)
+	require.True(t, ret.Status, ret.Message)
+	require.Contains(t, ret.Message, "already applied")
+
+	// a failed transaction on bitxhub rolls the request back
+	ret = submit(2, pb.IBTP_RECEIPT_FAILURE, pb.TransactionStatus_FAILURE)
+	require.True(t, ret.Status, ret.Message)
+	require.True(t, n.business.called("interchainRollback"))
+
+	ret = submit(4, pb.IBTP_RECEIPT_SUCCESS, pb.TransactionStatus_SUCCESS)
+	require.False(t, ret.Status)
+	require.True(t, strings.HasPrefix(ret.Message, CodeIndexMismatch), ret.Message)
+}
+
+func TestSubmitReceiptBatch(t *testing.T) {
+	n := newTestNetwork(t)
+	for i := 0; i < 3; i++ {
+		n.emit(t, testRemote)
+	}
+	c := newTestClient(t, n)
+
+	var (
+		to        []string
+		index     []uint64
+		serviceID []string
+		ibtpType  []pb.IBTP_Type
+		results   []*pb.Result
+		proofs    []*pb.BxhProof
+	)
+	add := func(idx uint64, signed bool) {
+		result := &pb.Result{Data: [][]byte{[]byte("true")}}
+		bxhProof := &pb.BxhProof{TxStatus: pb.TransactionStatus_SUCCESS}
+		if signed {
+			bxhProof.MultiSign = n.sign(t, testLocalService, testRemote, idx, pb.IBTP_RECEIPT_SUCCESS, result.Data, bxhProof.TxStatus)
+		}
+		to = append(to, testRemote)
+		index = append(index, idx)
+		serviceID = append(serviceID, testService)
+		ibtpType = append(ibtpType, pb.IBTP_RECEIPT_SUCCESS)
+		results = append(results, result)
+		proofs = append(proofs, bxhProof)
+	}
+
+	// every failed receipt is reported, the others are applied
+	add(1, true)
+	add(2, false)
+	add(2, true)
+	add(4, true)
+	ret, err := c.SubmitReceiptBatch(to, index, serviceID, ibtpType, results, proofs)
+	require.Nil(t, err)
+	require.False(t, ret.Status)
+	require.Contains(t, ret.Message, "2 of 4 receipts failed")
+	require.Contains(t, ret.Message, "[1] "+testRemote+"-"+testService+"-2: "+CodeBadSignature)
+	require.Contains(t, ret.Message, "[3] "+testRemote+"-"+testService+"-4: "+CodeIndexMismatch)
+	require.True(t, n.business.called("interchainConfirm"))
+	callbacks, err := c.GetCallbackMeta()
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), callbacks[genServicePair(testLocalService, testRemote)])
+
+	ret, err = c.SubmitReceiptBatch(to[3:], index[3:], serviceID[3:], ibtpType[3:], results[3:], proofs[3:])
+	require.Nil(t, err)
+	require.False(t, ret.Status)
+	require.True(t, strings.HasPrefix(ret.Message, "1 of 1 receipts failed"), ret.Message)
+
+	index[3] = 3
+	proofs[3].MultiSign = n.sign(t, testLocalService, testRemote, 3, pb.IBTP_RECEIPT_SUCCESS, results[3].Data, pb.TransactionStatus_SUCCESS)
+	ret, err = c.SubmitReceiptBatch(to[3:], index[3:], serviceID[3:], ibtpType[3:], results[3:], proofs[3:])
+	require.Nil(t, err)
+	require.True(t, ret.Status, ret.Message)
+
+	ret, err = c.SubmitReceiptBatch(to, index[1:], serviceID, ibtpType, results, proofs)
+	require.Nil(t, err)
+	require.False(t, ret.Status)
+	require.Contains(t, ret.Message, "size mismatch")
+}
+
+func TestGetReceiptMessage(t *testing.T) {
+	n := newTestNetwork(t)
+	c := newTestClient(t, n)
+
+	for i, function := range []string{"interchainCharge", "fail"} {
+		index := uint64(i + 1)
+		content := &pb.Content{Func: function, Args: [][]byte{[]byte("bob"), []byte("1")}}
+		sigs := n.sign(t, testRemote, testLocalService, index, pb.IBTP_INTERCHAIN,
+			append([][]byte{[]byte(content.Func)}, content.Args...), pb.TransactionStatus_BEGIN)
+		ret, err := c.SubmitIBTP(testRemote, index, testService, pb.IBTP_INTERCHAIN, content,
+			&pb.BxhProof{TxStatus: pb.TransactionStatus_BEGIN, MultiSign: sigs}, false)
+		require.Nil(t, err)
+		require.True(t, ret.Status, ret.Message)
+	}
+
+	servicePair := genServicePair(testRemote, testLocalService)
+	ibtp, err := c.GetReceiptMessage(servicePair, 1)
+	require.Nil(t, err)
+	require.Equal(t, testRemote, ibtp.From)
+	require.Equal(t, testLocalService, ibtp.To)
+	require.Equal(t, uint64(1), ibtp.Index)
+	require.Equal(t, pb.IBTP_RECEIPT_SUCCESS, ibtp.Type)
+	requireProof(t, ibtp.Proof)
+
+	payload := &pb.Payload{}
+	require.Nil(t, payload.Unmarshal(ibtp.Payload))
+	result := &pb.Result{}
+	require.Nil(t, result.Unmarshal(payload.Content))
+	// the business chaincode returns its arguments and the rollback flag
+	require.Equal(t, [][]byte{[]byte("bob"), []byte("1"), []byte("false")}, result.Data)
+
+	// the receipt of a failed call is a failure
+	ibtp, err = c.GetReceiptMessage(servicePair, 2)
+	require.Nil(t, err)
+	require.Equal(t, pb.IBTP_RECEIPT_FAILURE, ibtp.Type)
+
+	_, err = c.GetReceiptMessage(servicePair, 3)
+	require.NotNil(t, err)
+
+	ibtps, err := c.GetReceiptMessages(servicePair, 1, 2)
+	require.Nil(t, err)
+	require.Len(t, ibtps, 2)
+	for i, ibtp := range ibtps {
+		require.Equal(t, uint64(i+1), ibtp.Index, strconv.Itoa(i))
+	}
+}
+
+func TestVerifyProof(t *testing.T) {
+	n := newTestNetwork(t)
+	n.emit(t, testRemote)
+	c := newTestClient(t, n)
+
+	ibtp, err := c.GetOutMessage(genServicePair(testLocalService, testRemote), 1)
+	require.Nil(t, err)
+	requireProof(t, ibtp.Proof)
+
+	// the fake orderer does not sign its blocks
+	validator, err := queryValidator(n.fabric, testChannel, "broker", "OR('Org1MSP.member')", "OR('OrdererMSP.member')")
+	require.Nil(t, err)
+	_, err = validator.VerifyProof(ibtp.Proof)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "block is not signed")
+
+	_, err = queryValidator(n.fabric, testChannel, "broker", "OR('Org1MSP.member')", "OR(")
+	require.NotNil(t, err)
+}
+
+func TestGetMessageProof(t *testing.T) {
+	n := newTestNetwork(t)
+	n.emit(t, testRemote)
+	c := newTestClient(t, n)
+
+	response, err := n.fabric.Query(channel.Request{
+		ChaincodeID: "broker",
+		Fcn:         "getOutMessage",
+		Args:        util.ToChaincodeArgs(genServicePair(testLocalService, testRemote), "1"),
+	})
+	require.Nil(t, err)
+	event := &Event{}
+	require.Nil(t, json.Unmarshal(response.Payload, event))
+	p, err := c.getMessageProof(event.TxID, event.Migrated)
+	require.Nil(t, err)
+	requireProof(t, p)
+
+	// the transaction of a migrated message is unknown
+	_, err = c.getMessageProof(event.TxID, true)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "migrated")
+	_, err = c.getMessageProof("", false)
+	require.NotNil(t, err)
+}
+
+func TestMessagePageSize(t *testing.T) {
+	n := newTestNetwork(t)
+	for i := 0; i <= messagePageSize; i++ {
+		n.emit(t, testRemote)
+	}
+	c := newTestClient(t, n)
+
+	// a page of messagePageSize is served at once and longer ones are cut
+	outPair := genServicePair(testLocalService, testRemote)
+	ibtps, err := c.GetOutMessages(outPair, 1, messagePageSize)
+	require.Nil(t, err)
+	require.Len(t, ibtps, messagePageSize)
+	ibtps, err = c.GetOutMessages(outPair, 1, messagePageSize+1)
+	require.Nil(t, err)
+	require.Len(t, ibtps, messagePageSize)
+}
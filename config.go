@@ -1,29 +1,121 @@
 package main
 
 import (
+	"fmt"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 const (
 	ConfigName = "fabric.toml"
+
+	// BackendSDK reaches the fabric network described by config.yaml
+	BackendSDK = "sdk"
+	// BackendFake runs the broker and the sample chaincodes in memory, it is
+	// only meant for simulations
+	BackendFake = "fake"
 )
 
 type Config struct {
 	Fabric   Fabric    `toml:"fabric" json:"fabric"`
 	Services []Service `mapstructure:"services" json:"services"`
+	OffChain OffChain  `mapstructure:"offchain" json:"offchain"`
+	Retry    Retry     `mapstructure:"retry" json:"retry"`
+	Broker   Broker    `mapstructure:"broker" json:"broker"`
+	Fake     Fake      `mapstructure:"fake" json:"fake"`
 }
 type Fabric struct {
-	Name          string `toml:"name" json:"name"`
-	Username      string `toml:"username" json:"username"`
-	CCID          string `toml:"ccid" json:"ccid"`
-	ChannelId     string `mapstructure:"channel_id" toml:"channel_id" json:"channel_id"`
-	Org           string `toml:"org" json:"org"`
-	ServerPort    string `toml:"server_port" json:"server_port"`
+	Name      string `toml:"name" json:"name"`
+	Username  string `toml:"username" json:"username"`
+	CCID      string `toml:"ccid" json:"ccid"`
+	ChannelId string `mapstructure:"channel_id" toml:"channel_id" json:"channel_id"`
+	Org       string `toml:"org" json:"org"`
+	Policy    string `toml:"policy" json:"policy"`
+	// OrdererPolicy is the policy the orderers signing blocks must satisfy
+	OrdererPolicy string `mapstructure:"orderer_policy" toml:"orderer_policy" json:"orderer_policy"`
+	ServerPort    string `mapstructure:"server_port" toml:"server_port" json:"server_port"`
 	TimeoutHeight int64  `mapstructure:"timeout_height" json:"timeout_height"`
 	TimeoutPeriod uint64 `mapstructure:"timeout_period" json:"timeout_period"`
+	// EventDriven delivers ibtps from chaincode events, polling only fills gaps
+	EventDriven     bool          `mapstructure:"event_driven" json:"event_driven"`
+	PollingInterval time.Duration `mapstructure:"polling_interval" json:"polling_interval"`
+	// FetchWorkers bounds the messages fetched in parallel when catching up
+	FetchWorkers int `mapstructure:"fetch_workers" json:"fetch_workers"`
+	// Backend is BackendSDK or BackendFake
+	Backend string `mapstructure:"backend" json:"backend"`
+}
+
+type OffChain struct {
+	DataPath    string `mapstructure:"data_path" json:"data_path"`
+	ReceivePath string `mapstructure:"receive_path" json:"receive_path"`
+	MaxSize     int64  `mapstructure:"max_size" json:"max_size"`
+}
+
+// RetryPolicy decides how a failed request to fabric is retried, the wait
+// between attempts starts from Backoff and doubles up to MaxBackoff
+type RetryPolicy struct {
+	MaxAttempts uint64        `mapstructure:"max_attempts" json:"max_attempts"`
+	Backoff     time.Duration `mapstructure:"backoff" json:"backoff"`
+	MaxBackoff  time.Duration `mapstructure:"max_backoff" json:"max_backoff"`
+}
+
+type Retry struct {
+	RetryPolicy `mapstructure:",squash"`
+	// Operations overrides the policy of single operations, the fields left
+	// empty are taken from the default policy
+	Operations map[string]RetryPolicy `mapstructure:"operations" json:"operations"`
+}
+
+// Policy returns the retry policy of operation op
+func (r Retry) Policy(op string) RetryPolicy {
+	policy := r.RetryPolicy
+	if override, ok := r.Operations[op]; ok {
+		if override.MaxAttempts != 0 {
+			policy.MaxAttempts = override.MaxAttempts
+		}
+		if override.Backoff != 0 {
+			policy.Backoff = override.Backoff
+		}
+		if override.MaxBackoff != 0 {
+			policy.MaxBackoff = override.MaxBackoff
+		}
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 1
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+	return policy
+}
+
+// Broker is the setup of the broker and transaction chaincodes on fabric, the
+// broker is named by Fabric.CCID on the channel Fabric.ChannelId
+type Broker struct {
+	BxhID        string `mapstructure:"bxh_id" json:"bxh_id"`
+	AppchainID   string `mapstructure:"appchain_id" json:"appchain_id"`
+	ValThreshold uint64 `mapstructure:"val_threshold" json:"val_threshold"`
+	// Validators are the addresses of the bitxhub validators signing proofs
+	Validators          []string `mapstructure:"validators" json:"validators"`
+	TransactionContract string   `mapstructure:"transaction_contract" json:"transaction_contract"`
+}
+
+// Fake sets up the in-memory fabric of BackendFake, the broker is
+// instantiated from the Broker section
+type Fake struct {
+	// Invokes are sent once the services are registered, e.g. to emit
+	// interchain requests
+	Invokes []FakeInvoke `mapstructure:"invokes" json:"invokes"`
+}
+
+type FakeInvoke struct {
+	Chaincode string   `mapstructure:"chaincode" json:"chaincode"`
+	Func      string   `mapstructure:"func" json:"func"`
+	Args      []string `mapstructure:"args" json:"args"`
 }
 
 type Service struct {
@@ -35,18 +127,53 @@ type Service struct {
 func DefaultConfig() *Config {
 	return &Config{
 		Fabric: Fabric{
-			Name:          "fabric",
-			Username:      "Admin",
-			CCID:          "broker",
-			ChannelId:     "mychannel",
-			Org:           "org2",
-			TimeoutHeight: 30,
-			TimeoutPeriod: 60,
+			Name:            "fabric",
+			Username:        "Admin",
+			CCID:            "broker",
+			ChannelId:       "mychannel",
+			Org:             "org2",
+			OrdererPolicy:   "OR('OrdererMSP.member')",
+			TimeoutHeight:   30,
+			TimeoutPeriod:   60,
+			EventDriven:     false,
+			PollingInterval: 2 * time.Second,
+			FetchWorkers:    8,
+			Backend:         BackendSDK,
 		},
 		Services: nil,
+		OffChain: OffChain{
+			DataPath:    "offchain",
+			ReceivePath: "offchain_received",
+			MaxSize:     4 * 1024 * 1024,
+		},
+		Retry: Retry{
+			RetryPolicy: RetryPolicy{
+				MaxAttempts: 10,
+				Backoff:     time.Second,
+				MaxBackoff:  30 * time.Second,
+			},
+		},
+		Broker: Broker{
+			BxhID:               "1356",
+			AppchainID:          "fabappchain",
+			ValThreshold:        1,
+			TransactionContract: "transaction",
+		},
 	}
 }
 
+// BrokerInstantiateArgs returns the args instantiating the broker chaincode
+func (c *Config) BrokerInstantiateArgs() []string {
+	return []string{"init", c.Broker.BxhID, c.Broker.AppchainID, strconv.FormatUint(c.Broker.ValThreshold, 10),
+		strings.Join(c.Broker.Validators, ","), c.Broker.TransactionContract, c.Fabric.ChannelId}
+}
+
+// TransactionInstantiateArgs returns the args instantiating the transaction
+// chaincode
+func (c *Config) TransactionInstantiateArgs() []string {
+	return []string{"init", c.Fabric.CCID, c.Fabric.ChannelId}
+}
+
 func UnmarshalConfig(configPath string) (*Config, error) {
 	viper.SetConfigFile(filepath.Join(configPath, ConfigName))
 	viper.SetConfigType("toml")
@@ -63,6 +190,9 @@ func UnmarshalConfig(configPath string) (*Config, error) {
 	if err := viper.Unmarshal(config); err != nil {
 		return nil, err
 	}
+	if config.Fabric.PollingInterval <= 0 {
+		return nil, fmt.Errorf("polling_interval must be positive, got %s", config.Fabric.PollingInterval)
+	}
 
 	return config, nil
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnmarshalConfig(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("config", ConfigName))
+	require.Nil(t, err)
+
+	dir := t.TempDir()
+	write := func(content string) {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, ConfigName), []byte(content), 0644))
+	}
+
+	write(string(data))
+	config, err := UnmarshalConfig(dir)
+	require.Nil(t, err)
+	require.Equal(t, 2*time.Second, config.Fabric.PollingInterval)
+
+	for _, interval := range []string{"0s", "-1s"} {
+		write(strings.Replace(string(data), `polling_interval = "2s"`, `polling_interval = "`+interval+`"`, 1))
+		_, err = UnmarshalConfig(dir)
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "polling_interval must be positive")
+	}
+}
@@ -1,20 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"strconv"
+	"sync"
 
 	"github.com/hyperledger/fabric-protos-go/common"
 	"github.com/hyperledger/fabric-protos-go/peer"
 
-	"github.com/golang/protobuf/proto"
-	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
-	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
-	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
-	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/context"
 	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/meshplus/pier-client-fabric/proof"
 )
 
 type MessageHandler interface {
@@ -22,63 +21,43 @@ type MessageHandler interface {
 }
 
 type Consumer struct {
-	eventClient     *event.Client
-	meta            *ContractMeta
-	msgH            MessageHandler
-	channelProvider context.ChannelProvider
-	ChannelClient   *channel.Client
-	registration    fab.Registration
-	ctx             chan bool
+	backend      Backend
+	meta         *ContractMeta
+	msgH         MessageHandler
+	registration fab.Registration
+	configReg    fab.Registration
+	wg           sync.WaitGroup
 }
 
-func NewConsumer(configPath string, meta *ContractMeta, msgH MessageHandler, ctx chan bool) (*Consumer, error) {
-	configProvider := config.FromFile(filepath.Join(configPath, "config.yaml"))
-	sdk, err := fabsdk.New(configProvider)
-	if err != nil {
-		return nil, fmt.Errorf("create sdk fail: %s\n", err)
-	}
-
-	channelProvider := sdk.ChannelContext(meta.ChannelID, fabsdk.WithUser(meta.Username), fabsdk.WithOrg(meta.ORG))
-
-	channelClient, err := channel.New(channelProvider)
-	if err != nil {
-		return nil, fmt.Errorf("create channel fabcli fail: %s\n", err.Error())
+func NewConsumer(backend Backend, meta *ContractMeta, msgH MessageHandler) *Consumer {
+	return &Consumer{
+		backend: backend,
+		msgH:    msgH,
+		meta:    meta,
 	}
-
-	c := &Consumer{
-		msgH:            msgH,
-		ChannelClient:   channelClient,
-		channelProvider: channelProvider,
-		meta:            meta,
-		ctx:             ctx,
-	}
-
-	return c, nil
 }
 
-func (c *Consumer) Start() error {
-	var err error
-
-	ec, err := event.New(c.channelProvider, event.WithBlockEvents())
-	if err != nil {
-		return fmt.Errorf("failed to create fabcli, error: %v", err)
-	}
-	c.eventClient = ec
-	registration, notifier, err := ec.RegisterChaincodeEvent(c.meta.CCID, c.meta.EventFilter)
+// Start subscribes the blocks of the channel and hands the interchain and
+// receipt events in them to the message handler until ctx is done
+func (c *Consumer) Start(ctx context.Context) error {
+	registration, notifier, err := c.backend.RegisterBlockEvent()
 	if err != nil {
-		return fmt.Errorf("failed to register chaincode event, error: %v", err)
+		return fmt.Errorf("failed to register block event, error: %v", err)
 	}
 	c.registration = registration
 
-	// todo: add context
+	// notifier is closed once the registration is unregistered in Shutdown
+	c.wg.Add(1)
 	go func() {
+		defer c.wg.Done()
 		for {
 			select {
-			case ccEvent := <-notifier:
-				if ccEvent != nil {
-					c.handle(ccEvent)
+			case ev, ok := <-notifier:
+				if !ok {
+					return
 				}
-			case <-c.ctx:
+				c.handleBlock(ev.Block)
+			case <-ctx.Done():
 				return
 			}
 		}
@@ -86,28 +65,133 @@ func (c *Consumer) Start() error {
 	return nil
 }
 
+// RegisterConfigBlock subscribes the config blocks of the channel, the returned
+// channel is closed by Shutdown
+func (c *Consumer) RegisterConfigBlock() (<-chan *fab.BlockEvent, error) {
+	registration, notifier, err := c.backend.RegisterBlockEvent(protoutil.IsConfigBlock)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register block event, error: %v", err)
+	}
+	c.configReg = registration
+
+	return notifier, nil
+}
+
+// Shutdown unregisters the block events, waits for the blocks in handling and
+// closes the backend
 func (c *Consumer) Shutdown() error {
-	c.eventClient.Unregister(c.registration)
+	if c.registration != nil {
+		c.backend.Unregister(c.registration)
+	}
+	if c.configReg != nil {
+		c.backend.Unregister(c.configReg)
+	}
+	c.wg.Wait()
+	c.backend.Close()
 	return nil
 }
 
-func (c *Consumer) handle(deliveries *fab.CCEvent) {
-	l, err := ledger.New(c.channelProvider)
-	if err != nil {
-		return
+// handleBlock extracts chaincode events from the valid transactions of block.
+// Fabric only keeps the event of the top level chaincode, so events from every
+// chaincode are checked, but only the messages the transaction wrote to the
+// broker count.
+func (c *Consumer) handleBlock(block *common.Block) {
+	var filter []byte
+	if len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter = block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
 	}
-	t, err := l.QueryTransaction(fab.TransactionID(deliveries.TxID))
-	if err != nil {
-		return
+
+	for i, data := range block.Data.Data {
+		if i < len(filter) && peer.TxValidationCode(filter[i]) != peer.TxValidationCode_VALID {
+			continue
+		}
+		tx, err := proof.ParseEndorserTx(data)
+		if err != nil || tx == nil || len(tx.ChaincodeAction.Events) == 0 {
+			continue
+		}
+		ccEvent, err := protoutil.UnmarshalChaincodeEvents(tx.ChaincodeAction.Events)
+		if err != nil || ccEvent.EventName == "" {
+			continue
+		}
+		writes, err := proof.NamespaceWrites(tx.ChaincodeAction.Results, c.meta.CCID)
+		if err != nil || len(writes) == 0 {
+			continue
+		}
+		if err := checkEvent(ccEvent.EventName, ccEvent.Payload, writes); err != nil {
+			logger.Warn("Drop event not written by broker", "txid", tx.TxID, "error", err.Error())
+			continue
+		}
+
+		p, err := proof.New(block, i)
+		if err != nil {
+			continue
+		}
+		proofBytes, err := p.Marshal()
+		if err != nil {
+			continue
+		}
+
+		c.msgH.HandleMessage(&fab.CCEvent{
+			TxID:        tx.TxID,
+			ChaincodeID: ccEvent.ChaincodeId,
+			EventName:   ccEvent.EventName,
+			Payload:     ccEvent.Payload,
+			BlockNumber: block.Header.Number,
+		}, proofBytes)
 	}
-	pd := &common.Payload{}
-	if err := proto.Unmarshal(t.TransactionEnvelope.Payload, pd); err != nil {
-		return
+}
+
+// checkEvent makes sure the messages carried by an event are the ones the
+// transaction wrote to the broker. Any chaincode calling the broker sets the
+// event of its transaction, so the event alone proves nothing.
+func checkEvent(name string, payload []byte, writes map[string][]byte) error {
+	switch name {
+	case interchainEventName:
+		ev := &Event{}
+		if err := json.Unmarshal(payload, ev); err != nil {
+			return fmt.Errorf("unmarshal interchain event: %w", err)
+		}
+		// the broker stores the event as it emits it
+		key := compositeKey(outMsgPrefix, genServicePair(ev.SrcFullID, ev.DstFullID), strconv.FormatUint(ev.Index, 10))
+		return checkWrite(writes, key, payload)
+	case receiptEventName:
+		var events []struct {
+			From    string          `json:"from"`
+			To      string          `json:"to"`
+			Index   uint64          `json:"index"`
+			Receipt json.RawMessage `json:"receipt"`
+		}
+		if err := json.Unmarshal(payload, &events); err != nil {
+			return fmt.Errorf("unmarshal receipt event: %w", err)
+		}
+		for _, ev := range events {
+			key := compositeKey(inMsgPrefix, genServicePair(ev.From, ev.To), strconv.FormatUint(ev.Index, 10))
+			if err := checkWrite(writes, key, ev.Receipt); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown event %s", name)
+	}
+}
+
+func checkWrite(writes map[string][]byte, key string, value []byte) error {
+	written, ok := writes[key]
+	if !ok {
+		return fmt.Errorf("message %q is not written", key)
 	}
-	pt := &peer.Transaction{}
-	if err := proto.Unmarshal(pd.Data, pt); err != nil {
-		return
+	if !bytes.Equal(written, value) {
+		return fmt.Errorf("message %q differs from the written one", key)
 	}
+	return nil
+}
 
-	c.msgH.HandleMessage(deliveries, pt.Actions[0].Payload)
+// compositeKey is the key CreateCompositeKey of the chaincode shim builds
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
 }
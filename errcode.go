@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+)
+
+// codes of the errors returned by the broker chaincode, they must be kept in
+// line with example/contracts/src/broker/errors.go
+const (
+	CodeInvalidArgs           = "INVALID_ARGS"
+	CodeIndexMismatch         = "INDEX_MISMATCH"
+	CodeIndexApplied          = "INDEX_APPLIED"
+	CodeServiceNotWhitelisted = "SERVICE_NOT_WHITELISTED"
+	CodeBadSignature          = "BAD_SIGNATURE"
+	CodeCalleeFailed          = "CALLEE_FAILED"
+	CodeNotAdmin              = "NOT_ADMIN"
+	CodeInternal              = "INTERNAL"
+)
+
+// rejection returns the response of the broker carried by err when the
+// broker rejected the request. The broker fails the transaction with the
+// response as the message, so it reaches the client as a chaincode status
+// error, either alone or as one of the errors of the endorsers.
+func rejection(err error) (*Response, bool) {
+	s, ok := status.FromError(err)
+	if !ok {
+		return nil, false
+	}
+
+	switch s.Group {
+	case status.ChaincodeStatus:
+		return parseRejection(s.Message), true
+	case status.EndorserClientStatus, status.ClientStatus:
+		if status.Code(s.Code) != status.MultipleErrors {
+			return nil, false
+		}
+		for _, detail := range s.Details {
+			if e, ok := detail.(error); ok {
+				if resp, ok := rejection(e); ok {
+					return resp, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// parseRejection reads the response in msg, the peer may prefix the message
+// of the chaincode, and rejections of an outdated broker come without a code
+func parseRejection(msg string) *Response {
+	resp := &Response{}
+	start := strings.Index(msg, "{")
+	if start < 0 || json.Unmarshal([]byte(msg[start:]), resp) != nil {
+		return &Response{Code: CodeInternal, Message: msg}
+	}
+	resp.OK = false
+	if resp.Code == "" {
+		resp.Code = CodeInternal
+	}
+	return resp
+}
+
+// submitStatus tells whether pier may take a submit answered with resp as
+// done and describes the outcome. An ibtp already applied is done as well, so
+// pier does not retry it.
+func submitStatus(resp *Response) (bool, string) {
+	if resp.OK {
+		return true, resp.Message
+	}
+	if resp.Code == CodeIndexApplied {
+		return true, "already applied: " + resp.Message
+	}
+	return false, resp.Code + ": " + resp.Message
+}
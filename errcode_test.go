@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRejection(t *testing.T) {
+	for msg, want := range map[string]*Response{
+		`{"ok":false,"code":"INDEX_MISMATCH","message":"incorrect index, expect 2"}`: {Code: CodeIndexMismatch, Message: "incorrect index, expect 2"},
+		// the peer prefixes the message of the chaincode
+		`transaction returned with failure: {"ok":false,"code":"BAD_SIGNATURE","message":"0 of 1"}`: {Code: CodeBadSignature, Message: "0 of 1"},
+		// an outdated broker returns no code
+		`{"ok":false,"message":"dest address is not in local white list"}`: {Code: CodeInternal, Message: "dest address is not in local white list"},
+		"dest address is not in local white list":                          {Code: CodeInternal, Message: "dest address is not in local white list"},
+		`{"broken`: {Code: CodeInternal, Message: `{"broken`},
+	} {
+		require.Equal(t, want, parseRejection(msg), msg)
+	}
+}
+
+func TestRejection(t *testing.T) {
+	msg := `{"ok":false,"code":"INDEX_APPLIED","message":"index 1 is already applied"}`
+	chaincodeErr := status.New(status.ChaincodeStatus, 500, msg, nil)
+	connectionErr := status.New(status.EndorserClientStatus, int32(status.ConnectionFailed), "connection refused", nil)
+	multiple := func(details ...interface{}) error {
+		return status.New(status.EndorserClientStatus, int32(status.MultipleErrors), "multiple errors", details)
+	}
+
+	resp, ok := rejection(chaincodeErr)
+	require.True(t, ok)
+	require.Equal(t, &Response{Code: CodeIndexApplied, Message: "index 1 is already applied"}, resp)
+
+	// one of the endorsers rejected the request
+	resp, ok = rejection(multiple(connectionErr, chaincodeErr))
+	require.True(t, ok)
+	require.Equal(t, CodeIndexApplied, resp.Code)
+
+	for _, err := range []error{
+		fmt.Errorf("timeout"),
+		connectionErr,
+		multiple(connectionErr, connectionErr),
+		status.New(status.EventServerStatus, 11, "mvcc read conflict", nil),
+	} {
+		_, ok := rejection(err)
+		require.False(t, ok, err.Error())
+	}
+}
+
+func TestSubmitStatus(t *testing.T) {
+	for _, c := range []struct {
+		resp *Response
+		done bool
+		msg  string
+	}{
+		{&Response{OK: true, Message: "applied"}, true, "applied"},
+		{&Response{Code: CodeIndexApplied, Message: "index 1 is already applied"}, true, "already applied: index 1 is already applied"},
+		{&Response{Code: CodeIndexMismatch, Message: "incorrect index, expect 2"}, false, "INDEX_MISMATCH: incorrect index, expect 2"},
+		{&Response{Code: CodeBadSignature, Message: "0 of 1"}, false, "BAD_SIGNATURE: 0 of 1"},
+	} {
+		done, msg := submitStatus(c.resp)
+		require.Equal(t, c.done, done, c.msg)
+		require.Equal(t, c.msg, msg)
+	}
+}
@@ -8,6 +8,15 @@ import (
 	"github.com/meshplus/bitxhub-model/pb"
 )
 
+const (
+	interchainEventName = "interchain-event-name"
+	receiptEventName    = "receipt-event-name"
+
+	// prefixes of the keys the broker stores out and in messages under
+	outMsgPrefix = "out-msg"
+	inMsgPrefix  = "in-msg"
+)
+
 type Event struct {
 	Index     uint64   `json:"index"`
 	DstFullID string   `json:"dst_full_id"`
@@ -16,6 +25,9 @@ type Event struct {
 	CallFunc  CallFunc `json:"call_func"`
 	CallBack  CallFunc `json:"callback"`
 	RollBack  CallFunc `json:"rollback"`
+	TxID      string   `json:"tx_id"`
+	// Migrated marks the legacy events the broker knows no transaction of
+	Migrated bool `json:"migrated"`
 }
 
 func (ev *Event) Convert2IBTP(timeoutHeight int64, ibtpType pb.IBTP_Type) *pb.IBTP {
@@ -68,8 +80,17 @@ func (ev *Event) encryptPayload() ([]byte, error) {
 	return ibtppd.Marshal()
 }
 
+// ReceiptEvent is emitted by the broker once a receipt is recorded
+type ReceiptEvent struct {
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	Index   uint64  `json:"index"`
+	Receipt Receipt `json:"receipt"`
+}
+
 type Response struct {
 	OK      bool   `json:"ok"`
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
 	Data    []byte `json:"data"`
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/hyperledger/fabric/common/util"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,36 +17,50 @@ import (
 )
 
 const (
-	interchainEventName     = "interchain-event-name"
-	innerMeta               = "inner-meta"
-	outterMeta              = "outter-meta"
-	callbackMeta            = "callback-meta"
-	dstRollbackMeta         = "dst-rollback-meta"
-	rollbackCacheMeta       = "rollback-cache-meta"
-	localWhitelist          = "local-whitelist"
-	remoteWhitelist         = "remote-whitelist"
-	localServices           = "local-services"
-	localServiceProposal    = "local-service-proposal"
-	serviceOrderedList      = "service-ordered-list"
-	whiteList               = "white-list"
-	adminList               = "admin-list"
-	localServiceList        = "local-service-list"
-	validatorList           = "validator-list"
-	passed                  = 1
-	rejected                = 0
-	delimiter               = "&"
-	comma                   = ","
-	bxhID                   = "bxh-id"
-	appchainID              = "appchain-id"
-	adminThreshold          = "admin-threshold"
-	valThreshold            = "val-threshold"
-	outMessages             = "out-messages"
-	receiptMessages         = "receipt-messages"
-	channelID               = "mychannel"
-	transactionContractName = "transaction"
+	interchainEventName   = "interchain-event-name"
+	receiptEventName      = "receipt-event-name"
+	offChainDataEventName = "offchain-data-event-name"
+	innerMeta             = "inner-meta"
+	outterMeta            = "outter-meta"
+	callbackMeta          = "callback-meta"
+	dstRollbackMeta       = "dst-rollback-meta"
+	srcRollbackMeta       = "src-rollback-meta"
+	offChainDataMeta      = "offchain-data-meta"
+	rollbackCacheMeta     = "rollback-cache-meta"
+	localWhitelist        = "local-whitelist"
+	remoteWhitelist       = "remote-whitelist"
+	localServices         = "local-services"
+	localServiceProposal  = "local-service-proposal"
+	serviceOrderedList    = "service-ordered-list"
+	whiteList             = "white-list"
+	adminList             = "admin-list"
+	localServiceList      = "local-service-list"
+	validatorList         = "validator-list"
+	passed                = 1
+	rejected              = 0
+	delimiter             = "&"
+	comma                 = ","
+	bxhID                 = "bxh-id"
+	appchainID            = "appchain-id"
+	adminThreshold        = "admin-threshold"
+	valThreshold          = "val-threshold"
+	outMsgPrefix          = "out-msg"
+	inMsgPrefix           = "in-msg"
+	maxPageSize           = 100
+	transactionContract   = "transaction-contract"
+	transactionChannel    = "transaction-channel"
 )
 
-var admins []string
+// defaults of the settings taken by Init
+const (
+	defaultBxhID               = "1356"
+	defaultAppchainID          = "appchain1"
+	defaultValThreshold        = "1"
+	defaultTransactionContract = "transaction"
+)
+
+// counterMetas are the metas holding one index counter per service pair
+var counterMetas = []string{innerMeta, outterMeta, callbackMeta, dstRollbackMeta, srcRollbackMeta, offChainDataMeta}
 
 type Broker struct{}
 
@@ -57,20 +72,12 @@ type Event struct {
 	CallFunc  CallFunc `json:"call_func"`
 	CallBack  CallFunc `json:"callback"`
 	RollBack  CallFunc `json:"rollback"`
+	// TxID is the transaction emitting the event, the plugin builds the proof from it
+	TxID string `json:"tx_id"`
+	// Migrated marks the legacy events of unknown transactions, see migrateMessages
+	Migrated bool `json:"migrated"`
 }
 
-// type VerifyPayload struct {
-// 	Signature  string `json:"signature"`
-// 	Hash       string `json:"hash"`
-// 	Threshold  string `json:"threshold"`
-// 	Validators string `json:"validators"`
-// }
-
-// type VerifyResponse struct {
-// 	IsPass bool   `json:"is_pass"`
-// 	Data   []byte `json:"data"`
-// }
-
 type CallFunc struct {
 	Func string   `json:"func"`
 	Args [][]byte `json:"args"`
@@ -80,8 +87,10 @@ type proposal struct {
 	Approve     uint64   `json:"approve"`
 	Reject      uint64   `json:"reject"`
 	VotedAdmins []string `json:"voted_admins"`
-	Ordered     bool     `json:"ordered"`
-	Exist       bool     `json:"exist"`
+	// Votes are the votes of VotedAdmins, counted against the current admins
+	Votes   map[string]uint64 `json:"votes"`
+	Ordered bool              `json:"ordered"`
+	Exist   bool              `json:"exist"`
 }
 
 type InterchainInvoke struct {
@@ -95,6 +104,55 @@ type Receipt struct {
 	Encrypt bool        `json:"encrypt"`
 	Typ     uint64      `json:"typ"`
 	Result  pb.Response `json:"result"`
+	// TxID is the transaction recording the receipt, the plugin builds the proof from it
+	TxID string `json:"tx_id"`
+	// Migrated marks the legacy receipts of unknown transactions, see migrateMessages
+	Migrated bool `json:"migrated"`
+}
+
+// OffChainDataRequest is emitted by a local service to fetch data which is kept
+// off chain by the remote service
+type OffChainDataRequest struct {
+	Index    uint64 `json:"index"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Req      []byte `json:"req"`
+	CallBack string `json:"callback"`
+}
+
+// OffChainDataResponse only records where the plugin stored the data and the
+// hash of it, the data itself never goes on chain
+type OffChainDataResponse struct {
+	Index uint64 `json:"index"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Typ   uint64 `json:"typ"`
+	Msg   string `json:"msg"`
+	Path  string `json:"path"`
+	Hash  string `json:"hash"`
+	Size  uint64 `json:"size"`
+}
+
+// ReceiptEvent is emitted once a receipt is recorded, so the plugin does not
+// have to poll it from the ledger
+type ReceiptEvent struct {
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	Index   uint64  `json:"index"`
+	Receipt Receipt `json:"receipt"`
+}
+
+// BrokerConfig is the setup of the broker returned by getConfig
+type BrokerConfig struct {
+	BxhID               string   `json:"bxh_id"`
+	AppchainID          string   `json:"appchain_id"`
+	ValThreshold        uint64   `json:"val_threshold"`
+	Validators          []string `json:"validators"`
+	TransactionContract string   `json:"transaction_contract"`
+	TransactionChannel  string   `json:"transaction_channel"`
+	// Admins are the MSPs whose clients are admins
+	Admins         []string `json:"admins"`
+	AdminThreshold uint64   `json:"admin_threshold"`
 }
 
 type DirectTransactionMeta struct {
@@ -102,44 +160,59 @@ type DirectTransactionMeta struct {
 	TransactionStatus uint64 `json:"transaction_status"`
 }
 
+// Init takes the same arguments as initialize after the function name, e.g.
+// {"Args":["init","1356","fabappchain","1","0x...","transaction","mychannel"]}.
+// The first deploy makes the MSP of the caller the admin and sets the broker up
+// with the default ids and one validator signature required if there are no
+// arguments. An upgrade keeps the state and only sets the arguments given,
+// without the votes of admins: the upgrade is already approved under the
+// chaincode lifecycle policy of the channel, which can replace the broker
+// altogether.
 func (broker *Broker) Init(stub shim.ChaincodeStubInterface) pb.Response {
-	// initArgs := stub.GetArgs()
-	// admins := strings.Split(string(initArgs[0]), comma)
-
-	c, err := cid.New(stub)
+	admins, err := broker.getMap(stub, adminList)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("new cid: %s", err.Error()))
+		return shim.Error(err.Error())
 	}
 
-	clientID, err := c.GetMSPID()
-	if err != nil {
-		return shim.Error(fmt.Sprintf("get client id: %s", err.Error()))
-	}
+	_, args := stub.GetFunctionAndParameters()
+	if len(admins) == 0 {
+		c, err := cid.New(stub)
+		if err != nil {
+			return shim.Error(fmt.Sprintf("new cid: %s", err.Error()))
+		}
 
-	m := make(map[string]uint64)
-	m[clientID] = 1
-	// for _, admin := range admins {
-	// 	m[admin] = 1
-	// }
-	err = broker.putMap(stub, adminList, m)
-	if err != nil {
-		return shim.Error(fmt.Sprintf("Initialize admin list fail %s", err.Error()))
-	}
+		clientID, err := c.GetMSPID()
+		if err != nil {
+			return shim.Error(fmt.Sprintf("get client id: %s", err.Error()))
+		}
 
-	if err := stub.PutState(bxhID, []byte("1356")); err != nil {
-		return shim.Error(err.Error())
-	}
-	if err := stub.PutState(appchainID, []byte("appchain1")); err != nil {
-		return shim.Error(err.Error())
+		m := make(map[string]uint64)
+		m[clientID] = 1
+		err = broker.putMap(stub, adminList, m)
+		if err != nil {
+			return shim.Error(fmt.Sprintf("Initialize admin list fail %s", err.Error()))
+		}
+
+		err = broker.initMap(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		if len(args) == 0 {
+			args = []string{defaultBxhID, defaultAppchainID, defaultValThreshold}
+		}
 	}
-	if err := stub.PutState(valThreshold, []byte("1")); err != nil {
-		return shim.Error(err.Error())
+	if len(args) == 0 {
+		return shim.Success(nil)
 	}
 
-	err = broker.initMap(stub)
+	change, _, err := broker.configChange(stub, args)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err := change(); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(nil)
 }
@@ -148,11 +221,11 @@ func (broker *Broker) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	function, args := stub.GetFunctionAndParameters()
 
 	if ok := broker.checkAdmin(stub, function); !ok {
-		return shim.Error("Not allowed to invoke interchain function by non-admin client")
+		return errorResponse(codeNotAdmin, "Not allowed to invoke interchain function by non-admin client")
 	}
 
 	if ok := broker.checkWhitelist(stub, function); !ok {
-		return shim.Error("Not allowed to invoke interchain function by unregister chaincode")
+		return errorResponse(codeServiceNotWhitelisted, "Not allowed to invoke interchain function by unregister chaincode")
 	}
 
 	fmt.Printf("invoke: %s\n", function)
@@ -167,6 +240,8 @@ func (broker *Broker) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return broker.getOuterMeta(stub)
 	case "getDstRollbackMeta":
 		return broker.getDstRollbackMeta(stub)
+	case "getSrcRollbackMeta":
+		return broker.getSrcRollbackMeta(stub)
 	case "getCallbackMeta":
 		return broker.getCallbackMeta(stub)
 	case "getLocalServices":
@@ -177,22 +252,50 @@ func (broker *Broker) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return broker.getInMessage(stub, args)
 	case "getOutMessage":
 		return broker.getOutMessage(stub, args)
+	case "getInMessages":
+		return broker.getInMessages(stub, args)
+	case "getOutMessages":
+		return broker.getOutMessages(stub, args)
 	case "getList":
 		return broker.getList(stub)
 	case "pollingEvent":
 		return broker.pollingEvent(stub, args)
-	case "initialize":
-		return broker.initialize(stub, args)
+	case "getConfig":
+		return broker.getConfig(stub)
+	case "initialize", "addAdmin", "removeAdmin", "setAdminThreshold", "setValidators":
+		return broker.propose(stub, function, args)
+	case "voteProposal":
+		return broker.voteProposal(stub, args)
+	case "getPendingProposals":
+		return broker.getPendingProposals(stub)
+	case "getPendingProposal":
+		return broker.getPendingProposal(stub, args)
+	case "migrateMessages":
+		return broker.migrateMessages(stub)
+	case "migrateCounters":
+		return broker.migrateCounters(stub)
 	case "invokeInterchain":
 		return broker.invokeInterchain(stub, args)
 	case "invokeInterchains":
 		return broker.invokeInterchains(stub, args)
 	case "invokeReceipt":
 		return broker.invokeReceipt(stub, args)
+	case "invokeReceipts":
+		return broker.invokeReceipts(stub, args)
 	case "invokeIndexUpdate":
 		return broker.invokeIndexUpdate(stub, args)
 	case "EmitInterchainEvent":
 		return broker.EmitInterchainEvent(stub, args)
+	case "EmitOffChainDataRequest":
+		return broker.EmitOffChainDataRequest(stub, args)
+	case "submitOffChainData":
+		return broker.submitOffChainData(stub, args)
+	case "getOffChainDataMeta":
+		return broker.getOffChainDataMeta(stub)
+	case "getOffChainDataRequest":
+		return broker.getOffChainDataRequest(stub, args)
+	case "getOffChainDataResponse":
+		return broker.getOffChainDataResponse(stub, args)
 	case "registerAppchain":
 		return broker.registerAppchain(stub, args)
 	case "registerRemoteService":
@@ -206,63 +309,159 @@ func (broker *Broker) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 	case "getDirectTransactionMeta":
 		return broker.getDirectTransactionMeta(stub, args)
 	default:
-		return shim.Error("invalid function: " + function + ", args: " + strings.Join(args, ","))
+		return errorResponse(codeInvalidArgs, "invalid function: "+function+", args: "+strings.Join(args, ","))
 	}
 }
 
-func (broker *Broker) initialize(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	if onlyAdmin := broker.onlyAdmin(stub); !onlyAdmin {
-		return shim.Error(fmt.Sprintf("caller is not admin"))
-	}
-
-	err := broker.initMap(stub)
+// initializeChange resets the state of the broker and sets it up with args
+// like Init does, the transaction chaincode is reset as well if no validator
+// signature is required
+func (broker *Broker) initializeChange(stub shim.ChaincodeStubInterface, args []string) (func() error, error) {
+	change, threshold, err := broker.configChange(stub, args)
 	if err != nil {
-		return shim.Error(err.Error())
+		return nil, err
 	}
 
-	if len(args) != 3 {
-		return shim.Error("incorrect number of arguments, expecting 3")
+	return func() error {
+		if err := broker.initMap(stub); err != nil {
+			return err
+		}
+		if err := change(); err != nil {
+			return err
+		}
+		if threshold == 0 {
+			b := util.ToChaincodeArgs("initialize")
+			response := broker.invokeTransaction(stub, b)
+			if response.Status != shim.OK {
+				return fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message)
+			}
+		}
+		return nil
+	}, nil
+}
+
+// configChange checks the arguments of Init and initialize: the bitxhub id,
+// the appchain id and the validator threshold, then optionally the comma
+// separated addresses of bitxhub validators, the name of the transaction
+// chaincode and its channel, and returns the change persisting them along with
+// the threshold. The optional settings left out are kept. The validators are
+// checked like validatorsChange does, except that no validator may be set yet,
+// then every ibtp fails the signature check until they are.
+func (broker *Broker) configChange(stub shim.ChaincodeStubInterface, args []string) (func() error, uint64, error) {
+	if len(args) < 3 || len(args) > 6 {
+		return nil, 0, fmt.Errorf("incorrect number of arguments, expecting 3 to 6")
 	}
 
-	if err := stub.PutState(bxhID, []byte(args[0])); err != nil {
-		return shim.Error(err.Error())
+	threshold, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return nil, 0, err
 	}
-	if err := stub.PutState(appchainID, []byte(args[1])); err != nil {
-		return shim.Error(err.Error())
+	var validators []string
+	if len(args) > 3 && args[3] != "" {
+		for _, v := range strings.Split(args[3], comma) {
+			v = strings.TrimSpace(v)
+			if !isAddress(v) {
+				return nil, 0, fmt.Errorf("invalid validator address %s", v)
+			}
+			validators = append(validators, v)
+		}
+	} else {
+		validators, err = broker.getValidatorList(stub)
+		if err != nil {
+			return nil, 0, err
+		}
 	}
-	if err := stub.PutState(valThreshold, []byte(args[2])); err != nil {
-		return shim.Error(err.Error())
+	if len(validators) != 0 && threshold > uint64(len(validators)) {
+		return nil, 0, fmt.Errorf("threshold %d is out of range [0, %d]", threshold, len(validators))
 	}
 
-	threshold, err := strconv.ParseInt(args[2], 10, 64)
+	return func() error {
+		if err := stub.PutState(bxhID, []byte(args[0])); err != nil {
+			return err
+		}
+		if err := stub.PutState(appchainID, []byte(args[1])); err != nil {
+			return err
+		}
+		if err := stub.PutState(valThreshold, []byte(args[2])); err != nil {
+			return err
+		}
+		if len(args) > 3 && args[3] != "" {
+			if err := broker.setValidatorList(stub, validators); err != nil {
+				return err
+			}
+		}
+		if len(args) > 4 && args[4] != "" {
+			if err := stub.PutState(transactionContract, []byte(args[4])); err != nil {
+				return err
+			}
+		}
+		if len(args) > 5 && args[5] != "" {
+			if err := stub.PutState(transactionChannel, []byte(args[5])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, threshold, nil
+}
+
+func (broker *Broker) getConfig(stub shim.ChaincodeStubInterface) pb.Response {
+	bxhId, err := stub.GetState(bxhID)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
-	if threshold == 0 {
-		b := util.ToChaincodeArgs("initialize")
-		response := stub.InvokeChaincode(transactionContractName, b, channelID)
-		if response.Status != shim.OK {
-			return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
-		}
+	appchainId, err := stub.GetState(appchainID)
+	if err != nil {
+		return failResponse(err)
 	}
-
-	return shim.Success(nil)
+	threshold, err := broker.getValThreshold(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	validators, err := broker.getValidatorList(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	name, channel, err := broker.getTransactionContract(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	adminMap, err := broker.getMap(stub, adminList)
+	if err != nil {
+		return failResponse(err)
+	}
+	admins := make([]string, 0, len(adminMap))
+	for admin := range adminMap {
+		admins = append(admins, admin)
+	}
+	sort.Strings(admins)
+	adminThreshold, err := broker.getAdminThreshold(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+
+	config, err := json.Marshal(&BrokerConfig{
+		BxhID:               string(bxhId),
+		AppchainID:          string(appchainId),
+		ValThreshold:        threshold,
+		Validators:          validators,
+		TransactionContract: name,
+		TransactionChannel:  channel,
+		Admins:              admins,
+		AdminThreshold:      adminThreshold,
+	})
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(config)
 }
 
 func (broker *Broker) initMap(stub shim.ChaincodeStubInterface) error {
-	inCounter := make(map[string]uint64)
-	outCounter := make(map[string]uint64)
-	callbackCounter := make(map[string]uint64)
-	dstRollbackCounter := make(map[string]uint64)
 	localWhite := make(map[string]bool)
 	remoteWhite := make(map[string][]string)
 	locallProposal := make(map[string]proposal)
 	localWhiteByte, err := json.Marshal(localWhite)
-	initOutMessages := make(map[string](map[uint64]Event))
-	initReceiptMessage := make(map[string](map[uint64]Receipt))
 	serviceOrdered := make(map[string]bool)
 	rollbackCache := make(map[string][]uint64)
-	var validators []string
 	if err != nil {
 		return err
 	}
@@ -279,20 +478,10 @@ func (broker *Broker) initMap(stub shim.ChaincodeStubInterface) error {
 		return err
 	}
 
-	if err := broker.putMap(stub, innerMeta, inCounter); err != nil {
-		return err
-	}
-
-	if err := broker.putMap(stub, outterMeta, outCounter); err != nil {
-		return err
-	}
-
-	if err := broker.putMap(stub, callbackMeta, callbackCounter); err != nil {
-		return err
-	}
-
-	if err := broker.putMap(stub, dstRollbackMeta, dstRollbackCounter); err != nil {
-		return err
+	for _, metaName := range counterMetas {
+		if err := broker.resetCounters(stub, metaName); err != nil {
+			return err
+		}
 	}
 
 	rcBytes, err := json.Marshal(rollbackCache)
@@ -316,37 +505,33 @@ func (broker *Broker) initMap(stub shim.ChaincodeStubInterface) error {
 		return err
 	}
 
-	if err := broker.setAdminThreshold(stub, 1); err != nil {
-		return err
-	}
-
-	if err := broker.setOutMessages(stub, initOutMessages); err != nil {
+	// the threshold set by the admins survives initialize
+	if threshold, err := stub.GetState(adminThreshold); err != nil {
 		return err
+	} else if threshold == nil {
+		if err := broker.setAdminThreshold(stub, 1); err != nil {
+			return err
+		}
 	}
 
-	if err := broker.setReceiptMessages(stub, initReceiptMessage); err != nil {
-		return err
-	}
 	if err := stub.PutState(serviceOrderedList, serviceOrderedByte); err != nil {
 		return err
 	}
 
-	if err := broker.setValidatorList(stub, validators); err != nil {
-		return err
-	}
-
+	// the validators are left to configChange, which keeps them unless new
+	// ones are given
 	return nil
 }
 
 func (broker *Broker) EmitInterchainEvent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 8 {
-		return shim.Error("incorrect number of arguments, expecting 8")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 8")
 	}
 
 	dstServiceID := args[0]
 	threshold, err := broker.getValThreshold(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	//直连模式下校验服务和白名单
 	if threshold == 0 {
@@ -354,7 +539,7 @@ func (broker *Broker) EmitInterchainEvent(stub shim.ChaincodeStubInterface, args
 		remoteServices := broker.getRemoteServiceList(stub).Payload
 		var remoteServicesRes []string
 		if err := json.Unmarshal(remoteServices, &remoteServicesRes); err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		for _, remoteService := range remoteServicesRes {
 			if remoteService == dstServiceID {
@@ -363,17 +548,17 @@ func (broker *Broker) EmitInterchainEvent(stub shim.ChaincodeStubInterface, args
 			}
 		}
 		if !flag {
-			return shim.Error("remote service is not registered")
+			return errorResponse(codeServiceNotWhitelisted, "remote service is not registered")
 		}
 		flag = false
 		banList := broker.getRSWhiteList(stub, []string{dstServiceID}).Payload
 		var banListRes []string
 		if err := json.Unmarshal(banList, &banListRes); err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		creatorByte, err := stub.GetCreator()
 		if err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		si := &msp.SerializedIdentity{}
 		err = proto.Unmarshal(creatorByte, si)
@@ -385,124 +570,108 @@ func (broker *Broker) EmitInterchainEvent(stub shim.ChaincodeStubInterface, args
 			}
 		}
 		if flag {
-			return shim.Error("remote service is not allowed to call dest address")
+			return errorResponse(codeServiceNotWhitelisted, "remote service is not allowed to call dest address")
 		}
 	}
 
 	cid, err := getChaincodeID(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	curFullID, err := broker.genFullServiceID(stub, cid)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 
 	outServicePair := genServicePair(curFullID, dstServiceID)
 
-	outMeta, err := broker.getMap(stub, outterMeta)
+	outIndex, err := broker.getCounter(stub, outterMeta, outServicePair)
 	if err != nil {
-		return shim.Error(err.Error())
-	}
-
-	if _, ok := outMeta[outServicePair]; !ok {
-		outMeta[outServicePair] = 0
+		return failResponse(err)
 	}
+	outIndex++
 
 	isEncrypt, err := strconv.ParseBool(args[7])
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 
 	callFunc, err := generateCallFunc(args[1], args[2])
 	if err != nil {
-		return shim.Error(fmt.Sprintf("generate callFunc: %s", err.Error()))
+		return failResponse(fmt.Errorf("generate callFunc: %w", err))
 	}
 	callBack, err := generateCallFunc(args[3], args[4])
 	if err != nil {
-		return shim.Error(fmt.Sprintf("generate callBack: %s", err.Error()))
+		return failResponse(fmt.Errorf("generate callBack: %w", err))
 	}
 	rollBack, err := generateCallFunc(args[5], args[6])
 	if err != nil {
-		return shim.Error(fmt.Sprintf("generate rollBack: %s", err.Error()))
+		return failResponse(fmt.Errorf("generate rollBack: %w", err))
 	}
 
 	tx := Event{
-		Index:     outMeta[outServicePair] + 1,
+		Index:     outIndex,
 		DstFullID: dstServiceID,
 		SrcFullID: curFullID,
 		Encrypt:   isEncrypt,
 		CallFunc:  callFunc,
 		CallBack:  callBack,
 		RollBack:  rollBack,
+		TxID:      stub.GetTxID(),
 	}
 
-	outMeta[outServicePair]++
-
-	// txValue, err := json.Marshal(tx)
-	// if err != nil {
-	// 	return shim.Error(fmt.Sprintf("marshal tx value: %s", err.Error()))
-	// }
-
-	messages, err := broker.getOutMessages(stub)
+	txValue, err := json.Marshal(tx)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("get out messages: %s", err.Error()))
-	}
-	_, ok := messages[outServicePair]
-	if !ok {
-		messages[outServicePair] = make(map[uint64]Event)
-	}
-	messages[outServicePair][outMeta[outServicePair]] = tx
-	if err := broker.setOutMessages(stub, messages); err != nil {
-		return shim.Error(fmt.Sprintf("set out messages: %s", err.Error()))
+		return failResponse(fmt.Errorf("marshal tx value: %w", err))
 	}
 
 	// persist out message
-	// key := broker.outMsgKey(outServicePair, strconv.FormatUint(tx.Index, 10))
-	// if err := stub.PutState(key, txValue); err != nil {
-	// 	return shim.Error(fmt.Sprintf("outMsgKey: %s", err.Error()))
-	// }
+	if err := broker.setOutEvent(stub, outServicePair, outIndex, &tx); err != nil {
+		return failResponse(fmt.Errorf("set out message: %w", err))
+	}
 
-	// if err := stub.SetEvent(interchainEventName, txValue); err != nil {
-	// 	return shim.Error(fmt.Sprintf("set event: %s", err.Error()))
-	// }
+	// events of a called chaincode are dropped by fabric, so the event is also
+	// returned for the calling business chaincode to emit it again
+	if err := stub.SetEvent(interchainEventName, txValue); err != nil {
+		return failResponse(fmt.Errorf("set event: %w", err))
+	}
 
-	if err := broker.putMap(stub, outterMeta, outMeta); err != nil {
-		return shim.Error(fmt.Sprintf("put outterMeta: %s", err.Error()))
+	if err := broker.setCounter(stub, outterMeta, outServicePair, outIndex); err != nil {
+		return failResponse(fmt.Errorf("put outterMeta: %w", err))
 	}
 
 	//直连模式下创建并事务
 	if threshold == 0 {
-		index := strconv.Itoa(int(outMeta[outServicePair]))
+		index := strconv.FormatUint(outIndex, 10)
 		b := util.ToChaincodeArgs("startTransaction", curFullID, dstServiceID, index)
-		response := stub.InvokeChaincode(transactionContractName, b, channelID)
+		response := broker.invokeTransaction(stub, b)
 		if response.Status != shim.OK {
-			return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+			return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 		}
 	}
 
-	return shim.Success(nil)
+	return shim.Success(txValue)
 }
 
 // 业务合约通过该接口进行注册: 0表示正在审核，1表示审核通过，2表示审核失败
 func (broker *Broker) register(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	ordered, err := strconv.ParseBool(args[0])
 	if err != nil {
-		return errorResponse(fmt.Sprintf("cannot parse %s to bool", args[0]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("cannot parse %s to bool", args[0]))
 	}
 
 	localWhite, err := broker.getLocalWhiteList(stub)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("Get local white list :%s", err.Error()))
+		return failResponse(fmt.Errorf("Get local white list :%w", err))
 	}
 	localProposal, err := broker.getLocalServiceProposal(stub)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("Get local service proposal :%s", err.Error()))
+		return failResponse(fmt.Errorf("Get local service proposal :%w", err))
 	}
 
 	key, err := getChaincodeID(stub)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("get chaincode uniuqe id %s", err.Error()))
+		return failResponse(fmt.Errorf("get chaincode uniuqe id %w", err))
 	}
 
 	if localWhite[key] || localProposal[key].Exist {
@@ -520,7 +689,7 @@ func (broker *Broker) register(stub shim.ChaincodeStubInterface, args []string)
 	localProposal[key] = proposal
 	err = broker.putLocalServiceProposal(stub, localProposal)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	return shim.Success([]byte(key))
 }
@@ -532,62 +701,63 @@ func (broker *Broker) audit(stub shim.ChaincodeStubInterface, args []string) pb.
 	status := args[2]
 	st, err := strconv.ParseUint(status, 10, 64)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("can not parse uint: %s", status))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("can not parse uint: %s", status))
 	}
 
 	localProposal, err := broker.getLocalServiceProposal(stub)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("Get local service list: %s", err.Error()))
+		return failResponse(fmt.Errorf("Get local service list: %w", err))
 	}
 	creatorId, err := broker.getCreatorMspId(stub)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("Get creator id: %s", err.Error()))
+		return failResponse(fmt.Errorf("Get creator id: %w", err))
 	}
 	proposal, ok := localProposal[getKey(channel, chaincodeName)]
 	if !ok {
-		return shim.Error(fmt.Sprintf("Proposal not found"))
+		return errorResponse(codeInvalidArgs, "Proposal not found")
 	}
 
 	result, err := broker.vote(stub, &proposal, st, creatorId)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("vote proposal: %s", err.Error()))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("vote proposal: %s", err.Error()))
 	}
-	if result == 0 {
+	if result == votePending {
+		// an error would drop the vote along with the transaction
 		localProposal[getKey(channel, chaincodeName)] = proposal
 		if err := broker.putLocalServiceProposal(stub, localProposal); err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
-		return shim.Error(fmt.Sprintf("vote proposal fail"))
+		return shim.Success([]byte(fmt.Sprintf("proposal of chaincode %s is pending", getKey(channel, chaincodeName))))
 	}
 	delete(localProposal, getKey(channel, chaincodeName))
 	localProposal[getKey(channel, chaincodeName)] = proposal
 	if err := broker.putLocalServiceProposal(stub, localProposal); err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
-	if result == 1 {
+	if result == votePassed {
 		localWhite, err := broker.getLocalWhiteList(stub)
 		if err != nil {
-			return shim.Error(fmt.Sprintf("Get white list :%s", err.Error()))
+			return failResponse(fmt.Errorf("Get white list :%w", err))
 		}
 		localWhite[getKey(channel, chaincodeName)] = true
 		if err = broker.putLocalWhiteList(stub, localWhite); err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		localService, err := broker.getLocalServiceList(stub)
 		if err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		localService = append(localService, getKey(channel, chaincodeName))
 		if err := broker.putLocalServiceList(stub, localService); err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		serviceOrdered, err := broker.getServiceOrderedList(stub)
 		if err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		serviceOrdered[getKey(channel, chaincodeName)] = proposal.Ordered
 		if err = broker.putServiceOrderedList(stub, serviceOrdered); err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 	}
 
@@ -610,34 +780,50 @@ func (broker *Broker) vote(stub shim.ChaincodeStubInterface, p *proposal, status
 	}
 
 	p.VotedAdmins = append(p.VotedAdmins, mispId)
+	if p.Votes == nil {
+		p.Votes = make(map[string]uint64)
+	}
+	p.Votes[mispId] = status
 	threshold, err := broker.getAdminThreshold(stub)
 	if err != nil {
 		return 0, err
 	}
-	if status == rejected {
-		p.Reject++
-		if p.Reject == uint64(len(admins))-threshold+1 {
-			return 2, nil
+	admins, err := broker.getMap(stub, adminList)
+	if err != nil {
+		return 0, err
+	}
+	// the votes of removed admins no longer count
+	p.Approve, p.Reject = 0, 0
+	for admin, vote := range p.Votes {
+		if admins[admin] != 1 {
+			continue
 		}
-	} else {
-		p.Approve++
-		if p.Approve == threshold {
-			return 1, nil
+		if vote == passed {
+			p.Approve++
+		} else {
+			p.Reject++
 		}
 	}
+	if p.Approve >= threshold {
+		return votePassed, nil
+	}
+	// too few admins are left to approve it
+	if p.Reject+threshold > uint64(len(admins)) {
+		return voteRejected, nil
+	}
 
-	return 0, nil
+	return votePending, nil
 }
 
 // polling m(m is the out meta plugin has received)
 func (broker *Broker) pollingEvent(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	m := make(map[string]uint64)
 	if err := json.Unmarshal([]byte(args[0]), &m); err != nil {
-		return shim.Error(fmt.Errorf("unmarshal out meta: %s", err).Error())
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal out meta: %s", err.Error()))
 	}
-	outMeta, err := broker.getMap(stub, outterMeta)
+	outMeta, err := broker.getCounters(stub, outterMeta)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	events := make([]*Event, 0)
 	for method, idx := range outMeta {
@@ -646,14 +832,9 @@ func (broker *Broker) pollingEvent(stub shim.ChaincodeStubInterface, args []stri
 			startPos = 0
 		}
 		for i := startPos + 1; i <= idx; i++ {
-			eb, err := stub.GetState(broker.outMsgKey(method, strconv.FormatUint(i, 10)))
+			e, err := broker.getOutEvent(stub, method, i)
 			if err != nil {
-				fmt.Printf("get out event by key %s fail", broker.outMsgKey(method, strconv.FormatUint(i, 10)))
-				continue
-			}
-			e := &Event{}
-			if err := json.Unmarshal(eb, e); err != nil {
-				fmt.Println("unmarshal event fail")
+				fmt.Printf("get out event %s %d fail: %s\n", method, i, err.Error())
 				continue
 			}
 			events = append(events, e)
@@ -661,7 +842,7 @@ func (broker *Broker) pollingEvent(stub shim.ChaincodeStubInterface, args []stri
 	}
 	ret, err := json.Marshal(events)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	return shim.Success(ret)
 }
@@ -671,7 +852,7 @@ func (broker *Broker) updateIndex(stub shim.ChaincodeStubInterface, srcFullID, d
 
 	if reqType == 0 {
 		if err := broker.checkIndex(stub, servicePair, index, innerMeta); err != nil {
-			return fmt.Errorf("inner meta:%v", err)
+			return fmt.Errorf("inner meta:%w", err)
 		}
 
 		if err := broker.markInCounter(stub, servicePair); err != nil {
@@ -679,18 +860,18 @@ func (broker *Broker) updateIndex(stub shim.ChaincodeStubInterface, srcFullID, d
 		}
 	} else if reqType == 1 {
 		if err := broker.checkIndex(stub, servicePair, index, callbackMeta); err != nil {
-			return fmt.Errorf("callback:%v", err)
+			return fmt.Errorf("callback:%w", err)
 		}
 		if err := broker.markCallbackCounter(stub, servicePair, index); err != nil {
 			return err
 		}
 	} else if reqType == 2 {
-		meta, err := broker.getMap(stub, dstRollbackMeta)
+		counter, err := broker.getCounter(stub, dstRollbackMeta, servicePair)
 		if err != nil {
 			return err
 		}
-		if index < meta[servicePair]+1 {
-			return fmt.Errorf("incorrect dstRollback index, expect %d", meta[servicePair]+1)
+		if index < counter+1 {
+			return newError(codeIndexApplied, "incorrect dstRollback index, expect %d", counter+1)
 		}
 		if err := broker.markDstRollbackCounter(stub, servicePair, index); err != nil {
 			return err
@@ -705,14 +886,14 @@ func (broker *Broker) updateIndex(stub shim.ChaincodeStubInterface, srcFullID, d
 		// change require as callbackCounter[servicePair] + 1 <= index,
 		// then if index correct, directly update,
 		// otherwise, temporary store in rollbackCache;
-		meta, err := broker.getMap(stub, callbackMeta)
+		counter, err := broker.getCounter(stub, callbackMeta, servicePair)
 		if err != nil {
 			return err
 		}
-		if index < meta[servicePair]+1 {
-			return fmt.Errorf("incorrect index, expect param index[%d] should be larger or equal than %d", index, meta[servicePair]+1)
+		if index < counter+1 {
+			return newError(codeIndexApplied, "incorrect index, expect param index[%d] should be larger or equal than %d", index, counter+1)
 		}
-		if index == meta[servicePair]+1 {
+		if index == counter+1 {
 			if merr := broker.markCallbackCounter(stub, servicePair, index); merr != nil {
 				return merr
 			}
@@ -820,22 +1001,22 @@ type RollbackIndexError struct {
 
 func (broker *Broker) invokeIndexUpdate(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 4 {
-		return errorResponse("incorrect number of arguments, expecting 4")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 4")
 	}
 
 	srcFullID := args[0]
 	dstFullID := args[1]
 	index, err := strconv.ParseUint(args[2], 10, 64)
 	if err != nil {
-		return errorResponse(fmt.Sprintf("cannot parse %s to uint64", args[2]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("cannot parse %s to uint64", args[2]))
 	}
 	reqType, err := strconv.ParseUint(args[3], 10, 64)
 	if err != nil {
-		return errorResponse(fmt.Sprintf("cannot parse %s to uint64", args[3]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("cannot parse %s to uint64", args[3]))
 	}
 
 	if err := broker.updateIndex(stub, srcFullID, dstFullID, index, reqType); err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err)
 	}
 
 	return successResponse(nil)
@@ -844,12 +1025,12 @@ func (broker *Broker) invokeIndexUpdate(stub shim.ChaincodeStubInterface, args [
 func (broker *Broker) getChainId(stub shim.ChaincodeStubInterface) pb.Response {
 	bxhId, err := stub.GetState(bxhID)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 
 	appchainId, err := stub.GetState(appchainID)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 
 	return shim.Success([]byte(fmt.Sprintf("%s-%s", bxhId, appchainId)))
@@ -875,7 +1056,7 @@ func genServicePair(from, to string) string {
 
 func (broker *Broker) invokeInterchains(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 9 {
-		return errorResponse("incorrect number of arguments, expecting 9")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 9")
 	}
 
 	var (
@@ -891,53 +1072,54 @@ func (broker *Broker) invokeInterchains(stub shim.ChaincodeStubInterface, args [
 	)
 
 	if err := json.Unmarshal([]byte(args[0]), &srcFullID); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[0]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[0]))
 	}
 	if err := json.Unmarshal([]byte(args[1]), &index); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[1]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[1]))
 	}
 	if err := json.Unmarshal([]byte(args[2]), &targetCID); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[2]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[2]))
 	}
 	if err := json.Unmarshal([]byte(args[3]), &typ); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[3]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[3]))
 	}
 	if err := json.Unmarshal([]byte(args[4]), &callFunc); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[4]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[4]))
 	}
 	if err := json.Unmarshal([]byte(args[5]), &callArgs); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[5]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[5]))
 	}
 	if err := json.Unmarshal([]byte(args[6]), &txStatus); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[6]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[6]))
 	}
 	if err := json.Unmarshal([]byte(args[7]), &signature); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[7]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[7]))
 	}
 	if err := json.Unmarshal([]byte(args[8]), &isEncrypted); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[8]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[8]))
 	}
 
+	var events []*ReceiptEvent
 	for idx := 0; idx < len(srcFullID); idx++ {
 		serviceOrdered, err := broker.getServiceOrderedList(stub)
 		if err != nil {
-			return errorResponse(fmt.Sprintf("get service orered list failed: %s", err.Error()))
+			return errorResponse(codeInternal, fmt.Sprintf("get service orered list failed: %s", err.Error()))
 		}
 		ordered, ok := serviceOrdered[targetCID[idx]]
 		if !ok {
-			return errorResponse(fmt.Sprintf("cannot get service ordered"))
+			return errorResponse(codeServiceNotWhitelisted, fmt.Sprintf("cannot get service ordered"))
 		}
 		if ordered {
-			return errorResponse(fmt.Sprintf("dst service is not ordered"))
+			return errorResponse(codeInvalidArgs, fmt.Sprintf("dst service is not ordered"))
 		}
 
 		callArgsBytes, err := json.Marshal(callArgs[idx])
 		if err != nil {
-			return errorResponse(err.Error())
+			return failResponse(err)
 		}
 		signatureBytes, err := json.Marshal(signature[idx])
 		if err != nil {
-			return errorResponse(err.Error())
+			return failResponse(err)
 		}
 
 		var invokeArgs []string
@@ -951,71 +1133,99 @@ func (broker *Broker) invokeInterchains(stub shim.ChaincodeStubInterface, args [
 		invokeArgs = append(invokeArgs, string(signatureBytes))
 		invokeArgs = append(invokeArgs, strconv.FormatBool(isEncrypted[idx]))
 
-		resp := broker.invokeInterchain(stub, invokeArgs)
+		resp, event := broker.handleInterchain(stub, invokeArgs)
 		if resp.Status != shim.OK {
-			return errorResponse(resp.Message)
+			return resp
 		}
+		events = append(events, event)
+	}
+
+	if err := broker.setReceiptEvent(stub, events); err != nil {
+		return failResponse(err)
 	}
 
 	return shim.Success(nil)
 }
 
 func (broker *Broker) invokeInterchain(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	resp, event := broker.handleInterchain(stub, args)
+	if resp.Status != shim.OK {
+		return resp
+	}
+
+	if err := broker.setReceiptEvent(stub, []*ReceiptEvent{event}); err != nil {
+		return failResponse(err)
+	}
+
+	return resp
+}
+
+// handleInterchain executes an interchain request and records its receipt, the
+// receipt event is left to the caller since a transaction only has one event
+func (broker *Broker) handleInterchain(stub shim.ChaincodeStubInterface, args []string) (pb.Response, *ReceiptEvent) {
 	if len(args) != 9 {
-		return errorResponse("incorrect number of arguments, expecting 9")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 9"), nil
 	}
 
 	srcFullID := args[0]
 	targetCID := args[1]
 	splitedCID := strings.Split(targetCID, delimiter)
 	if len(splitedCID) != 2 {
-		return errorResponse(fmt.Sprintf("Target chaincode id %s is not valid", targetCID))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("Target chaincode id %s is not valid", targetCID)), nil
 	}
 	destAddr := getKey(splitedCID[0], splitedCID[1])
 	index, err := strconv.ParseUint(args[2], 10, 64)
 	if err != nil {
-		return errorResponse(fmt.Sprintf("invoke interchain parse index error: %v", err.Error()))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("invoke interchain parse index error: %v", err.Error())), nil
 	}
 	typ, err := strconv.ParseUint(args[3], 10, 64)
 	if err != nil {
-		return errorResponse(err.Error())
+		return errorResponse(codeInvalidArgs, err.Error()), nil
 	}
 	callFunc := args[4]
 	var callArgs [][]byte
 	if err := json.Unmarshal([]byte(args[5]), &callArgs); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal args failed for %s", args[4]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[4])), nil
 	}
 	txStatus, err := strconv.ParseUint(args[6], 10, 64)
 	if err != nil {
-		return errorResponse(fmt.Sprintf("invoke interchain parse txStatus error: %v", err.Error()))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("invoke interchain parse txStatus error: %v", err.Error())), nil
 	}
 	var signatures [][]byte
 	if err := json.Unmarshal([]byte(args[7]), &signatures); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal signatures failed for %s", args[7]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal signatures failed for %s", args[7])), nil
 	}
 	isEncrypt, err := strconv.ParseBool(args[8])
 	if err != nil {
-		return errorResponse(err.Error())
+		return errorResponse(codeInvalidArgs, err.Error()), nil
 	}
 
 	threshold, err := broker.getValThreshold(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err), nil
 	}
 
 	dstFullID, err := broker.genFullServiceID(stub, destAddr)
 	if err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err), nil
 	}
 	ServicePair := genServicePair(srcFullID, dstFullID)
 
 	if err := broker.checkService(stub, srcFullID, destAddr); err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err), nil
 	}
 
-	// if err := broker.checkInterchainMultiSigns(stub, srcFullID, dstFullID, index, typ, callFunc, callArgs, txStatus, signatures); err != nil {
-	// 	return errorResponse(err.Error())
-	// }
+	// the signatures are checked before the index, so only a request signed by
+	// bitxhub learns that its index is applied
+	if err := broker.checkInterchainMultiSigns(stub, srcFullID, dstFullID, index, typ, callFunc, callArgs, txStatus, signatures); err != nil {
+		return failResponse(err), nil
+	}
+	if txStatus == 0 {
+		// a replayed request must not run the callee again
+		if err := broker.checkIndex(stub, ServicePair, index, innerMeta); err != nil {
+			return failResponse(fmt.Errorf("inner meta:%w", err)), nil
+		}
+	}
 
 	var ccArgs [][]byte
 	var receipt Receipt
@@ -1026,7 +1236,7 @@ func (broker *Broker) invokeInterchain(stub shim.ChaincodeStubInterface, args []
 		ccArgs = append(ccArgs, []byte("false"))
 		response = stub.InvokeChaincode(splitedCID[1], ccArgs, splitedCID[0])
 		if err := broker.updateIndex(stub, srcFullID, dstFullID, index, 0); err != nil {
-			return errorResponse(err.Error())
+			return failResponse(err), nil
 		}
 		if response.Status == shim.OK {
 			typ = 1
@@ -1035,15 +1245,15 @@ func (broker *Broker) invokeInterchain(stub shim.ChaincodeStubInterface, args []
 		}
 	} else {
 		ccArgs = append(ccArgs, []byte("true"))
-		inCounter, err := broker.getMap(stub, innerMeta)
+		inCounter, err := broker.getCounter(stub, innerMeta, ServicePair)
 		if err != nil {
-			return errorResponse(fmt.Sprintf("get in counter fail"))
+			return errorResponse(codeInternal, fmt.Sprintf("get in counter fail")), nil
 		}
-		if inCounter[ServicePair] >= index {
+		if inCounter >= index {
 			response = stub.InvokeChaincode(splitedCID[1], ccArgs, splitedCID[0])
 		}
 		if err := broker.updateIndex(stub, srcFullID, dstFullID, index, 2); err != nil {
-			return errorResponse(err.Error())
+			return failResponse(err), nil
 		}
 		if threshold == 0 {
 			typ = 4
@@ -1059,50 +1269,118 @@ func (broker *Broker) invokeInterchain(stub shim.ChaincodeStubInterface, args []
 	receipt.Encrypt = isEncrypt
 	receipt.Typ = typ
 	receipt.Result = response
-	receipts, err := broker.getReceiptMessages(stub)
-	if err != nil {
-		return errorResponse(err.Error())
+	receipt.TxID = stub.GetTxID()
+	if err := broker.setReceipt(stub, ServicePair, index, &receipt); err != nil {
+		return failResponse(err), nil
 	}
-	_, ok := receipts[ServicePair]
-	if !ok {
-		receipts[ServicePair] = make(map[uint64]Receipt)
-	}
-	receipts[ServicePair][index] = receipt
-	if err := broker.setReceiptMessages(stub, receipts); err != nil {
-		return errorResponse(err.Error())
+
+	event := &ReceiptEvent{
+		From:    srcFullID,
+		To:      dstFullID,
+		Index:   index,
+		Receipt: receipt,
 	}
 
-	return successResponse(response.Payload)
+	return successResponse(response.Payload), event
+}
+
+// receiptCall is a receipt delivered by invokeReceipt or invokeReceipts
+type receiptCall struct {
+	srcFullID  string
+	dstFullID  string
+	index      uint64
+	typ        uint64
+	result     [][]byte
+	txStatus   uint64
+	signatures [][]byte
 }
 
 func (broker *Broker) invokeReceipt(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 7 {
-		return errorResponse("incorrect number of arguments, expecting 7")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 7")
 	}
-	srcAddr := args[0]
-	dstFullID := args[1]
 	index, err := strconv.ParseUint(args[2], 10, 64)
 	if err != nil {
-		return errorResponse(fmt.Sprintf("invoke receipt parse index error: %v", err.Error()))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("invoke receipt parse index error: %v", err.Error()))
+	}
+	typ, err := strconv.ParseUint(args[3], 10, 64)
+	if err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("invoke receipt parse typ error: %v", err.Error()))
 	}
-
 	var result [][]byte
 	if err := json.Unmarshal([]byte(args[4]), &result); err != nil {
-		return errorResponse(err.Error())
+		return errorResponse(codeInvalidArgs, err.Error())
 	}
 	txStatus, err := strconv.ParseUint(args[5], 10, 64)
 	if err != nil {
-		return errorResponse(fmt.Sprintf("invoke receipt parse txStatus error: %v", err.Error()))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("invoke receipt parse txStatus error: %v", err.Error()))
 	}
 	var signatures [][]byte
 	if err := json.Unmarshal([]byte(args[6]), &signatures); err != nil {
-		return errorResponse(fmt.Sprintf("unmarshal signatures failed for %s", args[6]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal signatures failed for %s", args[6]))
 	}
 
-	srcFullID, err := broker.genFullServiceID(stub, srcAddr)
+	srcFullID, err := broker.genFullServiceID(stub, args[0])
 	if err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err)
+	}
+	r := &receiptCall{
+		srcFullID:  srcFullID,
+		dstFullID:  args[1],
+		index:      index,
+		typ:        typ,
+		result:     result,
+		txStatus:   txStatus,
+		signatures: signatures,
+	}
+	if err := broker.checkReceipt(stub, r); err != nil {
+		return failResponse(err)
 	}
+
+	return broker.applyReceipt(stub, r)
+}
+
+// checkReceipt verifies the signatures and then the index of r. It writes
+// nothing, so a receipt it rejects leaves no trace in a batch.
+func (broker *Broker) checkReceipt(stub shim.ChaincodeStubInterface, r *receiptCall) error {
+	threshold, err := broker.getValThreshold(stub)
+	if err != nil {
+		return err
+	}
+	if threshold == 0 && (r.typ < 1 || r.typ > 4) {
+		return newError(codeInvalidArgs, "IBTP type is not correct in direct mode")
+	}
+	if err := broker.checkReceiptMultiSigns(stub, r.srcFullID, r.dstFullID, r.index, r.typ, r.result, r.txStatus, r.signatures); err != nil {
+		return err
+	}
+
+	// the same checks as updateIndex makes before it moves the counters
+	servicePair := genServicePair(r.srcFullID, r.dstFullID)
+	switch {
+	case threshold == 0 && r.typ == 4:
+		// the transaction chaincode tells whether the rollback ends
+		return nil
+	case threshold == 0 && r.typ == 3:
+		counter, err := broker.getCounter(stub, callbackMeta, servicePair)
+		if err != nil {
+			return err
+		}
+		if r.index < counter+1 {
+			return newError(codeIndexApplied, "incorrect index, expect param index[%d] should be larger or equal than %d", r.index, counter+1)
+		}
+		return nil
+	default:
+		if err := broker.checkIndex(stub, servicePair, r.index, callbackMeta); err != nil {
+			return fmt.Errorf("callback:%w", err)
+		}
+		return nil
+	}
+}
+
+// applyReceipt ends the interchain tx of r checked by checkReceipt and calls
+// back the source service
+func (broker *Broker) applyReceipt(stub shim.ChaincodeStubInterface, r *receiptCall) pb.Response {
+	srcFullID, dstFullID, index, typ, result, txStatus := r.srcFullID, r.dstFullID, r.index, r.typ, r.result, r.txStatus
 	isRollback := false
 	// validators, err := broker.getValidatorList(stub)
 	// if err != nil {
@@ -1117,52 +1395,45 @@ func (broker *Broker) invokeReceipt(stub shim.ChaincodeStubInterface, args []str
 	// 	}
 	// } else {
 
-	typ, err := strconv.ParseUint(args[3], 10, 64)
-	if err != nil {
-		return errorResponse(fmt.Sprintf("invoke receipt parse typ error: %v", err.Error()))
-	}
 	threshold, err := broker.getValThreshold(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	//直连模式下决定事务结果
 	if threshold == 0 {
 		indexStr := strconv.Itoa(int(index))
-		if typ != 1 && typ != 2 && typ != 3 && typ != 4 {
-			return errorResponse("IBTP type is not correct in direct mode")
-		}
 		if typ == 1 {
 			b := util.ToChaincodeArgs("endTransactionSuccess", srcFullID, dstFullID, indexStr)
-			response := stub.InvokeChaincode(transactionContractName, b, channelID)
+			response := broker.invokeTransaction(stub, b)
 			if response.Status != shim.OK {
-				return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+				return errorResponse(codeCalleeFailed, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 			}
 		}
 		if typ == 2 {
 			isRollback = true
 			b := util.ToChaincodeArgs("endTransactionFail", srcFullID, dstFullID, indexStr)
-			response := stub.InvokeChaincode(transactionContractName, b, channelID)
+			response := broker.invokeTransaction(stub, b)
 			if response.Status != shim.OK {
-				return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+				return errorResponse(codeCalleeFailed, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 			}
 		}
 		if typ == 3 {
 			isRollback = true
 			b := util.ToChaincodeArgs("rollbackTransaction", srcFullID, dstFullID, indexStr)
-			response := stub.InvokeChaincode(transactionContractName, b, channelID)
+			response := broker.invokeTransaction(stub, b)
 			if response.Status != shim.OK {
-				return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+				return errorResponse(codeCalleeFailed, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 			}
 		}
 		if typ == 4 {
 			b := util.ToChaincodeArgs("endTransactionRollback", srcFullID, dstFullID, indexStr)
-			response := stub.InvokeChaincode(transactionContractName, b, channelID)
+			response := broker.invokeTransaction(stub, b)
 			if response.Status != shim.OK {
-				return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+				return errorResponse(codeCalleeFailed, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 			}
 			err = broker.updateIndex(stub, srcFullID, dstFullID, index, 4)
 			if err != nil {
-				return errorResponse(err.Error())
+				return failResponse(err)
 			}
 			return successResponse([]byte{})
 		}
@@ -1181,73 +1452,156 @@ func (broker *Broker) invokeReceipt(stub shim.ChaincodeStubInterface, args []str
 	}
 
 	if err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err)
 	}
-	// err = broker.checkReceiptMultiSigns(stub, srcFullID, dstFullID, index, typ, result, txStatus, signatures)
-	// if err != nil {
-	// 	return errorResponse(err.Error())
-	// }
 
 	outServicePair := genServicePair(srcFullID, dstFullID)
-	messages, err := broker.getOutMessages(stub)
-	if err != nil {
-		return errorResponse(err.Error())
+	if isRollback {
+		if err := broker.markSrcRollbackCounter(stub, outServicePair, index); err != nil {
+			return failResponse(err)
+		}
 	}
-	_, ok := messages[outServicePair]
-	if !ok {
-		messages[outServicePair] = make(map[uint64]Event)
+	message, err := broker.getOutEvent(stub, outServicePair, index)
+	if err != nil {
+		return failResponse(err)
 	}
 	var funcArgs [][]byte
 	if isRollback {
-		invokeFunc := messages[outServicePair][index].RollBack
+		invokeFunc := message.RollBack
 		funcArgs = append(funcArgs, []byte(invokeFunc.Func))
 		funcArgs = append(funcArgs, invokeFunc.Args...)
 	} else {
-		invokeFunc := messages[outServicePair][index].CallBack
+		invokeFunc := message.CallBack
 		funcArgs = append(funcArgs, []byte(invokeFunc.Func))
 		funcArgs = append(funcArgs, invokeFunc.Args...)
 		funcArgs = append(funcArgs, result...)
 	}
 
 	//TODO 空的callBack也会走这里？
-	cid := strings.Split(messages[outServicePair][index].SrcFullID, ":")
+	cid := strings.Split(message.SrcFullID, ":")
 	splitedCID := strings.Split(cid[2], delimiter)
 	if len(splitedCID) != 2 {
-		return errorResponse(fmt.Sprintf("Target chaincode id %s is not valid", splitedCID[1]))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("Target chaincode id %s is not valid", splitedCID[1]))
 	}
 	response := stub.InvokeChaincode(splitedCID[1], funcArgs, splitedCID[0])
 
 	return successResponse(response.Payload)
 }
 
+// invokeReceipts handles a batch of receipts in one transaction. The result of
+// each item is returned as a JSON array in the same order as the input. A
+// receipt rejected by checkReceipt has written nothing and only fails its
+// item, while a receipt failing after its checks fails the whole transaction,
+// so that no half applied receipt is committed.
+func (broker *Broker) invokeReceipts(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 7 {
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 7")
+	}
+
+	var (
+		srcAddr   []string
+		dstFullID []string
+		index     []uint64
+		typ       []uint64
+		result    [][][]byte
+		txStatus  []uint64
+		signature [][][]byte
+	)
+
+	if err := json.Unmarshal([]byte(args[0]), &srcAddr); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[0]))
+	}
+	if err := json.Unmarshal([]byte(args[1]), &dstFullID); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[1]))
+	}
+	if err := json.Unmarshal([]byte(args[2]), &index); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[2]))
+	}
+	if err := json.Unmarshal([]byte(args[3]), &typ); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[3]))
+	}
+	if err := json.Unmarshal([]byte(args[4]), &result); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[4]))
+	}
+	if err := json.Unmarshal([]byte(args[5]), &txStatus); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[5]))
+	}
+	if err := json.Unmarshal([]byte(args[6]), &signature); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("unmarshal args failed for %s", args[6]))
+	}
+
+	size := len(srcAddr)
+	if len(dstFullID) != size || len(index) != size || len(typ) != size || len(result) != size || len(txStatus) != size || len(signature) != size {
+		return errorResponse(codeInvalidArgs, "incorrect length of batch arguments")
+	}
+
+	// fabric does not show the writes of a transaction to its own reads, the
+	// batchStub does, so that the receipts of one service pair see the
+	// counters moved by the receipts before them
+	batch := newBatchStub(stub)
+	results := make([]*response, 0, size)
+	for idx := 0; idx < size; idx++ {
+		srcFullID, err := broker.genFullServiceID(stub, srcAddr[idx])
+		if err != nil {
+			return failResponse(err)
+		}
+		r := &receiptCall{
+			srcFullID:  srcFullID,
+			dstFullID:  dstFullID[idx],
+			index:      index[idx],
+			typ:        typ[idx],
+			result:     result[idx],
+			txStatus:   txStatus[idx],
+			signatures: signature[idx],
+		}
+		if err := broker.checkReceipt(batch, r); err != nil {
+			results = append(results, parseResponse(failResponse(err)))
+			continue
+		}
+
+		res := parseResponse(broker.applyReceipt(batch, r))
+		if !res.OK {
+			return errorResponse(res.Code, fmt.Sprintf("receipt %d of the batch: %s", idx, res.Message))
+		}
+		results = append(results, res)
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return failResponse(err)
+	}
+
+	return successResponse(data)
+}
+
 func (broker *Broker) registerAppchain(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 4 {
-		return shim.Error("incorrect number of arguments, expecting 4")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 4")
 	}
 	chainId := args[0]
 	brokerName := args[1]
 	ruleAddress := args[2]
 	trustRoot := args[3]
 	b := util.ToChaincodeArgs("registerAppchain", chainId, brokerName, ruleAddress, trustRoot)
-	response := stub.InvokeChaincode(transactionContractName, b, channelID)
+	response := broker.invokeTransaction(stub, b)
 	if response.Status != shim.OK {
-		return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+		return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 	}
 	return shim.Success(response.Payload)
 }
 
 func (broker *Broker) registerRemoteService(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 3 {
-		return shim.Error("incorrect number of arguments, expecting 3")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 3")
 	}
 	chainId := args[0]
 	serviceId := args[1]
 	//whiteList for transaction
 	whiteList2 := args[2]
 	b := util.ToChaincodeArgs("registerRemoteService", chainId, serviceId, whiteList2)
-	response := stub.InvokeChaincode(transactionContractName, b, channelID)
+	response := broker.invokeTransaction(stub, b)
 	if response.Status != shim.OK {
-		return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+		return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 	}
 	return shim.Success(nil)
 
@@ -1255,53 +1609,53 @@ func (broker *Broker) registerRemoteService(stub shim.ChaincodeStubInterface, ar
 
 func (broker *Broker) getAppchainInfo(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
-		return shim.Error("incorrect number of arguments, expecting 1")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 1")
 	}
 	chainId := args[0]
 	b := util.ToChaincodeArgs("getAppchainInfo", chainId)
-	response := stub.InvokeChaincode(transactionContractName, b, channelID)
+	response := broker.invokeTransaction(stub, b)
 	if response.Status != shim.OK {
-		return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+		return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 	}
 	return shim.Success(response.Payload)
 }
 
 func (broker *Broker) getRemoteServiceList(stub shim.ChaincodeStubInterface) pb.Response {
 	b := util.ToChaincodeArgs("getRemoteServiceList")
-	response := stub.InvokeChaincode(transactionContractName, b, channelID)
+	response := broker.invokeTransaction(stub, b)
 	if response.Status != shim.OK {
-		return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+		return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 	}
 	return shim.Success(response.Payload)
 }
 
 func (broker *Broker) getRSWhiteList(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
-		return shim.Error("incorrect number of arguments, expecting 1")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 1")
 	}
 	remoteAddr := args[0]
 	b := util.ToChaincodeArgs("getRSWhiteList", remoteAddr)
-	response := stub.InvokeChaincode(transactionContractName, b, channelID)
+	response := broker.invokeTransaction(stub, b)
 	if response.Status != shim.OK {
-		return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+		return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 	}
 	return shim.Success(response.Payload)
 }
 
 func (broker *Broker) getDirectTransactionMeta(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 1 {
-		return shim.Error("incorrect number of arguments, expecting 1")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 1")
 	}
 	id := args[0]
 	b := util.ToChaincodeArgs("getStartTimestamp", id)
-	response := stub.InvokeChaincode(transactionContractName, b, channelID)
+	response := broker.invokeTransaction(stub, b)
 	if response.Status != shim.OK {
-		return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+		return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 	}
 	b = util.ToChaincodeArgs("getTransactionStatus", id)
-	response2 := stub.InvokeChaincode(transactionContractName, b, channelID)
+	response2 := broker.invokeTransaction(stub, b)
 	if response2.Status != shim.OK {
-		return shim.Error(fmt.Errorf("invoke transaction chaincode: %d - %s", response.Status, response.Message).Error())
+		return errorResponse(codeInternal, fmt.Sprintf("invoke transaction chaincode: %d - %s", response.Status, response.Message))
 	}
 	startTimestamp := int64(binary.BigEndian.Uint64(response.Payload))
 	transactionStatus := binary.BigEndian.Uint64(response2.Payload)
@@ -1312,90 +1666,86 @@ func (broker *Broker) getDirectTransactionMeta(stub shim.ChaincodeStubInterface,
 	}
 	directTransactionMetaBytes, err := json.Marshal(directTransactionMeta)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	return shim.Success(directTransactionMetaBytes)
 
 }
 
-// func (broker *Broker) checkInterchainMultiSigns(stub shim.ChaincodeStubInterface, srcFullID, dstFullID string, index uint64, typ uint64, callFunc string, args [][]byte, txStatus uint64, multiSignatures [][]byte) error {
-// 	threshold, err := broker.getAdminThreshold(stub)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	if threshold == 0 {
-// 		return nil
-// 	}
-
-// 	var funcPacked, packed []byte
-
-// 	packed = append(packed, []byte(srcFullID)...)
-// 	packed = append(packed, []byte(dstFullID)...)
-// 	packed = append(packed, uint64ToBytesInBigEndian(index)...)
-// 	packed = append(packed, uint64ToBytesInBigEndian(typ)...)
-// 	funcPacked = append(funcPacked, []byte(callFunc)...)
-// 	for _, arg := range args {
-// 		funcPacked = append(funcPacked, arg...)
-// 	}
-
-// 	packed = append(packed, crypto.Keccak256(funcPacked)...)
-// 	packed = append(packed, uint64ToBytesInBigEndian(txStatus)...)
-// 	hash := crypto.Keccak256(packed)
-
-// 	if broker.checkMultiSigns(stub, hash, multiSignatures) {
-// 		return fmt.Errorf("verify multi signatures failed")
-// 	}
-
-// 	return nil
-// }
-
-// func (broker *Broker) checkReceiptMultiSigns(stub shim.ChaincodeStubInterface, srcFullID, dstFullID string, index uint64, typ uint64, result [][]byte, txStatus uint64, multiSignatures [][]byte) error {
-// 	threshold, err := broker.getAdminThreshold(stub)
-// 	if err != nil {
-// 		return err
-// 	}
-// 	if threshold == 0 {
-// 		return nil
-// 	}
-
-// 	var funcPacked, packed []byte
-
-// 	packed = append(packed, []byte(srcFullID)...)
-// 	packed = append(packed, []byte(dstFullID)...)
-// 	packed = append(packed, uint64ToBytesInBigEndian(index)...)
-// 	packed = append(packed, uint64ToBytesInBigEndian(typ)...)
-
-// 	if typ == 0 && txStatus == 3 {
-// 		outServicePair := genServicePair(srcFullID, dstFullID)
-// 		messages, err := broker.getOutMessages(stub)
-// 		if err != nil {
-// 			return err
-// 		}
-// 		_, ok := messages[outServicePair]
-// 		if !ok {
-// 			messages[outServicePair] = make(map[uint64]Event)
-// 		}
-// 		callFunc := messages[outServicePair][index].CallFunc
-// 		funcPacked = append(funcPacked, []byte(callFunc.Func)...)
-// 		for _, arg := range callFunc.Args {
-// 			funcPacked = append(funcPacked, arg...)
-// 		}
-// 	} else {
-// 		for _, res := range result {
-// 			funcPacked = append(funcPacked, res...)
-// 		}
-// 	}
-// 	packed = append(packed, crypto.Keccak256(funcPacked)...)
-// 	packed = append(packed, uint64ToBytesInBigEndian(txStatus)...)
-
-// 	hash := crypto.Keccak256(packed)
-
-// 	if broker.checkMultiSigns(stub, hash, multiSignatures) {
-// 		return fmt.Errorf("verify multi signatures failed")
-// 	}
-
-// 	return nil
-// }
+func (broker *Broker) checkInterchainMultiSigns(stub shim.ChaincodeStubInterface, srcFullID, dstFullID string, index uint64, typ uint64, callFunc string, args [][]byte, txStatus uint64, multiSignatures [][]byte) error {
+	threshold, err := broker.getValThreshold(stub)
+	if err != nil {
+		return err
+	}
+	if threshold == 0 {
+		return nil
+	}
+
+	var funcPacked, packed []byte
+
+	packed = append(packed, []byte(srcFullID)...)
+	packed = append(packed, []byte(dstFullID)...)
+	packed = append(packed, uint64ToBytesInBigEndian(index)...)
+	packed = append(packed, uint64ToBytesInBigEndian(typ)...)
+	funcPacked = append(funcPacked, []byte(callFunc)...)
+	for _, arg := range args {
+		funcPacked = append(funcPacked, arg...)
+	}
+
+	packed = append(packed, keccak256(funcPacked)...)
+	packed = append(packed, uint64ToBytesInBigEndian(txStatus)...)
+	hash := keccak256(packed)
+
+	if err := broker.checkMultiSigns(stub, hash, multiSignatures); err != nil {
+		return newError(codeBadSignature, "verify multi signatures: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (broker *Broker) checkReceiptMultiSigns(stub shim.ChaincodeStubInterface, srcFullID, dstFullID string, index uint64, typ uint64, result [][]byte, txStatus uint64, multiSignatures [][]byte) error {
+	threshold, err := broker.getValThreshold(stub)
+	if err != nil {
+		return err
+	}
+	if threshold == 0 {
+		return nil
+	}
+
+	var funcPacked, packed []byte
+
+	packed = append(packed, []byte(srcFullID)...)
+	packed = append(packed, []byte(dstFullID)...)
+	packed = append(packed, uint64ToBytesInBigEndian(index)...)
+	packed = append(packed, uint64ToBytesInBigEndian(typ)...)
+
+	if typ == 0 && txStatus == 3 {
+		outServicePair := genServicePair(srcFullID, dstFullID)
+		message, err := broker.getOutEvent(stub, outServicePair, index)
+		if err != nil {
+			return err
+		}
+		callFunc := message.CallFunc
+		funcPacked = append(funcPacked, []byte(callFunc.Func)...)
+		for _, arg := range callFunc.Args {
+			funcPacked = append(funcPacked, arg...)
+		}
+	} else {
+		for _, res := range result {
+			funcPacked = append(funcPacked, res...)
+		}
+	}
+	packed = append(packed, keccak256(funcPacked)...)
+	packed = append(packed, uint64ToBytesInBigEndian(txStatus)...)
+
+	hash := keccak256(packed)
+
+	if err := broker.checkMultiSigns(stub, hash, multiSignatures); err != nil {
+		return newError(codeBadSignature, "verify multi signatures: %s", err.Error())
+	}
+
+	return nil
+}
 
 func (broker *Broker) checkService(stub shim.ChaincodeStubInterface, remoteService, destAddr string) error {
 	// threshold, err := broker.getValThreshold(stub)
@@ -1412,7 +1762,7 @@ func (broker *Broker) checkService(stub shim.ChaincodeStubInterface, remoteServi
 			return err
 		}
 		if !localWhite[destAddr] {
-			return fmt.Errorf("dest address is not in local white list")
+			return newError(codeServiceNotWhitelisted, "dest address is not in local white list")
 		}
 	}
 	if threshold == 0 {
@@ -1429,7 +1779,7 @@ func (broker *Broker) checkService(stub shim.ChaincodeStubInterface, remoteServi
 			}
 		}
 		if !flag {
-			return fmt.Errorf("remote service is not registered")
+			return newError(codeServiceNotWhitelisted, "remote service is not registered")
 		}
 		flag = false
 		banList := broker.getRSWhiteList(stub, []string{destAddr}).Payload
@@ -1451,7 +1801,7 @@ func (broker *Broker) checkService(stub shim.ChaincodeStubInterface, remoteServi
 			}
 		}
 		if flag {
-			return fmt.Errorf("remote service is not allowed to call dest address")
+			return newError(codeServiceNotWhitelisted, "remote service is not allowed to call dest address")
 		}
 	}
 
@@ -1462,51 +1812,6 @@ func (broker *Broker) checkService(stub shim.ChaincodeStubInterface, remoteServi
 	return nil
 }
 
-func (broker *Broker) checkMultiSigns(stub shim.ChaincodeStubInterface, hash []byte, multiSignatures [][]byte) bool {
-	// vList, err := broker.getValidatorList(stub)
-	// if err != nil {
-	// 	return false
-	// }
-
-	// threshold, err := broker.getValThreshold(stub)
-	// if err != nil {
-	// 	return false
-	// }
-
-	// signatures, err := json.Marshal(multiSignatures)
-	// if err != nil {
-	// 	return false
-	// }
-	// validators, err := json.Marshal(vList)
-	// if err != nil {
-	// 	return false
-	// }
-
-	// verifyPayload := &VerifyPayload{
-	// 	Signature:  string(signatures),
-	// 	Hash:       string(hash),
-	// 	Threshold:  strconv.FormatUint(threshold, 10),
-	// 	Validators: string(validators),
-	// }
-
-	// data, err := json.Marshal(verifyPayload)
-	// if err != nil {
-	// 	return false
-	// }
-
-	// resp, err := httpPost(url, data)
-	// if err != nil {
-	// 	return false
-	// }
-
-	// res := &VerifyResponse{}
-	// if err := json.Unmarshal(resp, res); err != nil {
-	// 	return false
-	// }
-	// return res.IsPass
-	return true
-}
-
 func uint64ToBytesInBigEndian(i uint64) []byte {
 	bytes := make([]byte, 8)
 
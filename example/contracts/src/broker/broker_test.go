@@ -0,0 +1,946 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/meshplus/broker/internal/data_swapper"
+	"github.com/meshplus/broker/internal/transaction"
+	"github.com/meshplus/broker/internal/transfer"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	channelID       = "mychannel"
+	testBxhID       = "1356"
+	testAppchainID  = "fabappchain"
+	transferService = channelID + delimiter + "transfer"
+	swapperService  = channelID + delimiter + "data_swapper"
+	// remoteService is a service of another appchain of the relay
+	remoteService = "1356:chain2:mychannel&transfer"
+	// directService is the service of the appchain registered in direct mode,
+	// which the transaction chaincode names without a bitxhub id
+	directService = ":chain2:mychannel&transfer"
+	bannedMSP     = "Org2MSP"
+	hvmListType   = "java.util.List<java.lang.String>"
+)
+
+// types of ibtp
+const (
+	ibtpInterchain uint64 = iota
+	ibtpReceiptSuccess
+	ibtpReceiptFailure
+	ibtpReceiptRollback
+	ibtpReceiptRollbackEnd
+)
+
+// status of the interchain transaction on bitxhub
+const (
+	txBegin uint64 = iota
+	txBeginFailure
+	txBeginRollback
+	txSuccess
+	txFailure
+)
+
+// network is a mock peer running the broker, transaction, transfer and
+// data_swapper chaincodes, with transfer and data_swapper audited
+type network struct {
+	*mockPeer
+	validator *btcec.PrivateKey
+}
+
+func newNetwork(t *testing.T) *network {
+	n := &network{mockPeer: newMockPeer(t)}
+	n.deploy("broker", new(Broker))
+	n.deploy(defaultTransactionContract, new(transaction.Transaction))
+	n.deploy("transfer", new(transfer.Transfer))
+	n.deploy("data_swapper", new(dataswapper.DataSwapper))
+	return n
+}
+
+// newRelayNetwork returns a network where one bitxhub validator signs the
+// interchain requests
+func newRelayNetwork(t *testing.T) *network {
+	n := newNetwork(t)
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	require.Nil(t, err)
+	n.validator = key
+	address := "0x" + hex.EncodeToString(keccak256(key.PubKey().SerializeUncompressed()[1:])[12:])
+
+	requireOK(t, n.invoke("broker", "initialize", testBxhID, testAppchainID, "1", address))
+	n.registerServices(t)
+	return n
+}
+
+// newDirectNetwork returns a network connected to chain2 without a relay,
+// clients of bannedMSP may not call the service of chain2
+func newDirectNetwork(t *testing.T) *network {
+	n := newNetwork(t)
+	requireOK(t, n.invoke("broker", "initialize", testBxhID, testAppchainID, "0"))
+	requireOK(t, n.invoke("broker", "registerAppchain", "chain2", "broker", "rule", "root"))
+	requireOK(t, n.invoke("broker", "registerRemoteService", "chain2", transferService, bannedMSP))
+	n.registerServices(t)
+	return n
+}
+
+func (n *network) registerServices(t *testing.T) {
+	for _, name := range []string{"transfer", "data_swapper"} {
+		requireOK(t, n.invoke(name, "register", "false"))
+		requireOK(t, n.invoke("broker", "audit", channelID, name, "1"))
+	}
+}
+
+// sign signs the message the broker checks for an ibtp, content is the called
+// function with its arguments or the results of a receipt
+func (n *network) sign(t *testing.T, from, to string, index, typ uint64, content [][]byte, txStatus uint64) [][]byte {
+	var packed, contentPacked []byte
+	packed = append(packed, []byte(from)...)
+	packed = append(packed, []byte(to)...)
+	packed = append(packed, bigEndian(index)...)
+	packed = append(packed, bigEndian(typ)...)
+	for _, c := range content {
+		contentPacked = append(contentPacked, c...)
+	}
+	packed = append(packed, keccak256(contentPacked)...)
+	packed = append(packed, bigEndian(txStatus)...)
+
+	sig, err := btcec.SignCompact(btcec.S256(), n.validator, keccak256(packed), false)
+	require.Nil(t, err)
+	// btcec puts the recovery id first, bitxhub puts it last without the offset
+	return [][]byte{append(sig[1:], sig[0]-27)}
+}
+
+// invokeInterchain delivers the request index from the remote service from
+// to the local service to
+func (n *network) invokeInterchain(t *testing.T, from, to string, index uint64, callFunc string, args [][]byte, txStatus uint64, sigs [][]byte) pb.Response {
+	argsBytes, err := json.Marshal(args)
+	require.Nil(t, err)
+	sigsBytes, err := json.Marshal(sigs)
+	require.Nil(t, err)
+
+	return n.invoke("broker", "invokeInterchain", from, to, strconv.FormatUint(index, 10),
+		strconv.FormatUint(ibtpInterchain, 10), callFunc, string(argsBytes),
+		strconv.FormatUint(txStatus, 10), string(sigsBytes), "false")
+}
+
+// signedInterchain delivers a request signed by the validator
+func (n *network) signedInterchain(t *testing.T, from, to string, index uint64, callFunc string, args [][]byte, txStatus uint64) pb.Response {
+	content := append([][]byte{[]byte(callFunc)}, args...)
+	sigs := n.sign(t, from, fullID(to), index, ibtpInterchain, content, txStatus)
+	return n.invokeInterchain(t, from, to, index, callFunc, args, txStatus, sigs)
+}
+
+// invokeReceipt delivers the receipt of the request index sent by the local
+// service from to the remote service to
+func (n *network) invokeReceipt(t *testing.T, from, to string, index, typ uint64, result [][]byte, txStatus uint64, sigs [][]byte) pb.Response {
+	resultBytes, err := json.Marshal(result)
+	require.Nil(t, err)
+	sigsBytes, err := json.Marshal(sigs)
+	require.Nil(t, err)
+
+	return n.invoke("broker", "invokeReceipt", from, to, strconv.FormatUint(index, 10),
+		strconv.FormatUint(typ, 10), string(resultBytes), strconv.FormatUint(txStatus, 10), string(sigsBytes))
+}
+
+// signedReceipt delivers a receipt signed by the validator
+func (n *network) signedReceipt(t *testing.T, from, to string, index, typ uint64, result [][]byte, txStatus uint64) pb.Response {
+	sigs := n.sign(t, fullID(from), to, index, typ, result, txStatus)
+	return n.invokeReceipt(t, from, to, index, typ, result, txStatus, sigs)
+}
+
+// batchReceipt is an item of invokeReceipts
+type batchReceipt struct {
+	index    uint64
+	typ      uint64
+	result   [][]byte
+	txStatus uint64
+	sigs     [][]byte
+}
+
+// invokeReceipts delivers the receipts of the requests sent by the local
+// service from to the remote service to in one batch
+func (n *network) invokeReceipts(t *testing.T, from, to string, receipts []batchReceipt) []*response {
+	var (
+		srcAddr   []string
+		dstFullID []string
+		index     []uint64
+		typ       []uint64
+		result    [][][]byte
+		txStatus  []uint64
+		sigs      [][][]byte
+	)
+	for _, r := range receipts {
+		srcAddr = append(srcAddr, from)
+		dstFullID = append(dstFullID, to)
+		index = append(index, r.index)
+		typ = append(typ, r.typ)
+		result = append(result, r.result)
+		txStatus = append(txStatus, r.txStatus)
+		sigs = append(sigs, r.sigs)
+	}
+	var args []string
+	for _, arg := range []interface{}{srcAddr, dstFullID, index, typ, result, txStatus, sigs} {
+		data, err := json.Marshal(arg)
+		require.Nil(t, err)
+		args = append(args, string(data))
+	}
+
+	resp := n.invoke("broker", append([]string{"invokeReceipts"}, args...)...)
+	requireOK(t, resp)
+	var results []*response
+	require.Nil(t, json.Unmarshal(parseResponse(resp).Data, &results))
+	require.Len(t, results, len(receipts))
+	return results
+}
+
+// transferBill issues the lading bill and sends it to dst
+func (n *network) transferBill(t *testing.T, mspID, dst, bill string) pb.Response {
+	requireOK(t, n.invokeAs(mspID, "transfer", "issueLadingBillCrossParams", ladingBill(bill)))
+	return n.invokeAs(mspID, "transfer", "transferLadingBillCrossParams", dst, bill)
+}
+
+// billStatus returns the cross chain status of bill kept by transfer
+func (n *network) billStatus(t *testing.T, bill string) string {
+	resp := n.invoke("transfer", "queryCrossChainStatus", bill)
+	requireOK(t, resp)
+	return string(resp.Payload)
+}
+
+// counters returns the counters kept by the broker in meta
+func (n *network) counters(t *testing.T, meta string) map[string]uint64 {
+	resp := n.invoke("broker", meta)
+	requireOK(t, resp)
+	counters := make(map[string]uint64)
+	require.Nil(t, json.Unmarshal(resp.Payload, &counters))
+	return counters
+}
+
+func (n *network) outMessage(t *testing.T, servicePair string, index uint64) *Event {
+	resp := n.invoke("broker", "getOutMessage", servicePair, strconv.FormatUint(index, 10))
+	requireOK(t, resp)
+	event := &Event{}
+	require.Nil(t, json.Unmarshal(resp.Payload, event))
+	return event
+}
+
+func (n *network) inMessage(t *testing.T, servicePair string, index uint64) *Receipt {
+	resp := n.invoke("broker", "getInMessage", servicePair, strconv.FormatUint(index, 10))
+	requireOK(t, resp)
+	receipt := &Receipt{}
+	require.Nil(t, json.Unmarshal(resp.Payload, receipt))
+	return receipt
+}
+
+// transactionStatus returns the status of the direct transaction of index
+func (n *network) transactionStatus(t *testing.T, from, to string, index uint64) uint64 {
+	id := from + "-" + to + "-" + strconv.FormatUint(index, 10)
+	resp := n.invoke("broker", "getDirectTransactionMeta", id)
+	requireOK(t, resp)
+	meta := &DirectTransactionMeta{}
+	require.Nil(t, json.Unmarshal(resp.Payload, meta))
+	return meta.TransactionStatus
+}
+
+func fullID(service string) string {
+	return testBxhID + ":" + testAppchainID + ":" + service
+}
+
+func ladingBill(bill string) string {
+	return `{"ladingBillCR":{"tdbh":"` + bill + `"}}`
+}
+
+// ladingBillArgs are the arguments of ladingBillCrossChainCall receiving bill
+func ladingBillArgs(t *testing.T, bill string) [][]byte {
+	params, err := json.Marshal([]string{ladingBill(bill)})
+	require.Nil(t, err)
+	return [][]byte{[]byte(hvmListType), params}
+}
+
+func bigEndian(i uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return b
+}
+
+func requireOK(t *testing.T, resp pb.Response) {
+	t.Helper()
+	require.Equal(t, int32(shim.OK), resp.Status, resp.Message)
+}
+
+func requireCode(t *testing.T, resp pb.Response, code string) {
+	t.Helper()
+	require.NotEqual(t, int32(shim.OK), resp.Status)
+	require.Equal(t, code, parseResponse(resp).Code, resp.Message)
+}
+
+func TestConfig(t *testing.T) {
+	p := newMockPeer(t)
+	p.deploy("broker", new(Broker))
+	require.Equal(t, BrokerConfig{
+		BxhID:               defaultBxhID,
+		AppchainID:          defaultAppchainID,
+		ValThreshold:        1,
+		TransactionContract: defaultTransactionContract,
+		TransactionChannel:  channelID,
+		Admins:              []string{adminMSP},
+		AdminThreshold:      1,
+	}, brokerConfig(t, p, "broker"))
+
+	// the chaincodes find each other under other names
+	p = newMockPeer(t)
+	p.deploy("tx", new(transaction.Transaction), "init", "relay-broker", channelID)
+	p.deploy("relay-broker", new(Broker), "init", testBxhID, testAppchainID, "0", "", "tx", channelID)
+	require.Equal(t, BrokerConfig{
+		BxhID:               testBxhID,
+		AppchainID:          testAppchainID,
+		ValThreshold:        0,
+		TransactionContract: "tx",
+		TransactionChannel:  channelID,
+		Admins:              []string{adminMSP},
+		AdminThreshold:      1,
+	}, brokerConfig(t, p, "relay-broker"))
+
+	resp := p.invoke("tx", "getConfig")
+	requireOK(t, resp)
+	config := &transaction.TransactionConfig{}
+	require.Nil(t, json.Unmarshal(resp.Payload, config))
+	require.Equal(t, &transaction.TransactionConfig{BrokerContract: "relay-broker", BrokerChannel: channelID}, config)
+
+	// initialize keeps the transaction chaincode it is not given
+	requireOK(t, p.invoke("relay-broker", "initialize", testBxhID, "chain1", "0"))
+	require.Equal(t, "tx", brokerConfig(t, p, "relay-broker").TransactionContract)
+	requireOK(t, p.invoke("relay-broker", "registerAppchain", "chain2", "broker", "rule", "root"))
+	resp = p.invoke("relay-broker", "getAppchainInfo", "chain2")
+	requireOK(t, resp)
+
+	require.NotEqual(t, int32(shim.OK), p.invoke("relay-broker", "initialize", testBxhID).Status)
+
+	// the validators are checked before any setting is stored
+	address := "0x" + strings.Repeat("ab", 20)
+	for _, args := range [][]string{
+		{"init", testBxhID, "chain3", "1", "0x1234"},
+		{"init", testBxhID, "chain3", "1", "0x" + strings.Repeat("00", 20)},
+		{"init", testBxhID, "chain3", "1", address + ",abab"},
+		{"init", testBxhID, "chain3", "2", address},
+	} {
+		require.NotEqual(t, int32(shim.OK), p.upgrade("relay-broker", args...).Status, args)
+	}
+	require.Equal(t, "chain1", brokerConfig(t, p, "relay-broker").AppchainID)
+	requireOK(t, p.upgrade("relay-broker", "init", testBxhID, "chain3", "1", address))
+	require.Equal(t, []string{address}, brokerConfig(t, p, "relay-broker").Validators)
+	// the threshold is checked against the validators kept
+	require.NotEqual(t, int32(shim.OK), p.upgrade("relay-broker", "init", testBxhID, "chain3", "2").Status)
+}
+
+// brokerConfig returns the config of the broker deployed on p as name
+func brokerConfig(t *testing.T, p *mockPeer, name string) BrokerConfig {
+	resp := p.invoke(name, "getConfig")
+	requireOK(t, resp)
+	config := BrokerConfig{}
+	require.Nil(t, json.Unmarshal(resp.Payload, &config))
+	return config
+}
+
+func TestGovernance(t *testing.T) {
+	n := newRelayNetwork(t)
+	const (
+		org2 = "Org2MSP"
+		org3 = "Org3MSP"
+		org4 = "Org4MSP"
+	)
+
+	// a single admin passes proposals at once
+	requireCode(t, n.invokeAs(org2, "broker", "addAdmin", org2), codeNotAdmin)
+	requireProposal(t, n.invoke("broker", "addAdmin", org2), "passed")
+	requireProposal(t, n.invoke("broker", "setAdminThreshold", "2"), "passed")
+	requireCode(t, n.invoke("broker", "addAdmin", org2), codeInvalidArgs)
+	requireCode(t, n.invoke("broker", "setAdminThreshold", "3"), codeInvalidArgs)
+
+	// then a second admin has to approve them
+	requireProposal(t, n.invoke("broker", "addAdmin", org3), "pending")
+	pending := pendingProposals(t, n)
+	require.Len(t, pending, 1)
+	id := pending[0].ID
+	require.Equal(t, "addAdmin", pending[0].Func)
+	require.Equal(t, []string{org3}, pending[0].Args)
+	require.Equal(t, []string{adminMSP}, pending[0].VotedAdmins)
+	requireCode(t, n.invoke("broker", "addAdmin", org3), codeInvalidArgs)
+	requireCode(t, n.invoke("broker", "voteProposal", id, "1"), codeInvalidArgs)
+	requireCode(t, n.invokeAs(org2, "broker", "voteProposal", "unknown", "1"), codeInvalidArgs)
+	requireProposal(t, n.invokeAs(org2, "broker", "voteProposal", id, "1"), "passed")
+	require.Empty(t, pendingProposals(t, n))
+	require.Equal(t, []string{adminMSP, org2, org3}, brokerConfig(t, n.mockPeer, "broker").Admins)
+
+	// two of three admins rejecting leaves too few to pass it
+	requireProposal(t, n.invoke("broker", "removeAdmin", org3), "pending")
+	id = pendingProposals(t, n)[0].ID
+	resp := n.invoke("broker", "getPendingProposal", id)
+	requireOK(t, resp)
+	requireProposal(t, n.invokeAs(org2, "broker", "voteProposal", id, "0"), "pending")
+	requireProposal(t, n.invokeAs(org3, "broker", "voteProposal", id, "0"), "rejected")
+	require.Empty(t, pendingProposals(t, n))
+	require.Equal(t, []string{adminMSP, org2, org3}, brokerConfig(t, n.mockPeer, "broker").Admins)
+	requireCode(t, n.invoke("broker", "getPendingProposal", id), codeInvalidArgs)
+
+	// admins can not be removed below the threshold
+	requireProposal(t, n.invokeAs(org3, "broker", "addAdmin", org4), "pending")
+	requireProposal(t, n.invoke("broker", "removeAdmin", org3), "pending")
+	requireProposal(t, n.invokeAs(org2, "broker", "removeAdmin", org3), "passed")
+	// the vote of a removed admin no longer counts
+	id = proposalID("addAdmin", []string{org4})
+	requireProposal(t, n.invoke("broker", "voteProposal", id, "1"), "pending")
+	requireProposal(t, n.invokeAs(org2, "broker", "voteProposal", id, "0"), "rejected")
+	requireCode(t, n.invokeAs(org3, "broker", "removeAdmin", org2), codeNotAdmin)
+	requireCode(t, n.invoke("broker", "removeAdmin", org2), codeInvalidArgs)
+	require.Equal(t, []string{adminMSP, org2}, brokerConfig(t, n.mockPeer, "broker").Admins)
+	requireCode(t, n.invoke("broker", "setAdminThreshold", "3"), codeInvalidArgs)
+
+	// the validators rotate once both admins agree
+	key, err := btcec.NewPrivateKey(btcec.S256())
+	require.Nil(t, err)
+	address := "0x" + hex.EncodeToString(keccak256(key.PubKey().SerializeUncompressed()[1:])[12:])
+	requireCode(t, n.invoke("broker", "setValidators", "0x1234", "1"), codeInvalidArgs)
+	requireProposal(t, n.invoke("broker", "setValidators", address, "1"), "pending")
+	require.NotEqual(t, []string{address}, brokerConfig(t, n.mockPeer, "broker").Validators)
+	requireProposal(t, n.invokeAs(org2, "broker", "setValidators", address, "1"), "passed")
+	require.Equal(t, []string{address}, brokerConfig(t, n.mockPeer, "broker").Validators)
+
+	// an upgrade keeps the admins
+	requireOK(t, n.upgrade("broker", "init"))
+	config := brokerConfig(t, n.mockPeer, "broker")
+	require.Equal(t, []string{adminMSP, org2}, config.Admins)
+	require.Equal(t, []string{address}, config.Validators)
+
+	// initialize is a proposal too and keeps the admin threshold
+	requireProposal(t, n.invoke("broker", "initialize", testBxhID, "chain1", "1"), "pending")
+	require.Equal(t, testAppchainID, brokerConfig(t, n.mockPeer, "broker").AppchainID)
+	requireProposal(t, n.invokeAs(org2, "broker", "initialize", testBxhID, "chain1", "1"), "passed")
+	config = brokerConfig(t, n.mockPeer, "broker")
+	require.Equal(t, "chain1", config.AppchainID)
+	require.Equal(t, uint64(2), config.AdminThreshold)
+	require.Equal(t, []string{address}, config.Validators)
+
+	// the args of an upgrade override the config without votes, the upgrade
+	// itself is governed by the lifecycle policy of the channel
+	requireOK(t, n.upgrade("broker", "init", testBxhID, "chain2", "0"))
+	config = brokerConfig(t, n.mockPeer, "broker")
+	require.Equal(t, "chain2", config.AppchainID)
+	require.Equal(t, uint64(0), config.ValThreshold)
+	require.Equal(t, []string{address}, config.Validators)
+	require.Empty(t, pendingProposals(t, n))
+}
+
+func TestAuditVotes(t *testing.T) {
+	n := newRelayNetwork(t)
+	n.deploy("data_swapper2", new(dataswapper.DataSwapper))
+	n.deploy("data_swapper3", new(dataswapper.DataSwapper))
+	requireOK(t, n.invoke("data_swapper2", "register", "false"))
+	requireOK(t, n.invoke("data_swapper3", "register", "false"))
+
+	// a single admin rejects a service
+	requireOK(t, n.invoke("broker", "audit", channelID, "data_swapper3", "0"))
+	resp := n.invoke("data_swapper3", "get", remoteService, "key")
+	require.NotEqual(t, int32(shim.OK), resp.Status)
+	require.Contains(t, resp.Message, codeServiceNotWhitelisted)
+
+	// the votes of a pending audit are kept
+	requireProposal(t, n.invoke("broker", "addAdmin", bannedMSP), "passed")
+	requireProposal(t, n.invoke("broker", "setAdminThreshold", "2"), "passed")
+	resp = n.invoke("broker", "audit", channelID, "data_swapper2", "1")
+	requireOK(t, resp)
+	require.Contains(t, string(resp.Payload), "pending")
+	requireOK(t, n.invokeAs(bannedMSP, "broker", "audit", channelID, "data_swapper2", "1"))
+	requireOK(t, n.invoke("data_swapper2", "get", remoteService, "key"))
+}
+
+// requireProposal checks that resp reports a proposal in state
+func requireProposal(t *testing.T, resp pb.Response, state string) {
+	t.Helper()
+	requireOK(t, resp)
+	require.True(t, strings.HasSuffix(string(resp.Payload), "is "+state), string(resp.Payload))
+}
+
+func pendingProposals(t *testing.T, n *network) []*GovernanceProposal {
+	resp := n.invoke("broker", "getPendingProposals")
+	requireOK(t, resp)
+	var proposals []*GovernanceProposal
+	require.Nil(t, json.Unmarshal(resp.Payload, &proposals))
+	return proposals
+}
+
+func TestRegisterAndAudit(t *testing.T) {
+	n := newNetwork(t)
+	requireOK(t, n.invoke("broker", "initialize", testBxhID, testAppchainID, "1"))
+
+	// a service may not emit requests until it is audited
+	requireOK(t, n.invoke("transfer", "register", "false"))
+	resp := n.transferBill(t, adminMSP, remoteService, "TD1")
+	require.NotEqual(t, int32(shim.OK), resp.Status)
+	require.Contains(t, resp.Message, codeServiceNotWhitelisted)
+
+	requireCode(t, n.invokeAs(bannedMSP, "broker", "audit", channelID, "transfer", "1"), codeNotAdmin)
+	require.NotEqual(t, int32(shim.OK), n.invoke("broker", "audit", channelID, "unknown", "1").Status)
+	requireOK(t, n.invoke("broker", "audit", channelID, "transfer", "1"))
+
+	resp = n.invoke("broker", "getLocalServices")
+	requireOK(t, resp)
+	var services []string
+	require.Nil(t, json.Unmarshal(resp.Payload, &services))
+	require.Equal(t, []string{fullID(transferService)}, services)
+
+	// registering again keeps the audited service
+	resp = n.invoke("transfer", "register", "false")
+	requireOK(t, resp)
+	require.Equal(t, transferService, string(resp.Payload))
+	requireOK(t, n.transferBill(t, adminMSP, remoteService, "TD1"))
+}
+
+func TestEmitInterchainEvent(t *testing.T) {
+	n := newRelayNetwork(t)
+	outPair := genServicePair(fullID(swapperService), remoteService)
+
+	for i := uint64(1); i <= 3; i++ {
+		requireOK(t, n.invoke("data_swapper", "get", remoteService, "key"+strconv.FormatUint(i, 10)))
+
+		// the business chaincode emits the event returned by the broker
+		require.NotNil(t, n.event)
+		require.Equal(t, interchainEventName, n.event.EventName)
+		event := &Event{}
+		require.Nil(t, json.Unmarshal(n.event.Payload, event))
+		require.Equal(t, i, event.Index)
+		require.Equal(t, fullID(swapperService), event.SrcFullID)
+		require.Equal(t, remoteService, event.DstFullID)
+		require.Equal(t, "interchainGet", event.CallFunc.Func)
+		require.Equal(t, "interchainSet", event.CallBack.Func)
+		require.NotEmpty(t, event.TxID)
+
+		require.Equal(t, event, n.outMessage(t, outPair, i))
+	}
+	require.Equal(t, map[string]uint64{outPair: 3}, n.counters(t, "getOuterMeta"))
+
+	resp := n.invoke("broker", "getOutMessages", outPair, "2", "5")
+	require.NotEqual(t, int32(shim.OK), resp.Status)
+	resp = n.invoke("broker", "getOutMessages", outPair, "2", "3")
+	requireOK(t, resp)
+	var events []*Event
+	require.Nil(t, json.Unmarshal(resp.Payload, &events))
+	require.Len(t, events, 2)
+	require.Equal(t, uint64(2), events[0].Index)
+
+	// polling returns the events after the given indexes
+	resp = n.invoke("broker", "pollingEvent", `{"`+outPair+`":1}`)
+	requireOK(t, resp)
+	require.Nil(t, json.Unmarshal(resp.Payload, &events))
+	require.Len(t, events, 2)
+	resp = n.invoke("broker", "pollingEvent", "{}")
+	requireOK(t, resp)
+	require.Nil(t, json.Unmarshal(resp.Payload, &events))
+	require.Len(t, events, 3)
+}
+
+func TestErrorCodes(t *testing.T) {
+	n := newRelayNetwork(t)
+	outPair := genServicePair(fullID(swapperService), remoteService)
+
+	requireCode(t, n.invoke("broker", "unknown"), codeInvalidArgs)
+	requireCode(t, n.invoke("broker", "pollingEvent", "{"), codeInvalidArgs)
+	requireCode(t, n.invoke("broker", "getOutMessage", outPair, "first"), codeInvalidArgs)
+	requireCode(t, n.invoke("broker", "registerAppchain", "chain2"), codeInvalidArgs)
+	requireCode(t, n.invoke("broker", "audit", channelID, "unknown", "1"), codeInvalidArgs)
+	requireCode(t, n.invoke("broker", "EmitInterchainEvent", remoteService), codeServiceNotWhitelisted)
+}
+
+func TestInvokeInterchain(t *testing.T) {
+	n := newRelayNetwork(t)
+	requireOK(t, n.invoke("data_swapper", "set", "key", "value"))
+	inPair := genServicePair(remoteService, fullID(swapperService))
+	args := [][]byte{[]byte("key")}
+
+	resp := n.signedInterchain(t, remoteService, swapperService, 1, "interchainGet", args, txBegin)
+	requireOK(t, resp)
+	require.Equal(t, []byte("value"), parseResponse(resp).Data)
+	require.NotNil(t, n.event)
+	require.Equal(t, receiptEventName, n.event.EventName)
+	var events []*ReceiptEvent
+	require.Nil(t, json.Unmarshal(n.event.Payload, &events))
+	require.Len(t, events, 1)
+	require.Equal(t, uint64(1), events[0].Index)
+
+	require.Equal(t, map[string]uint64{inPair: 1}, n.counters(t, "getInnerMeta"))
+	receipt := n.inMessage(t, inPair, 1)
+	require.Equal(t, ibtpReceiptSuccess, receipt.Typ)
+	require.Equal(t, []byte("value"), receipt.Result.Payload)
+	require.NotEmpty(t, receipt.TxID)
+	require.Equal(t, *receipt, events[0].Receipt)
+
+	t.Run("index applied", func(t *testing.T) {
+		requireCode(t, n.signedInterchain(t, remoteService, swapperService, 1, "interchainGet", args, txBegin), codeIndexApplied)
+		// the plugin takes an applied index as done, only a signed replay gets it
+		requireCode(t, n.invokeInterchain(t, remoteService, swapperService, 1, "interchainGet", args, txBegin, nil), codeBadSignature)
+	})
+
+	t.Run("index mismatch", func(t *testing.T) {
+		requireCode(t, n.signedInterchain(t, remoteService, swapperService, 3, "interchainGet", args, txBegin), codeIndexMismatch)
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		requireCode(t, n.invokeInterchain(t, remoteService, swapperService, 2, "interchainGet", args, txBegin, nil), codeBadSignature)
+		// signed for another request
+		sigs := n.sign(t, remoteService, fullID(swapperService), 3, ibtpInterchain, append([][]byte{[]byte("interchainGet")}, args...), txBegin)
+		requireCode(t, n.invokeInterchain(t, remoteService, swapperService, 2, "interchainGet", args, txBegin, sigs), codeBadSignature)
+	})
+
+	t.Run("service not whitelisted", func(t *testing.T) {
+		requireCode(t, n.signedInterchain(t, remoteService, channelID+delimiter+"unknown", 1, "interchainGet", args, txBegin), codeServiceNotWhitelisted)
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		requireCode(t, n.signedInterchain(t, remoteService, "data_swapper", 2, "interchainGet", args, txBegin), codeInvalidArgs)
+	})
+
+	t.Run("not admin", func(t *testing.T) {
+		resp := n.invokeAs(bannedMSP, "broker", "invokeInterchain", remoteService, swapperService, "2", "0", "interchainGet", `[]`, "0", `[]`, "false")
+		requireCode(t, resp, codeNotAdmin)
+	})
+
+	// none of the rejected requests moved the index
+	require.Equal(t, map[string]uint64{inPair: 1}, n.counters(t, "getInnerMeta"))
+
+	t.Run("callee failed", func(t *testing.T) {
+		requireOK(t, n.signedInterchain(t, remoteService, swapperService, 2, "unknown", args, txBegin))
+		require.Equal(t, ibtpReceiptFailure, n.inMessage(t, inPair, 2).Typ)
+	})
+
+	t.Run("business chaincode", func(t *testing.T) {
+		resp := n.signedInterchain(t, remoteService, transferService, 1, "ladingBillCrossChainCall", ladingBillArgs(t, "TD1"), txBegin)
+		requireOK(t, resp)
+		require.Equal(t, "receipt sent", n.billStatus(t, "TD1"))
+		require.Equal(t, ibtpReceiptSuccess, n.inMessage(t, genServicePair(remoteService, fullID(transferService)), 1).Typ)
+	})
+}
+
+func TestInvokeInterchainRollback(t *testing.T) {
+	n := newRelayNetwork(t)
+	inPair := genServicePair(remoteService, fullID(transferService))
+
+	// the request was applied, bitxhub rolls it back after the source failed
+	requireOK(t, n.signedInterchain(t, remoteService, transferService, 1, "ladingBillCrossChainCall", ladingBillArgs(t, "TD1"), txBegin))
+	requireOK(t, n.signedInterchain(t, remoteService, transferService, 1, "ladingBillCrossChainCall", ladingBillArgs(t, "TD1"), txBeginRollback))
+	require.Equal(t, ibtpReceiptRollback, n.inMessage(t, inPair, 1).Typ)
+	require.Equal(t, map[string]uint64{inPair: 1}, n.counters(t, "getDstRollbackMeta"))
+	require.Equal(t, map[string]uint64{inPair: 1}, n.counters(t, "getInnerMeta"))
+
+	requireCode(t, n.signedInterchain(t, remoteService, transferService, 1, "ladingBillCrossChainCall", ladingBillArgs(t, "TD1"), txBeginRollback), codeIndexApplied)
+
+	// the request failed on bitxhub before reaching the appchain, so the
+	// callee is not called and the in index moves on
+	requireOK(t, n.signedInterchain(t, remoteService, transferService, 2, "ladingBillCrossChainCall", ladingBillArgs(t, "TD2"), txBeginFailure))
+	require.Equal(t, ibtpReceiptFailure, n.inMessage(t, inPair, 2).Typ)
+	require.Equal(t, "not found", n.billStatus(t, "TD2"))
+	require.Equal(t, map[string]uint64{inPair: 2}, n.counters(t, "getDstRollbackMeta"))
+	require.Equal(t, map[string]uint64{inPair: 2}, n.counters(t, "getInnerMeta"))
+}
+
+func TestInvokeReceipt(t *testing.T) {
+	n := newRelayNetwork(t)
+	outPair := genServicePair(fullID(swapperService), remoteService)
+	for i := 1; i <= 2; i++ {
+		requireOK(t, n.invoke("data_swapper", "get", remoteService, "key"+strconv.Itoa(i)))
+	}
+	result := [][]byte{[]byte("value1")}
+
+	resp := n.signedReceipt(t, swapperService, remoteService, 1, ibtpReceiptSuccess, result, txSuccess)
+	requireOK(t, resp)
+	// the callback stores the value got from the remote service
+	resp = n.invoke("data_swapper", "get", "key1")
+	requireOK(t, resp)
+	require.Equal(t, "value1", string(resp.Payload))
+	require.Equal(t, map[string]uint64{outPair: 1}, n.counters(t, "getCallbackMeta"))
+
+	t.Run("index applied", func(t *testing.T) {
+		requireCode(t, n.signedReceipt(t, swapperService, remoteService, 1, ibtpReceiptSuccess, result, txSuccess), codeIndexApplied)
+	})
+
+	t.Run("index mismatch", func(t *testing.T) {
+		requireCode(t, n.signedReceipt(t, swapperService, remoteService, 3, ibtpReceiptSuccess, result, txSuccess), codeIndexMismatch)
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		requireCode(t, n.invokeReceipt(t, swapperService, remoteService, 2, ibtpReceiptSuccess, result, txSuccess, nil), codeBadSignature)
+		sigs := n.sign(t, fullID(swapperService), remoteService, 2, ibtpReceiptSuccess, [][]byte{[]byte("other")}, txSuccess)
+		requireCode(t, n.invokeReceipt(t, swapperService, remoteService, 2, ibtpReceiptSuccess, result, txSuccess, sigs), codeBadSignature)
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		requireCode(t, n.invoke("broker", "invokeReceipt", swapperService, remoteService, "two", "1", "[]", "3", "[]"), codeInvalidArgs)
+	})
+
+	require.Equal(t, map[string]uint64{outPair: 1}, n.counters(t, "getCallbackMeta"))
+
+	// bitxhub may return the interchain ibtp itself once the request succeeded,
+	// it is signed over the request instead of the results
+	t.Run("interchain type", func(t *testing.T) {
+		content := [][]byte{[]byte("interchainGet"), []byte("key2")}
+		sigs := n.sign(t, fullID(swapperService), remoteService, 2, ibtpInterchain, content, txSuccess)
+		requireOK(t, n.invokeReceipt(t, swapperService, remoteService, 2, ibtpInterchain, [][]byte{[]byte("value2")}, txSuccess, sigs))
+		resp := n.invoke("data_swapper", "get", "key2")
+		requireOK(t, resp)
+		require.Equal(t, "value2", string(resp.Payload))
+	})
+}
+
+func TestInvokeReceiptRollback(t *testing.T) {
+	n := newRelayNetwork(t)
+	outPair := genServicePair(fullID(transferService), remoteService)
+	requireOK(t, n.transferBill(t, adminMSP, remoteService, "TD1"))
+	requireOK(t, n.transferBill(t, adminMSP, remoteService, "TD2"))
+	require.Equal(t, "forward", n.billStatus(t, "TD1"))
+
+	// the request failed on the remote chain, the bill is rolled back
+	requireOK(t, n.signedReceipt(t, transferService, remoteService, 1, ibtpReceiptFailure, nil, txFailure))
+	require.Equal(t, "rollback", n.billStatus(t, "TD1"))
+	require.Equal(t, map[string]uint64{outPair: 1}, n.counters(t, "getSrcRollbackMeta"))
+	require.Equal(t, map[string]uint64{outPair: 1}, n.counters(t, "getCallbackMeta"))
+
+	// the bill is unfrozen, so it can be sent again
+	requireOK(t, n.invoke("transfer", "transferLadingBillCrossParams", remoteService, "TD1"))
+
+	requireOK(t, n.signedReceipt(t, transferService, remoteService, 2, ibtpReceiptSuccess, nil, txSuccess))
+	require.Equal(t, "receipt received", n.billStatus(t, "TD2"))
+	require.Equal(t, map[string]uint64{outPair: 1}, n.counters(t, "getSrcRollbackMeta"))
+	require.Equal(t, map[string]uint64{outPair: 2}, n.counters(t, "getCallbackMeta"))
+}
+
+func TestInvokeReceipts(t *testing.T) {
+	n := newRelayNetwork(t)
+	from := fullID(swapperService)
+	outPair := genServicePair(from, remoteService)
+	for i := 1; i <= 2; i++ {
+		requireOK(t, n.invoke("data_swapper", "get", remoteService, "key"+strconv.Itoa(i)))
+	}
+	signed := func(index, typ uint64, result [][]byte, txStatus uint64) batchReceipt {
+		return batchReceipt{
+			index:    index,
+			typ:      typ,
+			result:   result,
+			txStatus: txStatus,
+			sigs:     n.sign(t, from, remoteService, index, typ, result, txStatus),
+		}
+	}
+
+	// a receipt with a bad signature fails alone and writes nothing, the
+	// receipts of one service pair see the counters moved before them
+	results := n.invokeReceipts(t, swapperService, remoteService, []batchReceipt{
+		signed(1, ibtpReceiptSuccess, [][]byte{[]byte("value1")}, txSuccess),
+		{index: 2, typ: ibtpReceiptFailure, txStatus: txFailure},
+		signed(2, ibtpReceiptSuccess, [][]byte{[]byte("value2")}, txSuccess),
+	})
+	require.True(t, results[0].OK)
+	require.Equal(t, codeBadSignature, results[1].Code)
+	require.True(t, results[2].OK)
+	require.Equal(t, map[string]uint64{outPair: 2}, n.counters(t, "getCallbackMeta"))
+	require.Empty(t, n.counters(t, "getSrcRollbackMeta"))
+	for i := 1; i <= 2; i++ {
+		resp := n.invoke("data_swapper", "get", "key"+strconv.Itoa(i))
+		requireOK(t, resp)
+		require.Equal(t, "value"+strconv.Itoa(i), string(resp.Payload))
+	}
+
+	// a replayed receipt has to be signed before its index is checked
+	results = n.invokeReceipts(t, swapperService, remoteService, []batchReceipt{
+		{index: 2, typ: ibtpReceiptSuccess, result: [][]byte{[]byte("value2")}, txStatus: txSuccess},
+		signed(2, ibtpReceiptSuccess, [][]byte{[]byte("value2")}, txSuccess),
+		signed(4, ibtpReceiptSuccess, nil, txSuccess),
+	})
+	require.Equal(t, codeBadSignature, results[0].Code)
+	require.Equal(t, codeIndexApplied, results[1].Code)
+	require.Equal(t, codeIndexMismatch, results[2].Code)
+	require.Equal(t, map[string]uint64{outPair: 2}, n.counters(t, "getCallbackMeta"))
+}
+
+func TestInvokeIndexUpdate(t *testing.T) {
+	n := newRelayNetwork(t)
+	update := func(from, to string, index, reqType uint64) pb.Response {
+		return n.invoke("broker", "invokeIndexUpdate", from, to, strconv.FormatUint(index, 10), strconv.FormatUint(reqType, 10))
+	}
+
+	t.Run("interchain", func(t *testing.T) {
+		pair := genServicePair("a", "b")
+		requireOK(t, update("a", "b", 1, 0))
+		requireCode(t, update("a", "b", 1, 0), codeIndexApplied)
+		requireCode(t, update("a", "b", 3, 0), codeIndexMismatch)
+		require.Equal(t, uint64(1), n.counters(t, "getInnerMeta")[pair])
+	})
+
+	t.Run("receipt", func(t *testing.T) {
+		pair := genServicePair("c", "d")
+		requireOK(t, update("c", "d", 1, 1))
+		requireCode(t, update("c", "d", 1, 1), codeIndexApplied)
+		requireCode(t, update("c", "d", 3, 1), codeIndexMismatch)
+		require.Equal(t, uint64(1), n.counters(t, "getCallbackMeta")[pair])
+	})
+
+	t.Run("destination rollback", func(t *testing.T) {
+		pair := genServicePair("e", "f")
+		// the rolled back request never reached the chain, so the in index
+		// moves with it
+		requireOK(t, update("e", "f", 1, 2))
+		require.Equal(t, uint64(1), n.counters(t, "getDstRollbackMeta")[pair])
+		require.Equal(t, uint64(1), n.counters(t, "getInnerMeta")[pair])
+		requireCode(t, update("e", "f", 1, 2), codeIndexApplied)
+		// a gap leaves the in index behind
+		requireOK(t, update("e", "f", 3, 2))
+		require.Equal(t, uint64(3), n.counters(t, "getDstRollbackMeta")[pair])
+		require.Equal(t, uint64(1), n.counters(t, "getInnerMeta")[pair])
+	})
+
+	t.Run("rollback cache", func(t *testing.T) {
+		pair := genServicePair("g", "h")
+		// rollbacks ahead of the callback index wait in the cache
+		requireOK(t, update("g", "h", 2, 3))
+		require.Equal(t, uint64(0), n.counters(t, "getCallbackMeta")[pair])
+		requireOK(t, update("g", "h", 1, 3))
+		require.Equal(t, uint64(1), n.counters(t, "getCallbackMeta")[pair])
+		requireCode(t, update("g", "h", 1, 3), codeIndexApplied)
+
+		// the end of a rollback which is not the first cached one is ignored
+		requireOK(t, update("g", "h", 5, 4))
+		require.Equal(t, uint64(1), n.counters(t, "getCallbackMeta")[pair])
+		requireOK(t, update("g", "h", 2, 4))
+		require.Equal(t, uint64(2), n.counters(t, "getCallbackMeta")[pair])
+	})
+
+	t.Run("invalid args", func(t *testing.T) {
+		requireCode(t, n.invoke("broker", "invokeIndexUpdate", "a", "b", "1"), codeInvalidArgs)
+		requireCode(t, n.invoke("broker", "invokeIndexUpdate", "a", "b", "x", "0"), codeInvalidArgs)
+		requireCode(t, n.invokeAs(bannedMSP, "broker", "invokeIndexUpdate", "a", "b", "2", "0"), codeNotAdmin)
+	})
+}
+
+func TestDirectEmitInterchainEvent(t *testing.T) {
+	n := newDirectNetwork(t)
+	from := fullID(transferService)
+
+	resp := n.transferBill(t, adminMSP, remoteService, "TD1")
+	require.NotEqual(t, int32(shim.OK), resp.Status)
+	require.Contains(t, resp.Message, "remote service is not registered")
+
+	resp = n.transferBill(t, bannedMSP, directService, "TD1")
+	require.NotEqual(t, int32(shim.OK), resp.Status)
+	require.Contains(t, resp.Message, "remote service is not allowed to call dest address")
+
+	requireOK(t, n.transferBill(t, adminMSP, directService, "TD1"))
+	require.Equal(t, uint64(1), n.outMessage(t, genServicePair(from, directService), 1).Index)
+	// the broker starts a transaction for the request
+	require.Equal(t, uint64(1), n.transactionStatus(t, from, directService, 1))
+}
+
+func TestDirectInvokeReceipt(t *testing.T) {
+	n := newDirectNetwork(t)
+	from := fullID(transferService)
+	outPair := genServicePair(from, directService)
+	for i := 1; i <= 5; i++ {
+		requireOK(t, n.transferBill(t, adminMSP, directService, "TD"+strconv.Itoa(i)))
+	}
+	receipt := func(index, typ uint64) pb.Response {
+		return n.invokeReceipt(t, transferService, directService, index, typ, nil, txBegin, nil)
+	}
+
+	requireCode(t, receipt(1, ibtpInterchain), codeInvalidArgs)
+
+	requireOK(t, receipt(1, ibtpReceiptSuccess))
+	require.Equal(t, "receipt received", n.billStatus(t, "TD1"))
+	require.Equal(t, uint64(3), n.transactionStatus(t, from, directService, 1))
+
+	requireOK(t, receipt(2, ibtpReceiptFailure))
+	require.Equal(t, "rollback", n.billStatus(t, "TD2"))
+	require.Equal(t, uint64(4), n.transactionStatus(t, from, directService, 2))
+
+	// the transaction is rolled back, then its rollback ends on the remote chain
+	requireOK(t, receipt(3, ibtpReceiptRollback))
+	require.Equal(t, "rollback", n.billStatus(t, "TD3"))
+	require.Equal(t, uint64(2), n.transactionStatus(t, from, directService, 3))
+	requireOK(t, receipt(3, ibtpReceiptRollbackEnd))
+	require.Equal(t, uint64(5), n.transactionStatus(t, from, directService, 3))
+	require.Equal(t, uint64(3), n.counters(t, "getCallbackMeta")[outPair])
+	require.Equal(t, uint64(3), n.counters(t, "getSrcRollbackMeta")[outPair])
+
+	// the transaction status only moves forward
+	require.NotEqual(t, int32(shim.OK), receipt(3, ibtpReceiptRollbackEnd).Status)
+
+	// a rollback ahead of the callback index is cached until its end
+	requireOK(t, receipt(5, ibtpReceiptRollback))
+	require.Equal(t, uint64(3), n.counters(t, "getCallbackMeta")[outPair])
+	requireOK(t, receipt(4, ibtpReceiptRollback))
+	require.Equal(t, uint64(4), n.counters(t, "getCallbackMeta")[outPair])
+	requireOK(t, receipt(5, ibtpReceiptRollbackEnd))
+	require.Equal(t, uint64(5), n.counters(t, "getCallbackMeta")[outPair])
+	require.Equal(t, uint64(5), n.transactionStatus(t, from, directService, 5))
+}
+
+func TestDirectInvokeInterchain(t *testing.T) {
+	n := newDirectNetwork(t)
+	inPair := genServicePair(directService, fullID(transferService))
+
+	// no signature is needed without a relay
+	requireOK(t, n.invokeInterchain(t, directService, transferService, 1, "ladingBillCrossChainCall", ladingBillArgs(t, "TD1"), txBegin, nil))
+	require.Equal(t, "receipt sent", n.billStatus(t, "TD1"))
+	require.Equal(t, ibtpReceiptSuccess, n.inMessage(t, inPair, 1).Typ)
+
+	requireOK(t, n.invokeInterchain(t, directService, transferService, 1, "ladingBillCrossChainCall", ladingBillArgs(t, "TD1"), txBeginRollback, nil))
+	require.Equal(t, ibtpReceiptRollbackEnd, n.inMessage(t, inPair, 1).Typ)
+
+	requireCode(t, n.invokeInterchain(t, directService, transferService, 3, "ladingBillCrossChainCall", ladingBillArgs(t, "TD3"), txBegin, nil), codeIndexMismatch)
+	requireCode(t, n.invokeInterchain(t, ":chain3:mychannel&transfer", transferService, 1, "ladingBillCrossChainCall", ladingBillArgs(t, "TD4"), txBegin, nil), codeServiceNotWhitelisted)
+}
+
+func TestMigrateMessages(t *testing.T) {
+	n := newRelayNetwork(t)
+	outPair := genServicePair(fullID(transferService), remoteService)
+	inPair := genServicePair(remoteService, fullID(transferService))
+
+	legacyOut, err := json.Marshal(map[string]map[uint64]Event{outPair: {
+		1: {Index: 1, SrcFullID: fullID(transferService), DstFullID: remoteService},
+		2: {Index: 2, SrcFullID: fullID(transferService), DstFullID: remoteService, TxID: "emit"},
+	}})
+	require.Nil(t, err)
+	legacyReceipts, err := json.Marshal(map[string]map[uint64]Receipt{inPair: {1: {Typ: ibtpReceiptSuccess}}})
+	require.Nil(t, err)
+	state := n.stubs["broker"].State
+	state[legacyOutMessages] = legacyOut
+	state[legacyReceiptMessages] = legacyReceipts
+
+	resp := n.invoke("broker", "migrateMessages")
+	requireOK(t, resp)
+	result := &migrateResult{}
+	require.Nil(t, json.Unmarshal(resp.Payload, result))
+	require.Equal(t, &migrateResult{OutMessages: 2, ReceiptMessages: 1}, result)
+	require.Nil(t, state[legacyOutMessages])
+	require.Nil(t, state[legacyReceiptMessages])
+
+	// the messages which recorded no transaction are marked instead of being
+	// proven by the migration
+	event := n.outMessage(t, outPair, 1)
+	require.Empty(t, event.TxID)
+	require.True(t, event.Migrated)
+	event = n.outMessage(t, outPair, 2)
+	require.Equal(t, "emit", event.TxID)
+	require.False(t, event.Migrated)
+	receipt := n.inMessage(t, inPair, 1)
+	require.Empty(t, receipt.TxID)
+	require.True(t, receipt.Migrated)
+
+	resp = n.invoke("broker", "migrateMessages")
+	requireOK(t, resp)
+	require.Nil(t, json.Unmarshal(resp.Payload, result))
+	require.Equal(t, &migrateResult{}, result)
+	require.True(t, n.outMessage(t, outPair, 1).Migrated)
+}
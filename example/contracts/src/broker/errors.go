@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// codes of the errors returned by the functions called through Invoke, they
+// are mirrored by the plugin to tell why a request is rejected. Only Init
+// returns plain errors, as it is called by the chaincode lifecycle instead.
+const (
+	codeInvalidArgs           = "INVALID_ARGS"
+	codeIndexMismatch         = "INDEX_MISMATCH"
+	codeIndexApplied          = "INDEX_APPLIED"
+	codeServiceNotWhitelisted = "SERVICE_NOT_WHITELISTED"
+	codeBadSignature          = "BAD_SIGNATURE"
+	codeCalleeFailed          = "CALLEE_FAILED"
+	codeNotAdmin              = "NOT_ADMIN"
+	codeInternal              = "INTERNAL"
+)
+
+// codedError is an error with one of the error codes, it keeps its code when
+// wrapped with %w
+type codedError struct {
+	code string
+	msg  string
+}
+
+func (e *codedError) Error() string {
+	return e.msg
+}
+
+func newError(code, format string, args ...interface{}) error {
+	return &codedError{
+		code: code,
+		msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+// errorCode returns the code of err, errors without a code are internal ones
+func errorCode(err error) string {
+	var e *codedError
+	if errors.As(err, &e) {
+		return e.code
+	}
+	return codeInternal
+}
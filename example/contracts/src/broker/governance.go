@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// governanceProposals keeps the pending governance proposals by id
+const governanceProposals = "governance-proposals"
+
+// results of a vote
+const (
+	votePending uint = iota
+	votePassed
+	voteRejected
+)
+
+// governances are the functions changing the broker which need the approval
+// of admin-threshold admins. Each one checks its arguments against the
+// current state and returns the change it makes.
+var governances = map[string]func(*Broker, shim.ChaincodeStubInterface, []string) (func() error, error){
+	"initialize":        (*Broker).initializeChange,
+	"addAdmin":          (*Broker).addAdminChange,
+	"removeAdmin":       (*Broker).removeAdminChange,
+	"setAdminThreshold": (*Broker).adminThresholdChange,
+	"setValidators":     (*Broker).validatorsChange,
+}
+
+// GovernanceProposal is a call of a governance function waiting for the votes
+// of admins
+type GovernanceProposal struct {
+	ID   string   `json:"id"`
+	Func string   `json:"func"`
+	Args []string `json:"args"`
+	proposal
+}
+
+// propose records the call of the governance function fn as a proposal
+// approved by the calling admin. Calling it again with the same arguments
+// approves the pending proposal, like voteProposal does.
+func (broker *Broker) propose(stub shim.ChaincodeStubInterface, fn string, args []string) pb.Response {
+	if _, err := governances[fn](broker, stub, args); err != nil {
+		return errorResponse(codeInvalidArgs, err.Error())
+	}
+
+	proposals, err := broker.getGovernanceProposals(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	id := proposalID(fn, args)
+	p, ok := proposals[id]
+	if !ok {
+		p = &GovernanceProposal{
+			ID:       id,
+			Func:     fn,
+			Args:     args,
+			proposal: proposal{Exist: true},
+		}
+	}
+
+	return broker.castVote(stub, proposals, p, passed)
+}
+
+// voteProposal votes a pending governance proposal: args[0] is its id,
+// args[1] is 1 to approve it or 0 to reject it
+func (broker *Broker) voteProposal(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 2")
+	}
+	status, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("cannot parse %s to uint", args[1]))
+	}
+
+	proposals, err := broker.getGovernanceProposals(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	p, ok := proposals[args[0]]
+	if !ok {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("proposal %s not found", args[0]))
+	}
+
+	return broker.castVote(stub, proposals, p, status)
+}
+
+// castVote counts the vote of the caller on p and applies p once it passes
+func (broker *Broker) castVote(stub shim.ChaincodeStubInterface, proposals map[string]*GovernanceProposal, p *GovernanceProposal, status uint64) pb.Response {
+	creatorId, err := broker.getCreatorMspId(stub)
+	if err != nil {
+		return failResponse(fmt.Errorf("Get creator id: %w", err))
+	}
+	result, err := broker.vote(stub, &p.proposal, status, creatorId)
+	if err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("vote proposal: %s", err.Error()))
+	}
+
+	var msg string
+	switch result {
+	case votePending:
+		proposals[p.ID] = p
+		msg = fmt.Sprintf("proposal %s is pending", p.ID)
+	case voteRejected:
+		delete(proposals, p.ID)
+		msg = fmt.Sprintf("proposal %s is rejected", p.ID)
+	case votePassed:
+		// the state may have changed since the proposal was made
+		change, err := governances[p.Func](broker, stub, p.Args)
+		if err != nil {
+			return errorResponse(codeInvalidArgs, fmt.Sprintf("apply proposal %s: %s", p.ID, err.Error()))
+		}
+		if err := change(); err != nil {
+			return failResponse(fmt.Errorf("apply proposal %s: %w", p.ID, err))
+		}
+		delete(proposals, p.ID)
+		msg = fmt.Sprintf("proposal %s is passed", p.ID)
+	}
+
+	if err := broker.putGovernanceProposals(stub, proposals); err != nil {
+		return failResponse(err)
+	}
+	return shim.Success([]byte(msg))
+}
+
+// getPendingProposals returns the pending governance proposals ordered by id
+func (broker *Broker) getPendingProposals(stub shim.ChaincodeStubInterface) pb.Response {
+	proposals, err := broker.getGovernanceProposals(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+
+	pending := make([]*GovernanceProposal, 0, len(proposals))
+	for _, p := range proposals {
+		pending = append(pending, p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].ID < pending[j].ID
+	})
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(data)
+}
+
+// getPendingProposal returns the pending governance proposal args[0]
+func (broker *Broker) getPendingProposal(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 1 {
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 1")
+	}
+
+	proposals, err := broker.getGovernanceProposals(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	p, ok := proposals[args[0]]
+	if !ok {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("proposal %s not found", args[0]))
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(data)
+}
+
+// addAdminChange makes the clients of the MSP args[0] admins
+func (broker *Broker) addAdminChange(stub shim.ChaincodeStubInterface, args []string) (func() error, error) {
+	if len(args) != 1 || args[0] == "" {
+		return nil, fmt.Errorf("incorrect number of arguments, expecting 1")
+	}
+	admins, err := broker.getMap(stub, adminList)
+	if err != nil {
+		return nil, err
+	}
+	if admins[args[0]] == 1 {
+		return nil, fmt.Errorf("%s is already an admin", args[0])
+	}
+
+	return func() error {
+		admins[args[0]] = 1
+		return broker.putMap(stub, adminList, admins)
+	}, nil
+}
+
+// removeAdminChange takes the MSP args[0] out of the admins, as long as
+// enough admins are left to pass proposals
+func (broker *Broker) removeAdminChange(stub shim.ChaincodeStubInterface, args []string) (func() error, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("incorrect number of arguments, expecting 1")
+	}
+	admins, err := broker.getMap(stub, adminList)
+	if err != nil {
+		return nil, err
+	}
+	if admins[args[0]] != 1 {
+		return nil, fmt.Errorf("%s is not an admin", args[0])
+	}
+	threshold, err := broker.getAdminThreshold(stub)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(admins)-1) < threshold {
+		return nil, fmt.Errorf("removing %s leaves fewer admins than the threshold %d", args[0], threshold)
+	}
+
+	return func() error {
+		delete(admins, args[0])
+		return broker.putMap(stub, adminList, admins)
+	}, nil
+}
+
+// adminThresholdChange sets the number of admins approving a proposal to
+// args[0]
+func (broker *Broker) adminThresholdChange(stub shim.ChaincodeStubInterface, args []string) (func() error, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("incorrect number of arguments, expecting 1")
+	}
+	threshold, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	admins, err := broker.getMap(stub, adminList)
+	if err != nil {
+		return nil, err
+	}
+	if threshold == 0 || threshold > uint64(len(admins)) {
+		return nil, fmt.Errorf("threshold %d is out of range [1, %d]", threshold, len(admins))
+	}
+
+	return func() error {
+		return broker.setAdminThreshold(stub, threshold)
+	}, nil
+}
+
+func (broker *Broker) getGovernanceProposals(stub shim.ChaincodeStubInterface) (map[string]*GovernanceProposal, error) {
+	proposalsBytes, err := stub.GetState(governanceProposals)
+	if err != nil {
+		return nil, err
+	}
+	proposals := make(map[string]*GovernanceProposal)
+	if proposalsBytes == nil {
+		return proposals, nil
+	}
+	if err := json.Unmarshal(proposalsBytes, &proposals); err != nil {
+		return nil, err
+	}
+	return proposals, nil
+}
+
+func (broker *Broker) putGovernanceProposals(stub shim.ChaincodeStubInterface, proposals map[string]*GovernanceProposal) error {
+	proposalsBytes, err := json.Marshal(proposals)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(governanceProposals, proposalsBytes)
+}
+
+// proposalID names the call of fn with args, the same call made by several
+// admins is one proposal
+func proposalID(fn string, args []string) string {
+	return strings.Join(append([]string{fn}, args...), delimiter)
+}
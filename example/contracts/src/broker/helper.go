@@ -10,10 +10,12 @@ import (
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	"github.com/hyperledger/fabric/protos/msp"
 	pb "github.com/hyperledger/fabric/protos/peer"
+	"golang.org/x/crypto/sha3"
 )
 
 type response struct {
 	OK      bool   `json:"ok"`
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
 	Data    []byte `json:"data"`
 }
@@ -32,9 +34,10 @@ func successResponse(data []byte) pb.Response {
 	return shim.Success(data)
 }
 
-func errorResponse(msg string) pb.Response {
+func errorResponse(code, msg string) pb.Response {
 	res := &response{
 		OK:      false,
+		Code:    code,
 		Message: msg,
 	}
 
@@ -46,6 +49,29 @@ func errorResponse(msg string) pb.Response {
 	return shim.Error(string(data))
 }
 
+// failResponse returns err with its code as an error response
+func failResponse(err error) pb.Response {
+	return errorResponse(errorCode(err), err.Error())
+}
+
+// parseResponse converts a chaincode response built by successResponse,
+// errorResponse or a plain shim call into a response
+func parseResponse(resp pb.Response) *response {
+	res := &response{}
+	if resp.Status == shim.OK {
+		if err := json.Unmarshal(resp.Payload, res); err != nil {
+			return &response{OK: true, Data: resp.Payload}
+		}
+		return res
+	}
+
+	if err := json.Unmarshal([]byte(resp.Message), res); err != nil {
+		return &response{OK: false, Code: codeInternal, Message: resp.Message}
+	}
+	res.OK = false
+	return res
+}
+
 // putMap for persisting meta state into ledger
 func (broker *Broker) putMap(stub shim.ChaincodeStubInterface, metaName string, meta map[string]uint64) error {
 	if meta == nil {
@@ -136,22 +162,33 @@ func getKey(channel, chaincodeName string) string {
 }
 
 func (broker *Broker) checkIndex(stub shim.ChaincodeStubInterface, addr string, index uint64, metaName string) error {
-	meta, err := broker.getMap(stub, metaName)
+	counter, err := broker.getCounter(stub, metaName, addr)
 	if err != nil {
 		return err
 	}
-	if index != meta[addr]+1 {
-		return fmt.Errorf("incorrect index, expect %d", meta[addr]+1)
+	if index <= counter {
+		return newError(codeIndexApplied, "index %d is already applied, expect %d", index, counter+1)
+	}
+	if index != counter+1 {
+		return newError(codeIndexMismatch, "incorrect index, expect %d", counter+1)
 	}
 	return nil
 }
 
-func (broker *Broker) outMsgKey(to string, idx string) string {
-	return fmt.Sprintf("out-msg-%s-%s", to, idx)
+func (broker *Broker) outMsgKey(stub shim.ChaincodeStubInterface, servicePair string, index uint64) (string, error) {
+	return stub.CreateCompositeKey(outMsgPrefix, []string{servicePair, strconv.FormatUint(index, 10)})
 }
 
-func (broker *Broker) inMsgKey(from string, idx string) string {
-	return fmt.Sprintf("in-msg-%s-%s", from, idx)
+func (broker *Broker) inMsgKey(stub shim.ChaincodeStubInterface, servicePair string, index uint64) (string, error) {
+	return stub.CreateCompositeKey(inMsgPrefix, []string{servicePair, strconv.FormatUint(index, 10)})
+}
+
+func (broker *Broker) offChainReqKey(servicePair string, idx string) string {
+	return fmt.Sprintf("offchain-req-%s-%s", servicePair, idx)
+}
+
+func (broker *Broker) offChainRespKey(servicePair string, idx string) string {
+	return fmt.Sprintf("offchain-resp-%s-%s", servicePair, idx)
 }
 
 func (broker *Broker) onlyAdmin(stub shim.ChaincodeStubInterface) bool {
@@ -194,7 +231,7 @@ func (broker *Broker) onlyWhitelist(stub shim.ChaincodeStubInterface) bool {
 func (broker *Broker) getList(stub shim.ChaincodeStubInterface) pb.Response {
 	whiteList, err := broker.getMap(stub, whiteList)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("Get white list :%s", err.Error()))
+		return failResponse(fmt.Errorf("Get white list :%w", err))
 	}
 	var list [][]byte
 	for k, v := range whiteList {
@@ -207,9 +244,18 @@ func (broker *Broker) getList(stub shim.ChaincodeStubInterface) pb.Response {
 
 func (broker *Broker) checkAdmin(stub shim.ChaincodeStubInterface, function string) bool {
 	checks := map[string]struct{}{
-		"audit":             {},
-		"invokeInterchain":  {},
-		"invokeIndexUpdate": {},
+		"audit":              {},
+		"invokeInterchain":   {},
+		"invokeIndexUpdate":  {},
+		"submitOffChainData": {},
+		"initialize":         {},
+		"setValidators":      {},
+		"addAdmin":           {},
+		"removeAdmin":        {},
+		"setAdminThreshold":  {},
+		"voteProposal":       {},
+		"migrateMessages":    {},
+		"migrateCounters":    {},
 	}
 
 	if _, ok := checks[function]; !ok {
@@ -221,7 +267,8 @@ func (broker *Broker) checkAdmin(stub shim.ChaincodeStubInterface, function stri
 
 func (broker *Broker) checkWhitelist(stub shim.ChaincodeStubInterface, function string) bool {
 	checks := map[string]struct{}{
-		"EmitInterchainEvent": {},
+		"EmitInterchainEvent":     {},
+		"EmitOffChainDataRequest": {},
 	}
 
 	if _, ok := checks[function]; !ok {
@@ -338,44 +385,68 @@ func (broker *Broker) putLocalServiceList(stub shim.ChaincodeStubInterface, loca
 	return stub.PutState(localServiceList, localServiceBytes)
 }
 
-func (broker *Broker) getReceiptMessages(stub shim.ChaincodeStubInterface) (map[string](map[uint64]Receipt), error) {
-	messagesBytes, err := stub.GetState(receiptMessages)
+// getOutEvent returns the interchain event sent to servicePair with index
+func (broker *Broker) getOutEvent(stub shim.ChaincodeStubInterface, servicePair string, index uint64) (*Event, error) {
+	key, err := broker.outMsgKey(stub, servicePair, index)
 	if err != nil {
 		return nil, err
 	}
-	messages := make(map[string](map[uint64]Receipt))
-	if err := json.Unmarshal(messagesBytes, &messages); err != nil {
+	eventBytes, err := stub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	if eventBytes == nil {
+		return nil, fmt.Errorf("out message %s of index %d not found", servicePair, index)
+	}
+	event := &Event{}
+	if err := json.Unmarshal(eventBytes, event); err != nil {
 		return nil, err
 	}
-	return messages, nil
+	return event, nil
 }
 
-func (broker *Broker) setReceiptMessages(stub shim.ChaincodeStubInterface, messages map[string](map[uint64]Receipt)) error {
-	messagesBytes, err := json.Marshal(messages)
+func (broker *Broker) setOutEvent(stub shim.ChaincodeStubInterface, servicePair string, index uint64, event *Event) error {
+	key, err := broker.outMsgKey(stub, servicePair, index)
 	if err != nil {
 		return err
 	}
-	return stub.PutState(receiptMessages, messagesBytes)
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, eventBytes)
 }
 
-func (broker *Broker) getOutMessages(stub shim.ChaincodeStubInterface) (map[string](map[uint64]Event), error) {
-	messagesBytes, err := stub.GetState(outMessages)
+// getReceipt returns the receipt of the interchain from servicePair with index
+func (broker *Broker) getReceipt(stub shim.ChaincodeStubInterface, servicePair string, index uint64) (*Receipt, error) {
+	key, err := broker.inMsgKey(stub, servicePair, index)
+	if err != nil {
+		return nil, err
+	}
+	receiptBytes, err := stub.GetState(key)
 	if err != nil {
 		return nil, err
 	}
-	messages := make(map[string](map[uint64]Event))
-	if err := json.Unmarshal(messagesBytes, &messages); err != nil {
+	if receiptBytes == nil {
+		return nil, fmt.Errorf("in message %s of index %d not found", servicePair, index)
+	}
+	receipt := &Receipt{}
+	if err := json.Unmarshal(receiptBytes, receipt); err != nil {
 		return nil, err
 	}
-	return messages, nil
+	return receipt, nil
 }
 
-func (broker *Broker) setOutMessages(stub shim.ChaincodeStubInterface, messages map[string](map[uint64]Event)) error {
-	messagesBytes, err := json.Marshal(messages)
+func (broker *Broker) setReceipt(stub shim.ChaincodeStubInterface, servicePair string, index uint64, receipt *Receipt) error {
+	key, err := broker.inMsgKey(stub, servicePair, index)
+	if err != nil {
+		return err
+	}
+	receiptBytes, err := json.Marshal(receipt)
 	if err != nil {
 		return err
 	}
-	return stub.PutState(outMessages, messagesBytes)
+	return stub.PutState(key, receiptBytes)
 }
 
 func (broker *Broker) getCreatorMspId(stub shim.ChaincodeStubInterface) (string, error) {
@@ -427,6 +498,9 @@ func (broker *Broker) getValidatorList(stub shim.ChaincodeStubInterface) ([]stri
 	if err != nil {
 		return nil, err
 	}
+	if vListBytes == nil {
+		return nil, nil
+	}
 	var vList []string
 	if err := json.Unmarshal(vListBytes, &vList); err != nil {
 		return nil, err
@@ -442,3 +516,84 @@ func (broker *Broker) setValidatorList(stub shim.ChaincodeStubInterface, list []
 
 	return stub.PutState(validatorList, listBytes)
 }
+
+// getTransactionContract returns the name and the channel of the transaction
+// chaincode, which defaults to the transaction chaincode on the channel of
+// the broker
+func (broker *Broker) getTransactionContract(stub shim.ChaincodeStubInterface) (string, string, error) {
+	name, err := stub.GetState(transactionContract)
+	if err != nil {
+		return "", "", err
+	}
+	channel, err := stub.GetState(transactionChannel)
+	if err != nil {
+		return "", "", err
+	}
+	if len(name) == 0 {
+		name = []byte(defaultTransactionContract)
+	}
+	if len(channel) == 0 {
+		channel = []byte(stub.GetChannelID())
+	}
+	return string(name), string(channel), nil
+}
+
+// invokeTransaction calls the transaction chaincode the broker is set up with
+func (broker *Broker) invokeTransaction(stub shim.ChaincodeStubInterface, args [][]byte) pb.Response {
+	name, channel, err := broker.getTransactionContract(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	return stub.InvokeChaincode(name, args, channel)
+}
+
+func (broker *Broker) setReceiptEvent(stub shim.ChaincodeStubInterface, events []*ReceiptEvent) error {
+	eventsBytes, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	return stub.SetEvent(receiptEventName, eventsBytes)
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// batchStub is a stub keeping the writes of the transaction in memory, so that
+// the calls of a batch read the state written by the calls before them
+type batchStub struct {
+	shim.ChaincodeStubInterface
+	writes map[string][]byte
+}
+
+func newBatchStub(stub shim.ChaincodeStubInterface) *batchStub {
+	return &batchStub{
+		ChaincodeStubInterface: stub,
+		writes:                 make(map[string][]byte),
+	}
+}
+
+func (s *batchStub) GetState(key string) ([]byte, error) {
+	if value, ok := s.writes[key]; ok {
+		return value, nil
+	}
+	return s.ChaincodeStubInterface.GetState(key)
+}
+
+func (s *batchStub) PutState(key string, value []byte) error {
+	if err := s.ChaincodeStubInterface.PutState(key, value); err != nil {
+		return err
+	}
+	s.writes[key] = value
+	return nil
+}
+
+func (s *batchStub) DelState(key string) error {
+	if err := s.ChaincodeStubInterface.DelState(key); err != nil {
+		return err
+	}
+	s.writes[key] = nil
+	return nil
+}
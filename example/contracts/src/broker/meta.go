@@ -11,129 +11,274 @@ import (
 
 // getOutMeta
 func (broker *Broker) getOuterMeta(stub shim.ChaincodeStubInterface) pb.Response {
-	v, err := stub.GetState(outterMeta)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	return shim.Success(v)
+	return broker.getCountersResponse(stub, outterMeta)
 }
 
 // getOutMessage to,index
 func (broker *Broker) getOutMessage(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) < 2 {
-		return shim.Error("incorrect number of arguments, expecting 2")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 2")
 	}
 	servicePair := args[0]
 	index, err := strconv.ParseUint(args[1], 10, 64)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("getOutMessage parse index error: %v", err.Error()))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("getOutMessage parse index error: %v", err.Error()))
 	}
-	messages, err := broker.getOutMessages(stub)
+	message, err := broker.getOutEvent(stub, servicePair, index)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
-	v, err := json.Marshal(messages[servicePair][index])
+	v, err := json.Marshal(message)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	return shim.Success(v)
 }
 
 func (broker *Broker) getInnerMeta(stub shim.ChaincodeStubInterface) pb.Response {
-	v, err := stub.GetState(innerMeta)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	return shim.Success(v)
+	return broker.getCountersResponse(stub, innerMeta)
 }
 
 // getInMessage from,index
 func (broker *Broker) getInMessage(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) < 2 {
-		return shim.Error("incorrect number of arguments, expecting 2")
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 2")
 	}
 	inServicePair := args[0]
 	index, err := strconv.ParseUint(args[1], 10, 64)
 	if err != nil {
-		return shim.Error(fmt.Sprintf("getInMessage parse index error: %v", err.Error()))
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("getInMessage parse index error: %v", err.Error()))
 	}
-	receipts, err := broker.getReceiptMessages(stub)
+	receipt, err := broker.getReceipt(stub, inServicePair, index)
 	if err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err)
 	}
 
-	v, err := json.Marshal(receipts[inServicePair][index])
+	v, err := json.Marshal(receipt)
 	if err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err)
 	}
 	return shim.Success(v)
 }
 
 func (broker *Broker) getCallbackMeta(stub shim.ChaincodeStubInterface) pb.Response {
-	v, err := stub.GetState(callbackMeta)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	return shim.Success(v)
+	return broker.getCountersResponse(stub, callbackMeta)
 }
 
 func (broker *Broker) getLocalServices(stub shim.ChaincodeStubInterface) pb.Response {
 	localService, err := broker.getLocalServiceList(stub)
 	if err != nil {
-		return shim.Error(err.Error())
+		return failResponse(err)
 	}
 	var services []string
 	for _, service := range localService {
 		fullId, err := broker.genFullServiceID(stub, service)
 		if err != nil {
-			return shim.Error(err.Error())
+			return failResponse(err)
 		}
 		services = append(services, fullId)
 	}
 	v, err := json.Marshal(services)
 	if err != nil {
-		return errorResponse(err.Error())
+		return failResponse(err)
 	}
 	return shim.Success(v)
 }
 
 func (broker *Broker) getDstRollbackMeta(stub shim.ChaincodeStubInterface) pb.Response {
-	v, err := stub.GetState(dstRollbackMeta)
-	if err != nil {
-		return shim.Error(err.Error())
-	}
-	return shim.Success(v)
+	return broker.getCountersResponse(stub, dstRollbackMeta)
+}
+
+func (broker *Broker) getSrcRollbackMeta(stub shim.ChaincodeStubInterface) pb.Response {
+	return broker.getCountersResponse(stub, srcRollbackMeta)
 }
 
 func (broker *Broker) markInCounter(stub shim.ChaincodeStubInterface, servicePair string) error {
-	inMeta, err := broker.getMap(stub, innerMeta)
+	index, err := broker.getCounter(stub, innerMeta, servicePair)
 	if err != nil {
 		return err
 	}
 
-	inMeta[servicePair]++
-	return broker.putMap(stub, innerMeta, inMeta)
+	return broker.setCounter(stub, innerMeta, servicePair, index+1)
 }
 
 func (broker *Broker) markCallbackCounter(stub shim.ChaincodeStubInterface, servicePair string, index uint64) error {
-	meta, err := broker.getMap(stub, callbackMeta)
+	return broker.setCounter(stub, callbackMeta, servicePair, index)
+}
+
+func (broker *Broker) markDstRollbackCounter(stub shim.ChaincodeStubInterface, servicePair string, index uint64) error {
+	return broker.setCounter(stub, dstRollbackMeta, servicePair, index)
+}
+
+// markSrcRollbackCounter records the greatest index of the outgoing interchain
+// txs which have been rolled back on the source chain
+func (broker *Broker) markSrcRollbackCounter(stub shim.ChaincodeStubInterface, servicePair string, index uint64) error {
+	counter, err := broker.getCounter(stub, srcRollbackMeta, servicePair)
 	if err != nil {
 		return err
 	}
 
-	meta[servicePair] = index
+	if index <= counter {
+		return nil
+	}
 
-	return broker.putMap(stub, callbackMeta, meta)
+	return broker.setCounter(stub, srcRollbackMeta, servicePair, index)
 }
 
-func (broker *Broker) markDstRollbackCounter(stub shim.ChaincodeStubInterface, servicePair string, index uint64) error {
-	meta, err := broker.getMap(stub, dstRollbackMeta)
+// counterKey is the key of the counter of servicePair in meta metaName. Each
+// counter has its own key, so txs of unrelated service pairs do not conflict.
+func (broker *Broker) counterKey(stub shim.ChaincodeStubInterface, metaName, servicePair string) (string, error) {
+	return stub.CreateCompositeKey(metaName, []string{servicePair})
+}
+
+// getCounter returns the counter of servicePair in meta metaName, 0 if absent
+func (broker *Broker) getCounter(stub shim.ChaincodeStubInterface, metaName, servicePair string) (uint64, error) {
+	key, err := broker.counterKey(stub, metaName, servicePair)
+	if err != nil {
+		return 0, err
+	}
+	v, err := stub.GetState(key)
+	if err != nil {
+		return 0, err
+	}
+	if v == nil {
+		return 0, nil
+	}
+	return strconv.ParseUint(string(v), 10, 64)
+}
+
+func (broker *Broker) setCounter(stub shim.ChaincodeStubInterface, metaName, servicePair string, index uint64) error {
+	key, err := broker.counterKey(stub, metaName, servicePair)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(key, []byte(strconv.FormatUint(index, 10)))
+}
+
+// getCounters rebuilds the counters of all service pairs in meta metaName
+func (broker *Broker) getCounters(stub shim.ChaincodeStubInterface, metaName string) (map[string]uint64, error) {
+	iter, err := stub.GetStateByPartialCompositeKey(metaName, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	meta := make(map[string]uint64)
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, attrs, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(attrs) != 1 {
+			return nil, fmt.Errorf("invalid counter key %q of %s", kv.Key, metaName)
+		}
+		index, err := strconv.ParseUint(string(kv.Value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse counter of %s in %s: %w", attrs[0], metaName, err)
+		}
+		meta[attrs[0]] = index
+	}
+	return meta, nil
+}
 
+// resetCounters removes the counters of all service pairs in meta metaName
+func (broker *Broker) resetCounters(stub shim.ChaincodeStubInterface, metaName string) error {
+	iter, err := stub.GetStateByPartialCompositeKey(metaName, []string{})
 	if err != nil {
 		return err
 	}
+	defer iter.Close()
 
-	meta[servicePair] = index
+	for iter.HasNext() {
+		kv, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		if err := stub.DelState(kv.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (broker *Broker) getCountersResponse(stub shim.ChaincodeStubInterface, metaName string) pb.Response {
+	meta, err := broker.getCounters(stub, metaName)
+	if err != nil {
+		return failResponse(err)
+	}
+	v, err := json.Marshal(meta)
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(v)
+}
 
-	return broker.putMap(stub, dstRollbackMeta, meta)
+// getOutMessages servicePair,from,to returns the out messages of servicePair
+// from index from to index to, at most maxPageSize of them
+func (broker *Broker) getOutMessages(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	servicePair, from, to, err := parsePage(args)
+	if err != nil {
+		return failResponse(fmt.Errorf("getOutMessages: %w", err))
+	}
+	messages := make([]*Event, 0, to-from+1)
+	for index := from; index <= to; index++ {
+		message, err := broker.getOutEvent(stub, servicePair, index)
+		if err != nil {
+			return failResponse(err)
+		}
+		messages = append(messages, message)
+	}
+	v, err := json.Marshal(messages)
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(v)
+}
+
+// getInMessages servicePair,from,to returns the receipts of servicePair from
+// index from to index to, at most maxPageSize of them
+func (broker *Broker) getInMessages(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	servicePair, from, to, err := parsePage(args)
+	if err != nil {
+		return failResponse(fmt.Errorf("getInMessages: %w", err))
+	}
+	receipts := make([]*Receipt, 0, to-from+1)
+	for index := from; index <= to; index++ {
+		receipt, err := broker.getReceipt(stub, servicePair, index)
+		if err != nil {
+			return failResponse(err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	v, err := json.Marshal(receipts)
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(v)
+}
+
+// parsePage parses servicePair,from,to and cuts the range to maxPageSize
+func parsePage(args []string) (string, uint64, uint64, error) {
+	if len(args) != 3 {
+		return "", 0, 0, fmt.Errorf("incorrect number of arguments, expecting 3")
+	}
+	from, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("parse from index: %w", err)
+	}
+	to, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("parse to index: %w", err)
+	}
+	if from == 0 || from > to {
+		return "", 0, 0, fmt.Errorf("invalid index range [%d, %d]", from, to)
+	}
+	if to-from >= maxPageSize {
+		to = from + maxPageSize - 1
+	}
+	return args[0], from, to, nil
 }
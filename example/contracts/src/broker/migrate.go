@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// keys of the blobs which held every message before they were stored per
+// service pair and index
+const (
+	legacyOutMessages     = "out-messages"
+	legacyReceiptMessages = "receipt-messages"
+)
+
+type migrateResult struct {
+	OutMessages     uint64 `json:"out_messages"`
+	ReceiptMessages uint64 `json:"receipt_messages"`
+}
+
+// migrateMessages splits the legacy message blobs into one state key per
+// message and deletes the blobs. Messages already stored per index are kept,
+// so calling it again after a migration is a no-op. Legacy messages recorded
+// no transaction id and the state keeps no trace of the transaction emitting
+// them, so they are marked as migrated and the plugin refuses to prove them.
+func (broker *Broker) migrateMessages(stub shim.ChaincodeStubInterface) pb.Response {
+	result := &migrateResult{}
+
+	outBytes, err := stub.GetState(legacyOutMessages)
+	if err != nil {
+		return failResponse(err)
+	}
+	if outBytes != nil {
+		messages := make(map[string](map[uint64]Event))
+		if err := json.Unmarshal(outBytes, &messages); err != nil {
+			return failResponse(fmt.Errorf("unmarshal out messages: %w", err))
+		}
+		for servicePair, events := range messages {
+			for index, event := range events {
+				event := event
+				migrated, err := broker.migrated(stub, outMsgPrefix, servicePair, index)
+				if err != nil {
+					return failResponse(err)
+				}
+				if migrated {
+					continue
+				}
+				if event.TxID == "" {
+					event.Migrated = true
+				}
+				if err := broker.setOutEvent(stub, servicePair, index, &event); err != nil {
+					return failResponse(err)
+				}
+				result.OutMessages++
+			}
+		}
+		if err := stub.DelState(legacyOutMessages); err != nil {
+			return failResponse(err)
+		}
+	}
+
+	receiptBytes, err := stub.GetState(legacyReceiptMessages)
+	if err != nil {
+		return failResponse(err)
+	}
+	if receiptBytes != nil {
+		messages := make(map[string](map[uint64]Receipt))
+		if err := json.Unmarshal(receiptBytes, &messages); err != nil {
+			return failResponse(fmt.Errorf("unmarshal receipt messages: %w", err))
+		}
+		for servicePair, receipts := range messages {
+			for index, receipt := range receipts {
+				receipt := receipt
+				migrated, err := broker.migrated(stub, inMsgPrefix, servicePair, index)
+				if err != nil {
+					return failResponse(err)
+				}
+				if migrated {
+					continue
+				}
+				if receipt.TxID == "" {
+					receipt.Migrated = true
+				}
+				if err := broker.setReceipt(stub, servicePair, index, &receipt); err != nil {
+					return failResponse(err)
+				}
+				result.ReceiptMessages++
+			}
+		}
+		if err := stub.DelState(legacyReceiptMessages); err != nil {
+			return failResponse(err)
+		}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(data)
+}
+
+func (broker *Broker) migrated(stub shim.ChaincodeStubInterface, prefix, servicePair string, index uint64) (bool, error) {
+	var (
+		key string
+		err error
+	)
+	if prefix == outMsgPrefix {
+		key, err = broker.outMsgKey(stub, servicePair, index)
+	} else {
+		key, err = broker.inMsgKey(stub, servicePair, index)
+	}
+	if err != nil {
+		return false, err
+	}
+	value, err := stub.GetState(key)
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// migrateCounters moves the counters of the legacy meta blobs, which are
+// stored under the meta names as plain keys, to one key per service pair.
+// The greater index wins if a counter is already stored per service pair.
+func (broker *Broker) migrateCounters(stub shim.ChaincodeStubInterface) pb.Response {
+	migrated := make(map[string]uint64)
+	for _, metaName := range counterMetas {
+		meta, err := broker.getMap(stub, metaName)
+		if err != nil {
+			return failResponse(fmt.Errorf("get legacy %s: %w", metaName, err))
+		}
+		for servicePair, index := range meta {
+			counter, err := broker.getCounter(stub, metaName, servicePair)
+			if err != nil {
+				return failResponse(err)
+			}
+			if counter >= index {
+				continue
+			}
+			if err := broker.setCounter(stub, metaName, servicePair, index); err != nil {
+				return failResponse(err)
+			}
+			migrated[metaName]++
+		}
+		if err := stub.DelState(metaName); err != nil {
+			return failResponse(err)
+		}
+	}
+
+	data, err := json.Marshal(migrated)
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(data)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/msp"
+	pb "github.com/hyperledger/fabric/protos/peer"
+	"github.com/stretchr/testify/require"
+)
+
+const adminMSP = "Org1MSP"
+
+// mockPeer runs the chaincodes of one channel in process. The MockStub of
+// fabric 1.4 has no creator and drops the proposal when a chaincode calls
+// another one, while the broker reads both to tell who calls it, so every
+// chaincode runs on a mockStub keeping them for the whole transaction.
+type mockPeer struct {
+	t          *testing.T
+	stubs      map[string]*mockStub
+	identities map[string][]byte
+	txSeq      int
+	// event is the chaincode event of the last transaction
+	event *pb.ChaincodeEvent
+}
+
+// mockStub is a MockStub with the arguments, the creator and the proposal of
+// the transaction it runs in
+type mockStub struct {
+	*shim.MockStub
+	peer     *mockPeer
+	cc       shim.Chaincode
+	args     [][]byte
+	creator  []byte
+	proposal *pb.SignedProposal
+	event    *pb.ChaincodeEvent
+	// committed is the state before the transaction
+	committed map[string][]byte
+}
+
+func newMockPeer(t *testing.T) *mockPeer {
+	return &mockPeer{
+		t:          t,
+		stubs:      make(map[string]*mockStub),
+		identities: make(map[string][]byte),
+	}
+}
+
+// deploy instantiates cc as the chaincode name
+func (p *mockPeer) deploy(name string, cc shim.Chaincode, args ...string) {
+	stub := &mockStub{
+		MockStub: shim.NewMockStub(name, cc),
+		peer:     p,
+		cc:       cc,
+	}
+	stub.ChannelID = channelID
+	p.stubs[name] = stub
+
+	resp := p.send(adminMSP, name, args, cc.Init)
+	require.Equal(p.t, int32(shim.OK), resp.Status, resp.Message)
+}
+
+// upgrade runs Init of the chaincode name on its current state like an
+// upgrade of the chaincode does
+func (p *mockPeer) upgrade(name string, args ...string) pb.Response {
+	stub := p.stubs[name]
+	require.NotNil(p.t, stub, "chaincode %s is not deployed", name)
+
+	return p.send(adminMSP, name, args, stub.cc.Init)
+}
+
+// invoke sends a transaction of the admin client to the chaincode name
+func (p *mockPeer) invoke(name string, args ...string) pb.Response {
+	return p.invokeAs(adminMSP, name, args...)
+}
+
+// invokeAs sends a transaction of a client of mspID to the chaincode name
+func (p *mockPeer) invokeAs(mspID, name string, args ...string) pb.Response {
+	stub := p.stubs[name]
+	require.NotNil(p.t, stub, "chaincode %s is not deployed", name)
+
+	return p.send(mspID, name, args, stub.cc.Invoke)
+}
+
+// send runs handle on the stub of name in a new transaction, the states of
+// all chaincodes are restored when the transaction fails like fabric drops
+// the write set of an invalid transaction
+func (p *mockPeer) send(mspID, name string, args []string, handle func(shim.ChaincodeStubInterface) pb.Response) pb.Response {
+	p.txSeq++
+	txID := fmt.Sprintf("tx%d", p.txSeq)
+
+	states := make(map[string]map[string][]byte, len(p.stubs))
+	for n, stub := range p.stubs {
+		states[n] = copyState(stub.State)
+		stub.committed = states[n]
+	}
+
+	stub := p.stubs[name]
+	resp := stub.run(txID, p.identity(mspID), p.proposal(name), toArgs(args), handle)
+	p.event = stub.event
+	if resp.Status != shim.OK {
+		for n, stub := range p.stubs {
+			stub.restore(states[n])
+		}
+		p.event = nil
+	}
+
+	return resp
+}
+
+// identity returns the serialized identity of a client of mspID, whose
+// certificate is self signed
+func (p *mockPeer) identity(mspID string) []byte {
+	if id, ok := p.identities[mspID]; ok {
+		return id
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(p.t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(p.identities) + 1)),
+		Subject:      pkix.Name{CommonName: "Admin@" + mspID},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(p.t, err)
+	id, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+	require.Nil(p.t, err)
+
+	p.identities[mspID] = id
+	return id
+}
+
+// proposal returns a signed proposal invoking the chaincode name, which is all
+// the broker reads from it
+func (p *mockPeer) proposal(name string) *pb.SignedProposal {
+	input, err := proto.Marshal(&pb.ChaincodeInvocationSpec{
+		ChaincodeSpec: &pb.ChaincodeSpec{ChaincodeId: &pb.ChaincodeID{Name: name}},
+	})
+	require.Nil(p.t, err)
+	payload, err := proto.Marshal(&pb.ChaincodeProposalPayload{Input: input})
+	require.Nil(p.t, err)
+	proposal, err := proto.Marshal(&pb.Proposal{Payload: payload})
+	require.Nil(p.t, err)
+
+	return &pb.SignedProposal{ProposalBytes: proposal}
+}
+
+func (s *mockStub) run(txID string, creator []byte, proposal *pb.SignedProposal, args [][]byte, handle func(shim.ChaincodeStubInterface) pb.Response) pb.Response {
+	s.MockTransactionStart(txID)
+	defer s.MockTransactionEnd(txID)
+
+	s.args, s.creator, s.proposal, s.event = args, creator, proposal, nil
+	return handle(s)
+}
+
+func (s *mockStub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *mockStub) GetStringArgs() []string {
+	args := make([]string, 0, len(s.args))
+	for _, arg := range s.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (s *mockStub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// GetState reads the state before the transaction, fabric does not show the
+// writes of a transaction to its own reads
+func (s *mockStub) GetState(key string) ([]byte, error) {
+	return s.committed[key], nil
+}
+
+func (s *mockStub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+func (s *mockStub) GetSignedProposal() (*pb.SignedProposal, error) {
+	return s.proposal, nil
+}
+
+// SetEvent keeps the last event, fabric only keeps one event of a chaincode
+// in a transaction
+func (s *mockStub) SetEvent(name string, payload []byte) error {
+	s.event = &pb.ChaincodeEvent{EventName: name, Payload: payload}
+	return nil
+}
+
+// InvokeChaincode calls the chaincode name in the same transaction, with the
+// creator and the proposal of the transaction
+func (s *mockStub) InvokeChaincode(name string, args [][]byte, channel string) pb.Response {
+	callee, ok := s.peer.stubs[name]
+	if !ok || channel != s.ChannelID {
+		return shim.Error(fmt.Sprintf("chaincode %s is not deployed on channel %s", name, channel))
+	}
+	txID := s.TxID
+
+	return callee.run(txID, s.creator, s.proposal, args, callee.cc.Invoke)
+}
+
+func (s *mockStub) restore(state map[string][]byte) {
+	keys := make([]string, 0, len(state))
+	for key := range state {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	s.State = state
+	s.Keys = list.New()
+	for _, key := range keys {
+		s.Keys.PushBack(key)
+	}
+}
+
+func copyState(state map[string][]byte) map[string][]byte {
+	c := make(map[string][]byte, len(state))
+	for key, value := range state {
+		c[key] = value
+	}
+	return c
+}
+
+func toArgs(args []string) [][]byte {
+	b := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		b = append(b, []byte(arg))
+	}
+	return b
+}
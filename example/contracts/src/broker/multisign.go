@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const signatureLength = 65
+
+var secp256k1HalfN = new(big.Int).Rsh(btcec.S256().N, 1)
+
+// checkMultiSigns checks that at least val-threshold validators of the
+// validator-list signed hash, the signatures are r || s || v
+func (broker *Broker) checkMultiSigns(stub shim.ChaincodeStubInterface, hash []byte, multiSignatures [][]byte) error {
+	vList, err := broker.getValidatorList(stub)
+	if err != nil {
+		return err
+	}
+	if len(vList) == 0 {
+		return fmt.Errorf("no validator is registered")
+	}
+
+	threshold, err := broker.getValThreshold(stub)
+	if err != nil {
+		return err
+	}
+
+	validators := make(map[string]bool, len(vList))
+	for _, v := range vList {
+		validators[strings.ToLower(v)] = true
+	}
+
+	signers := make(map[string]bool)
+	for _, sig := range multiSignatures {
+		addr, err := recoverAddress(hash, sig)
+		if err != nil {
+			continue
+		}
+		if validators[addr] {
+			signers[addr] = true
+		}
+		if uint64(len(signers)) >= threshold {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%d of %d signatures from validators", len(signers), threshold)
+}
+
+// recoverAddress recovers the lower case hex address of the signer of hash
+func recoverAddress(hash, sig []byte) (string, error) {
+	if len(sig) != signatureLength {
+		return "", fmt.Errorf("invalid signature length %d", len(sig))
+	}
+	// bitxhub signs with v in {0, 1}, while {27, 28} is also accepted
+	v := sig[64]
+	if v < 27 {
+		v += 27
+	}
+	if v != 27 && v != 28 {
+		return "", fmt.Errorf("invalid signature recovery id %d", sig[64])
+	}
+	// reject malleable signatures like bitxhub does
+	if new(big.Int).SetBytes(sig[32:64]).Cmp(secp256k1HalfN) > 0 {
+		return "", fmt.Errorf("invalid signature s value")
+	}
+
+	compact := make([]byte, 0, signatureLength)
+	compact = append(compact, v)
+	compact = append(compact, sig[:64]...)
+	pubKey, _, err := btcec.RecoverCompact(btcec.S256(), compact, hash)
+	if err != nil {
+		return "", err
+	}
+
+	return "0x" + hex.EncodeToString(keccak256(pubKey.SerializeUncompressed()[1:])[12:]), nil
+}
+
+// validatorsChange rotates the bitxhub validators and the number of
+// signatures needed: args[0] is the comma separated addresses, args[1] is the
+// threshold
+func (broker *Broker) validatorsChange(stub shim.ChaincodeStubInterface, args []string) (func() error, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("incorrect number of arguments, expecting 2")
+	}
+
+	var validators []string
+	for _, v := range strings.Split(args[0], comma) {
+		v = strings.TrimSpace(v)
+		if !isAddress(v) {
+			return nil, fmt.Errorf("invalid validator address %s", v)
+		}
+		validators = append(validators, v)
+	}
+	threshold, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	if threshold == 0 || threshold > uint64(len(validators)) {
+		return nil, fmt.Errorf("threshold %d is out of range [1, %d]", threshold, len(validators))
+	}
+
+	return func() error {
+		if err := broker.setValidatorList(stub, validators); err != nil {
+			return err
+		}
+		return stub.PutState(valThreshold, []byte(args[1]))
+	}, nil
+}
+
+func isAddress(addr string) bool {
+	if !strings.HasPrefix(addr, "0x") && !strings.HasPrefix(addr, "0X") {
+		return false
+	}
+	b, err := hex.DecodeString(addr[2:])
+	return err == nil && len(b) == 20 && !bytes.Equal(b, make([]byte, 20))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// EmitOffChainDataRequest asks the remote service for data kept off chain.
+// args: dstFullID, req, callback function invoked with the response
+func (broker *Broker) EmitOffChainDataRequest(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 3 {
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 3")
+	}
+
+	dstFullID := args[0]
+	if _, _, _, err := parseChainServiceID(dstFullID); err != nil {
+		return failResponse(err)
+	}
+
+	cid, err := getChaincodeID(stub)
+	if err != nil {
+		return failResponse(err)
+	}
+	curFullID, err := broker.genFullServiceID(stub, cid)
+	if err != nil {
+		return failResponse(err)
+	}
+	servicePair := genServicePair(curFullID, dstFullID)
+
+	index, err := broker.getCounter(stub, offChainDataMeta, servicePair)
+	if err != nil {
+		return failResponse(err)
+	}
+
+	req := &OffChainDataRequest{
+		Index:    index + 1,
+		From:     curFullID,
+		To:       dstFullID,
+		Req:      []byte(args[1]),
+		CallBack: args[2],
+	}
+	reqBytes, err := json.Marshal(req)
+	if err != nil {
+		return failResponse(err)
+	}
+
+	key := broker.offChainReqKey(servicePair, strconv.FormatUint(req.Index, 10))
+	if err := stub.PutState(key, reqBytes); err != nil {
+		return failResponse(fmt.Errorf("put offchain data request: %w", err))
+	}
+	if err := broker.setCounter(stub, offChainDataMeta, servicePair, req.Index); err != nil {
+		return failResponse(fmt.Errorf("put offchain data meta: %w", err))
+	}
+	if err := stub.SetEvent(offChainDataEventName, reqBytes); err != nil {
+		return failResponse(fmt.Errorf("set event: %w", err))
+	}
+
+	return shim.Success([]byte(strconv.FormatUint(req.Index, 10)))
+}
+
+// submitOffChainData records the response of an off-chain data request and
+// notifies the requesting service through its callback.
+// args: from, to, index, typ, msg, path, hash, size
+func (broker *Broker) submitOffChainData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 8 {
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 8")
+	}
+
+	from := args[0]
+	to := args[1]
+	index, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("submit offchain data parse index error: %v", err.Error()))
+	}
+	typ, err := strconv.ParseUint(args[3], 10, 64)
+	if err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("submit offchain data parse typ error: %v", err.Error()))
+	}
+	size, err := strconv.ParseUint(args[7], 10, 64)
+	if err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("submit offchain data parse size error: %v", err.Error()))
+	}
+
+	servicePair := genServicePair(from, to)
+	idx := strconv.FormatUint(index, 10)
+	reqBytes, err := stub.GetState(broker.offChainReqKey(servicePair, idx))
+	if err != nil {
+		return failResponse(err)
+	}
+	if reqBytes == nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("offchain data request %s-%d does not exist", servicePair, index))
+	}
+	req := &OffChainDataRequest{}
+	if err := json.Unmarshal(reqBytes, req); err != nil {
+		return failResponse(err)
+	}
+
+	respKey := broker.offChainRespKey(servicePair, idx)
+	respBytes, err := stub.GetState(respKey)
+	if err != nil {
+		return failResponse(err)
+	}
+	if respBytes != nil {
+		return errorResponse(codeIndexApplied, fmt.Sprintf("offchain data request %s-%d has been responded", servicePair, index))
+	}
+
+	resp := &OffChainDataResponse{
+		Index: index,
+		From:  from,
+		To:    to,
+		Typ:   typ,
+		Msg:   args[4],
+		Path:  args[5],
+		Hash:  args[6],
+		Size:  size,
+	}
+	respBytes, err = json.Marshal(resp)
+	if err != nil {
+		return failResponse(err)
+	}
+	if err := stub.PutState(respKey, respBytes); err != nil {
+		return failResponse(err)
+	}
+
+	if req.CallBack == "" {
+		return successResponse(nil)
+	}
+
+	_, _, serviceID, err := parseChainServiceID(from)
+	if err != nil {
+		return failResponse(err)
+	}
+	splitedCID := strings.Split(serviceID, delimiter)
+	if len(splitedCID) != 2 {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("Target chaincode id %s is not valid", serviceID))
+	}
+
+	var funcArgs [][]byte
+	funcArgs = append(funcArgs, []byte(req.CallBack))
+	funcArgs = append(funcArgs, []byte(idx), req.Req, []byte(args[3]), []byte(resp.Msg), []byte(resp.Path), []byte(resp.Hash))
+	response := stub.InvokeChaincode(splitedCID[1], funcArgs, splitedCID[0])
+	if response.Status != shim.OK {
+		return errorResponse(codeCalleeFailed, fmt.Sprintf("invoke offchain data callback: %s", response.Message))
+	}
+
+	return successResponse(response.Payload)
+}
+
+func (broker *Broker) getOffChainDataMeta(stub shim.ChaincodeStubInterface) pb.Response {
+	return broker.getCountersResponse(stub, offChainDataMeta)
+}
+
+// getOffChainDataRequest servicePair,index
+func (broker *Broker) getOffChainDataRequest(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 2")
+	}
+	if _, err := strconv.ParseUint(args[1], 10, 64); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("getOffChainDataRequest parse index error: %v", err.Error()))
+	}
+	v, err := stub.GetState(broker.offChainReqKey(args[0], args[1]))
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(v)
+}
+
+// getOffChainDataResponse servicePair,index
+func (broker *Broker) getOffChainDataResponse(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return errorResponse(codeInvalidArgs, "incorrect number of arguments, expecting 2")
+	}
+	if _, err := strconv.ParseUint(args[1], 10, 64); err != nil {
+		return errorResponse(codeInvalidArgs, fmt.Sprintf("getOffChainDataResponse parse index error: %v", err.Error()))
+	}
+	v, err := stub.GetState(broker.offChainRespKey(args[0], args[1]))
+	if err != nil {
+		return failResponse(err)
+	}
+	return shim.Success(v)
+}
+
+func parseChainServiceID(id string) (string, string, string, error) {
+	splits := strings.Split(id, ":")
+	if len(splits) != 3 {
+		return "", "", "", fmt.Errorf("invalid chain service ID: %s", id)
+	}
+
+	return splits[0], splits[1], splits[2], nil
+}
@@ -15,8 +15,17 @@ const (
 	channelID               = "mychannel"
 	brokerContractName      = "broker"
 	emitInterchainEventFunc = "EmitInterchainEvent"
+	interchainEventName     = "interchain-event-name"
+	emitOffChainDataReqFunc = "EmitOffChainDataRequest"
 )
 
+type offChainData struct {
+	Typ  string `json:"typ"`
+	Msg  string `json:"msg"`
+	Path string `json:"path"`
+	Hash string `json:"hash"`
+}
+
 type DataSwapper struct{}
 
 func (s *DataSwapper) Init(stub shim.ChaincodeStubInterface) pb.Response {
@@ -38,6 +47,10 @@ func (s *DataSwapper) Invoke(stub shim.ChaincodeStubInterface) pb.Response {
 		return s.get(stub, args)
 	case "set":
 		return s.set(stub, args)
+	case "getOffChain":
+		return s.getOffChain(stub, args)
+	case "interchainOffChainSet":
+		return s.interchainOffChainSet(stub, args)
 	default:
 		return shim.Error("invalid function: " + function + ", args: " + strings.Join(args, ","))
 	}
@@ -87,6 +100,10 @@ func (s *DataSwapper) get(stub shim.ChaincodeStubInterface, args []string) pb.Re
 		if response.Status != shim.OK {
 			return shim.Error(fmt.Errorf("invoke broker chaincode %s error: %s", brokerContractName, response.Message).Error())
 		}
+		// events set in the broker are dropped by fabric, emit it here instead
+		if err := stub.SetEvent(interchainEventName, response.Payload); err != nil {
+			return shim.Error(err.Error())
+		}
 
 		return shim.Success(nil)
 	default:
@@ -122,6 +139,42 @@ func (s *DataSwapper) interchainGet(stub shim.ChaincodeStubInterface, args []str
 	return shim.Success(value)
 }
 
+// getOffChain asks the remote service for the data of key which is kept off chain
+func (s *DataSwapper) getOffChain(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 2 {
+		return shim.Error("incorrect number of arguments, expecting 2")
+	}
+	// args[0]: destination service id
+	// args[1]: key
+	b := util.ToChaincodeArgs(emitOffChainDataReqFunc, args[0], args[1], "interchainOffChainSet")
+	response := stub.InvokeChaincode(brokerContractName, b, channelID)
+	if response.Status != shim.OK {
+		return shim.Error(fmt.Errorf("invoke broker chaincode %s error: %s", brokerContractName, response.Message).Error())
+	}
+
+	return shim.Success(response.Payload)
+}
+
+// interchainOffChainSet is the callback function of off-chain data request,
+// it only keeps the location and hash of the data stored by the plugin
+func (s *DataSwapper) interchainOffChainSet(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	if len(args) != 6 {
+		return shim.Error("incorrect number of arguments, expecting 6")
+	}
+	// args: index, key, typ, msg, path, hash
+	data, err := json.Marshal(&offChainData{
+		Typ:  args[2],
+		Msg:  args[3],
+		Path: args[4],
+		Hash: args[5],
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return s.set(stub, []string{args[1], string(data)})
+}
+
 func main() {
 	err := shim.Start(new(DataSwapper))
 	if err != nil {
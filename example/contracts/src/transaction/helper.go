@@ -47,10 +47,32 @@ func (transaction *Transaction) onlyBroker(stub shim.ChaincodeStubInterface) boo
 	if err := proto.Unmarshal(payload.Input, spec); err != nil {
 		return false
 	}
-	if spec.ChaincodeSpec.ChaincodeId.Name != brokerContractName {
+	name, _, err := transaction.getBrokerContract(stub)
+	if err != nil {
 		return false
 	}
-	return true
+	return spec.ChaincodeSpec.ChaincodeId.Name == name
+}
+
+// getBrokerContract returns the name and the channel of the broker chaincode,
+// which defaults to the broker chaincode on the channel of the transaction
+// chaincode
+func (transaction *Transaction) getBrokerContract(stub shim.ChaincodeStubInterface) (string, string, error) {
+	name, err := stub.GetState(brokerContract)
+	if err != nil {
+		return "", "", err
+	}
+	channel, err := stub.GetState(brokerChannel)
+	if err != nil {
+		return "", "", err
+	}
+	if len(name) == 0 {
+		name = []byte(defaultBrokerContract)
+	}
+	if len(channel) == 0 {
+		channel = []byte(stub.GetChannelID())
+	}
+	return string(name), string(channel), nil
 }
 
 // putMap for persisting meta state into ledger
@@ -125,7 +147,7 @@ func (transaction *Transaction) getRemoteWhiteListMeta(stub shim.ChaincodeStubIn
 
 }
 
-func (transaction *Transaction) setStartTimeStampMeta(stub shim.ChaincodeStubInterface, startTimestamp map[string]timestamp.Timestamp) error {
+func (transaction *Transaction) setStartTimeStampMeta(stub shim.ChaincodeStubInterface, startTimestamp map[string]*timestamp.Timestamp) error {
 	startTimestampBytes, err := json.Marshal(startTimestamp)
 	if err != nil {
 		return err
@@ -133,12 +155,12 @@ func (transaction *Transaction) setStartTimeStampMeta(stub shim.ChaincodeStubInt
 	return stub.PutState(startTimestampMeta, startTimestampBytes)
 }
 
-func (transaction *Transaction) getStartTimeStampMeta(stub shim.ChaincodeStubInterface) (map[string]timestamp.Timestamp, error) {
+func (transaction *Transaction) getStartTimeStampMeta(stub shim.ChaincodeStubInterface) (map[string]*timestamp.Timestamp, error) {
 	startTimestampBytes, err := stub.GetState(startTimestampMeta)
 	if err != nil {
 		return nil, err
 	}
-	startTimestamp := make(map[string]timestamp.Timestamp)
+	startTimestamp := make(map[string]*timestamp.Timestamp)
 	if err := json.Unmarshal(startTimestampBytes, &startTimestamp); err != nil {
 		return nil, err
 	}
@@ -16,8 +16,9 @@ const (
 	remoteWhiteListMeta   = "remote-white-list"
 	transactionStatusMeta = "transaction-status"
 	startTimestampMeta    = "start-timestamp"
-	brokerContractName    = "broker"
-	channelID             = "mychannel"
+	brokerContract        = "broker-contract"
+	brokerChannel         = "broker-channel"
+	defaultBrokerContract = "broker"
 	colon                 = ":"
 	caret                 = "^"
 	hyphen                = "-"
@@ -32,13 +33,27 @@ type Appchain struct {
 	Exist     bool   `json:"exist"`
 }
 
+// TransactionConfig is the setup of the transaction chaincode returned by
+// getConfig, it names the broker calling it
+type TransactionConfig struct {
+	BrokerContract string `json:"broker_contract"`
+	BrokerChannel  string `json:"broker_channel"`
+}
+
 type Transaction struct{}
 
+// Init takes the same arguments as initialize after the function name, e.g.
+// {"Args":["init","broker","mychannel"]}
 func (transaction *Transaction) Init(stub shim.ChaincodeStubInterface) pb.Response {
 	err := transaction.initMap(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+
+	_, args := stub.GetFunctionAndParameters()
+	if err := transaction.setConfig(stub, args); err != nil {
+		return shim.Error(err.Error())
+	}
 	return shim.Success(nil)
 }
 
@@ -46,7 +61,7 @@ func (transaction *Transaction) initMap(stub shim.ChaincodeStubInterface) error
 	appchains := make(map[string]Appchain)
 	remoteWhiteList := make(map[string][]string)
 	transactionStatus := make(map[string]uint64)
-	startTimestamp := make(map[string]timestamp.Timestamp)
+	startTimestamp := make(map[string]*timestamp.Timestamp)
 
 	if err := transaction.setAppchainsMeta(stub, appchains); err != nil {
 		return err
@@ -77,7 +92,9 @@ func (transaction *Transaction) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 	fmt.Printf("invoke: %s\n", function)
 	switch function {
 	case "initialize":
-		return transaction.initialize(stub)
+		return transaction.initialize(stub, args)
+	case "getConfig":
+		return transaction.getConfig(stub)
 	case "registerAppchain":
 		return transaction.registerAppchain(stub, args)
 	case "getAppchainInfo":
@@ -107,15 +124,54 @@ func (transaction *Transaction) Invoke(stub shim.ChaincodeStubInterface) pb.Resp
 	}
 }
 
-func (transaction *Transaction) initialize(stub shim.ChaincodeStubInterface) pb.Response {
+func (transaction *Transaction) initialize(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	err := transaction.initMap(stub)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err := transaction.setConfig(stub, args); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(nil)
 }
 
+// setConfig persists the optional arguments of Init and initialize: the name
+// of the broker chaincode and its channel. The settings left out are kept.
+func (transaction *Transaction) setConfig(stub shim.ChaincodeStubInterface, args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("incorrect number of arguments, expecting at most 2")
+	}
+
+	if len(args) > 0 && args[0] != "" {
+		if err := stub.PutState(brokerContract, []byte(args[0])); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 && args[1] != "" {
+		if err := stub.PutState(brokerChannel, []byte(args[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (transaction *Transaction) getConfig(stub shim.ChaincodeStubInterface) pb.Response {
+	name, channel, err := transaction.getBrokerContract(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := json.Marshal(&TransactionConfig{
+		BrokerContract: name,
+		BrokerChannel:  channel,
+	})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(config)
+}
+
 func (transaction *Transaction) registerAppchain(stub shim.ChaincodeStubInterface, args []string) pb.Response {
 	if len(args) != 4 {
 		return shim.Error("incorrect number of arguments, expecting 4")
@@ -247,7 +303,7 @@ func (transaction *Transaction) startTransaction(stub shim.ChaincodeStubInterfac
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	startTimestamp[ibtpId] = *stamp
+	startTimestamp[ibtpId] = stamp
 	transaction.setStartTimeStampMeta(stub, startTimestamp)
 	return shim.Success(nil)
 
@@ -361,7 +417,7 @@ func (transaction *Transaction) getStartTimestamp(stub shim.ChaincodeStubInterfa
 		return shim.Error(err.Error())
 	}
 	res := make([]byte, 8)
-	binary.BigEndian.PutUint64(res, uint64(stamp.Seconds))
+	binary.BigEndian.PutUint64(res, uint64(stamp.GetSeconds()))
 	return shim.Success(res)
 }
 
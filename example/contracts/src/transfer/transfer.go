@@ -15,6 +15,7 @@ const (
 	channelID               = "mychannel"
 	brokerContractName      = "broker"
 	emitInterchainEventFunc = "EmitInterchainEvent"
+	interchainEventName     = "interchain-event-name"
 
 	ladingBillsCrossParamsMapKey = "ladingBillsOrigin"
 
@@ -252,6 +253,10 @@ func (t *Transfer) transferLadingBillCrossParams(stub shim.ChaincodeStubInterfac
 	if response.Status != shim.OK {
 		return shim.Error(fmt.Errorf("invoke broker chaincode: %d - %s", response.Status, response.Message).Error())
 	}
+	// events set in the broker are dropped by fabric, emit it here instead
+	if err := stub.SetEvent(interchainEventName, response.Payload); err != nil {
+		return shim.Error(err.Error())
+	}
 
 	//跨链转发期间，修改跨链状态为forward
 	crossChainStatusMap, err := t.getCrossChainStatusMap(stub)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/meshplus/pier-client-fabric/fakefabric"
+	"github.com/meshplus/pier-client-fabric/fakefabric/broker"
+	dataswapper "github.com/meshplus/pier-client-fabric/fakefabric/data_swapper"
+	"github.com/meshplus/pier-client-fabric/fakefabric/transfer"
+)
+
+// fakeChaincodes are the sample chaincodes the services of the fake backend
+// are picked from
+var fakeChaincodes = map[string]func() shim.Chaincode{
+	"transfer":     func() shim.Chaincode { return new(transfer.Transfer) },
+	"data_swapper": func() shim.Chaincode { return new(dataswapper.DataSwapper) },
+}
+
+// newBackend returns the backend selected by the config
+func newBackend(configPath string, config *Config, meta *ContractMeta) (Backend, error) {
+	switch config.Fabric.Backend {
+	case "", BackendSDK:
+		return newSDKBackend(configPath, meta)
+	case BackendFake:
+		return newFakeBackend(config)
+	default:
+		return nil, fmt.Errorf("unknown backend %s", config.Fabric.Backend)
+	}
+}
+
+// newFakeBackend runs an in-memory channel hosting the broker and the
+// chaincodes of the configured services. The broker is instantiated from the
+// broker section of the config, the services are registered and audited,
+// and the invokes of the fake section are sent at last.
+func newFakeBackend(config *Config) (*fakefabric.Fabric, error) {
+	if config.Broker.ValThreshold == 0 || len(config.Broker.Validators) == 0 {
+		return nil, fmt.Errorf("fake backend needs the addresses of bitxhub validators")
+	}
+	channelID := config.Fabric.ChannelId
+	ccID := config.Fabric.CCID
+
+	f, err := fakefabric.New(channelID)
+	if err != nil {
+		return nil, err
+	}
+	// the broker is set up by Init, the way it is instantiated on fabric
+	args := config.BrokerInstantiateArgs()
+	if err := f.Deploy(ccID, new(broker.Broker), util.ToChaincodeArgs(args...)...); err != nil {
+		return nil, err
+	}
+
+	for _, service := range config.Services {
+		name := service.Name
+		if i := strings.Index(service.ID, "&"); i != -1 {
+			name = service.ID[i+1:]
+		}
+		newChaincode, ok := fakeChaincodes[name]
+		if !ok {
+			return nil, fmt.Errorf("no sample chaincode for service %s", service.ID)
+		}
+		if err := f.Deploy(name, newChaincode()); err != nil {
+			return nil, err
+		}
+		if _, err := f.Execute(channel.Request{
+			ChaincodeID: name,
+			Fcn:         "register",
+			Args:        util.ToChaincodeArgs("false"),
+		}); err != nil {
+			return nil, fmt.Errorf("register service %s: %w", service.ID, err)
+		}
+		if _, err := f.Execute(channel.Request{
+			ChaincodeID: ccID,
+			Fcn:         "audit",
+			Args:        util.ToChaincodeArgs(channelID, name, "1"),
+		}); err != nil {
+			return nil, fmt.Errorf("audit service %s: %w", service.ID, err)
+		}
+	}
+
+	for _, invoke := range config.Fake.Invokes {
+		if _, err := f.Execute(channel.Request{
+			ChaincodeID: invoke.Chaincode,
+			Fcn:         invoke.Func,
+			Args:        util.ToChaincodeArgs(invoke.Args...),
+		}); err != nil {
+			return nil, fmt.Errorf("invoke %s of %s: %w", invoke.Func, invoke.Chaincode, err)
+		}
+	}
+
+	logger.Info("Fake fabric is up", "channel", channelID, "height", f.Height())
+	return f, nil
+}
@@ -0,0 +1,540 @@
+// Package fakefabric is an in-memory fabric network for the tests of the
+// plugin. Chaincodes run in process on shimtest.MockStub, every transaction
+// is committed in a block of its own, and the blocks are delivered to the
+// subscribers like the event service of a peer does.
+package fakefabric
+
+//go:generate bash ../scripts/gen_fake_broker.sh
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-chaincode-go/shimtest"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/pkg/fab/chconfig"
+	"github.com/hyperledger/fabric/protoutil"
+)
+
+// MSPID is the MSP of the identity sending every transaction
+const MSPID = "Org1MSP"
+
+// Fabric is a channel with the chaincodes deployed on it. It is safe for
+// concurrent use, transactions are executed one at a time.
+type Fabric struct {
+	lock      sync.Mutex
+	channelID string
+	creator   []byte
+	stubs     map[string]*shimtest.MockStub
+	blocks    []*common.Block
+	txBlocks  map[string]*common.Block
+	txSeq     uint64
+	subs      map[*registration]struct{}
+	closed    bool
+	// proposal is the signed proposal of the running transaction
+	proposal *peer.SignedProposal
+}
+
+// chaincode runs a deployed chaincode with the proposal of the running
+// transaction. The MockStub of a chaincode called by another one has an empty
+// proposal, while the broker reads it to tell which service calls it.
+type chaincode struct {
+	shim.Chaincode
+	fabric *Fabric
+}
+
+type proposalStub struct {
+	shim.ChaincodeStubInterface
+	proposal *peer.SignedProposal
+}
+
+type registration struct {
+	lock   sync.Mutex
+	filter fab.BlockFilter
+	events chan *fab.BlockEvent
+	closed bool
+}
+
+// New returns an empty channel channelID
+func New(channelID string) (*Fabric, error) {
+	creator, err := newCreator()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Fabric{
+		channelID: channelID,
+		creator:   creator,
+		stubs:     make(map[string]*shimtest.MockStub),
+		txBlocks:  make(map[string]*common.Block),
+		subs:      make(map[*registration]struct{}),
+	}, nil
+}
+
+// Deploy instantiates cc as chaincode name with args, every deployed
+// chaincode can invoke the others
+func (f *Fabric) Deploy(name string, cc shim.Chaincode, args ...[]byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if _, ok := f.stubs[name]; ok {
+		return fmt.Errorf("chaincode %s is already deployed", name)
+	}
+	stub := shimtest.NewMockStub(name, &chaincode{Chaincode: cc, fabric: f})
+	stub.ChannelID = f.channelID
+	stub.Creator = f.creator
+	for other, otherStub := range f.stubs {
+		stub.MockPeerChaincode(other, otherStub, f.channelID)
+		otherStub.MockPeerChaincode(name, stub, f.channelID)
+	}
+	f.stubs[name] = stub
+
+	res := stub.MockInit(f.nextTxID(), args)
+	if res.Status >= shim.ERRORTHRESHOLD {
+		delete(f.stubs, name)
+		return fmt.Errorf("init chaincode %s: %s", name, res.Message)
+	}
+	return nil
+}
+
+// Execute runs request in a transaction and commits it in a new block, the
+// state is left untouched if the chaincode fails
+func (f *Fabric) Execute(request channel.Request) (channel.Response, error) {
+	return f.InvokeFrom(request.ChaincodeID, request)
+}
+
+// InvokeFrom executes request as if chaincode caller called the chaincode of
+// request, which is how business chaincodes reach the broker
+func (f *Fabric) InvokeFrom(caller string, request channel.Request) (channel.Response, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	txID := f.nextTxID()
+	res, event, writes, err := f.invoke(txID, caller, request, true)
+	if err != nil {
+		return channel.Response{}, err
+	}
+
+	block, err := f.commit(txID, request.ChaincodeID, res, event, writes)
+	if err != nil {
+		return channel.Response{}, err
+	}
+	f.publish(block)
+
+	return channel.Response{
+		TransactionID:    fab.TransactionID(txID),
+		TxValidationCode: peer.TxValidationCode_VALID,
+		ChaincodeStatus:  res.Status,
+		Payload:          res.Payload,
+	}, nil
+}
+
+// Query runs request and discards its writes
+func (f *Fabric) Query(request channel.Request) (channel.Response, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	txID := f.nextTxID()
+	res, _, _, err := f.invoke(txID, request.ChaincodeID, request, false)
+	if err != nil {
+		return channel.Response{}, err
+	}
+
+	return channel.Response{
+		TransactionID:   fab.TransactionID(txID),
+		ChaincodeStatus: res.Status,
+		Payload:         res.Payload,
+	}, nil
+}
+
+func (f *Fabric) QueryBlockByTxID(txID fab.TransactionID) (*common.Block, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	block, ok := f.txBlocks[string(txID)]
+	if !ok {
+		return nil, status.New(status.EndorserServerStatus, int32(common.Status_NOT_FOUND),
+			fmt.Sprintf("transaction %s not found", txID), nil)
+	}
+	return block, nil
+}
+
+// QueryConfig returns a channel config without any MSP, since no transaction
+// of the fake fabric is endorsed
+func (f *Fabric) QueryConfig() (fab.ChannelCfg, error) {
+	return chconfig.NewChannelCfg(f.channelID), nil
+}
+
+// RegisterBlockEvent delivers the blocks committed from now on which pass
+// filter
+func (f *Fabric) RegisterBlockEvent(filter ...fab.BlockFilter) (fab.Registration, <-chan *fab.BlockEvent, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.closed {
+		return nil, nil, fmt.Errorf("fabric is closed")
+	}
+	reg := &registration{
+		filter: func(*common.Block) bool { return true },
+		events: make(chan *fab.BlockEvent, 1024),
+	}
+	if len(filter) != 0 {
+		reg.filter = filter[0]
+	}
+	f.subs[reg] = struct{}{}
+	return reg, reg.events, nil
+}
+
+func (f *Fabric) Unregister(reg fab.Registration) {
+	r, ok := reg.(*registration)
+	if !ok {
+		return
+	}
+
+	f.lock.Lock()
+	delete(f.subs, r)
+	f.lock.Unlock()
+
+	r.close()
+}
+
+// Close unregisters every subscriber
+func (f *Fabric) Close() {
+	f.lock.Lock()
+	subs := f.subs
+	f.subs = make(map[*registration]struct{})
+	f.closed = true
+	f.lock.Unlock()
+
+	for reg := range subs {
+		reg.close()
+	}
+}
+
+// Height returns the number of blocks
+func (f *Fabric) Height() uint64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return uint64(len(f.blocks))
+}
+
+func (f *Fabric) nextTxID() string {
+	f.txSeq++
+	return fmt.Sprintf("tx%08d", f.txSeq)
+}
+
+// invoke calls the chaincode of request with a proposal from caller. The
+// state of every chaincode is restored if the chaincode fails or if the
+// writes are not kept. Only the event of the called chaincode is returned,
+// since fabric drops the events of chaincodes it calls.
+func (f *Fabric) invoke(txID, caller string, request channel.Request, keep bool) (peer.Response, *peer.ChaincodeEvent, map[string][]*kvrwset.KVWrite, error) {
+	stub, ok := f.stubs[request.ChaincodeID]
+	if !ok {
+		return peer.Response{}, nil, nil, status.New(status.EndorserClientStatus, int32(status.ChaincodeNameNotFound),
+			fmt.Sprintf("chaincode %s not found", request.ChaincodeID), nil)
+	}
+
+	sp, err := f.signedProposal(txID, caller)
+	if err != nil {
+		return peer.Response{}, nil, nil, err
+	}
+
+	snapshots := make(map[string]map[string][]byte, len(f.stubs))
+	for name, s := range f.stubs {
+		snapshots[name] = copyState(s.State)
+	}
+
+	args := append([][]byte{[]byte(request.Fcn)}, request.Args...)
+	f.proposal = sp
+	res := stub.MockInvokeWithSignedProposal(txID, args, sp)
+	f.proposal = nil
+
+	var event *peer.ChaincodeEvent
+	for name, s := range f.stubs {
+		for drained := false; !drained; {
+			select {
+			case e := <-s.ChaincodeEventsChannel:
+				if name == request.ChaincodeID {
+					event = e
+				}
+			default:
+				drained = true
+			}
+		}
+	}
+
+	writes := make(map[string][]*kvrwset.KVWrite)
+	for name, s := range f.stubs {
+		writes[name] = diffState(snapshots[name], s.State)
+	}
+
+	if res.Status >= shim.ERRORTHRESHOLD || !keep {
+		for name, s := range f.stubs {
+			restoreState(s, snapshots[name])
+		}
+	}
+	if res.Status >= shim.ERRORTHRESHOLD {
+		return res, nil, nil, status.New(status.ChaincodeStatus, res.Status, res.Message, nil)
+	}
+
+	if event != nil {
+		event.ChaincodeId = request.ChaincodeID
+		event.TxId = txID
+	}
+	return res, event, writes, nil
+}
+
+func (f *Fabric) signedProposal(txID, caller string) (*peer.SignedProposal, error) {
+	input, err := proto.Marshal(&peer.ChaincodeInvocationSpec{
+		ChaincodeSpec: &peer.ChaincodeSpec{
+			ChaincodeId: &peer.ChaincodeID{Name: caller},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&peer.ChaincodeProposalPayload{Input: input})
+	if err != nil {
+		return nil, err
+	}
+	header, err := f.header(txID)
+	if err != nil {
+		return nil, err
+	}
+	proposal, err := proto.Marshal(&peer.Proposal{Header: header, Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+
+	return &peer.SignedProposal{ProposalBytes: proposal}, nil
+}
+
+func (f *Fabric) header(txID string) ([]byte, error) {
+	hdr, err := f.payloadHeader(txID)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(hdr)
+}
+
+func (f *Fabric) payloadHeader(txID string) (*common.Header, error) {
+	chdr, err := proto.Marshal(&common.ChannelHeader{
+		Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
+		ChannelId: f.channelID,
+		TxId:      txID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	shdr, err := proto.Marshal(&common.SignatureHeader{Creator: f.creator})
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.Header{ChannelHeader: chdr, SignatureHeader: shdr}, nil
+}
+
+// commit appends a block holding the endorser transaction txID
+func (f *Fabric) commit(txID, ccID string, res peer.Response, event *peer.ChaincodeEvent, writes map[string][]*kvrwset.KVWrite) (*common.Block, error) {
+	results, err := marshalWrites(writes)
+	if err != nil {
+		return nil, err
+	}
+	var events []byte
+	if event != nil {
+		if events, err = proto.Marshal(event); err != nil {
+			return nil, err
+		}
+	}
+	extension, err := proto.Marshal(&peer.ChaincodeAction{
+		Results:     results,
+		Events:      events,
+		Response:    &res,
+		ChaincodeId: &peer.ChaincodeID{Name: ccID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	prp, err := proto.Marshal(&peer.ProposalResponsePayload{Extension: extension})
+	if err != nil {
+		return nil, err
+	}
+	actionPayload, err := proto.Marshal(&peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: prp},
+	})
+	if err != nil {
+		return nil, err
+	}
+	hdr, err := f.payloadHeader(txID)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := proto.Marshal(&peer.Transaction{
+		Actions: []*peer.TransactionAction{{Header: hdr.SignatureHeader, Payload: actionPayload}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&common.Payload{Header: hdr, Data: tx})
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := proto.Marshal(&common.Envelope{Payload: payload})
+	if err != nil {
+		return nil, err
+	}
+
+	var prevHash []byte
+	if len(f.blocks) != 0 {
+		prevHash = protoutil.BlockHeaderHash(f.blocks[len(f.blocks)-1].Header)
+	}
+	block := protoutil.NewBlock(uint64(len(f.blocks)), prevHash)
+	block.Data.Data = [][]byte{envelope}
+	block.Header.DataHash = protoutil.BlockDataHash(block.Data)
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = []byte{byte(peer.TxValidationCode_VALID)}
+
+	f.blocks = append(f.blocks, block)
+	f.txBlocks[txID] = block
+	return block, nil
+}
+
+func (f *Fabric) publish(block *common.Block) {
+	for reg := range f.subs {
+		if reg.filter(block) {
+			reg.send(&fab.BlockEvent{Block: block})
+		}
+	}
+}
+
+// send drops the block if the subscriber falls too far behind, like the event
+// service of the sdk does
+func (c *chaincode) Invoke(stub shim.ChaincodeStubInterface) peer.Response {
+	return c.Chaincode.Invoke(&proposalStub{ChaincodeStubInterface: stub, proposal: c.fabric.proposal})
+}
+
+func (s *proposalStub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return s.proposal, nil
+}
+
+func (r *registration) send(ev *fab.BlockEvent) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		return
+	}
+	select {
+	case r.events <- ev:
+	default:
+	}
+}
+
+func (r *registration) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		close(r.events)
+	}
+}
+
+func marshalWrites(writes map[string][]*kvrwset.KVWrite) ([]byte, error) {
+	txRWSet := &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV}
+	for namespace, kvWrites := range writes {
+		if len(kvWrites) == 0 {
+			continue
+		}
+		kvRWSet, err := proto.Marshal(&kvrwset.KVRWSet{Writes: kvWrites})
+		if err != nil {
+			return nil, err
+		}
+		txRWSet.NsRwset = append(txRWSet.NsRwset, &rwset.NsReadWriteSet{Namespace: namespace, Rwset: kvRWSet})
+	}
+	return proto.Marshal(txRWSet)
+}
+
+func copyState(state map[string][]byte) map[string][]byte {
+	c := make(map[string][]byte, len(state))
+	for k, v := range state {
+		c[k] = v
+	}
+	return c
+}
+
+func diffState(before, after map[string][]byte) []*kvrwset.KVWrite {
+	var writes []*kvrwset.KVWrite
+	for k, v := range after {
+		if old, ok := before[k]; !ok || string(old) != string(v) {
+			writes = append(writes, &kvrwset.KVWrite{Key: k, Value: v})
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			writes = append(writes, &kvrwset.KVWrite{Key: k, IsDelete: true})
+		}
+	}
+	return writes
+}
+
+// restoreState puts the state of stub back to state, the keys of a MockStub
+// are kept in a sorted list for range queries
+func restoreState(stub *shimtest.MockStub, state map[string][]byte) {
+	stub.State = state
+	keys := list.New()
+	for k := range state {
+		elem := keys.Front()
+		for elem != nil && elem.Value.(string) < k {
+			elem = elem.Next()
+		}
+		if elem == nil {
+			keys.PushBack(k)
+		} else {
+			keys.InsertBefore(k, elem)
+		}
+	}
+	stub.Keys = keys
+}
+
+// newCreator builds the serialized identity of a self signed certificate
+// of MSPID, which is enough for the client identity library of chaincodes
+func newCreator() ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Admin@org1.example.com", Organization: []string{"org1.example.com"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   MSPID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+// messagePageSize is the number of messages fetched by one call of the broker.
+// It matches maxPageSize of the broker, a broker cutting pages shorter only
+// costs more calls since the rest of a short page is fetched again.
+const messagePageSize = 100
+
+type fetchResult struct {
+	ibtps []*pb.IBTP
+	err   error
+}
+
+// fetchOrdered fetches the ibtps of servicePair from index from to index to in
+// pages of pageSize, with at most workers pages in flight, and emits them in
+// index order. The rest of a page returned short is fetched again, while a page
+// holding more ibtps than asked is rejected. It stops at the first ibtp failing
+// to be fetched or emitted and returns its index, the ibtps before it are
+// emitted already.
+func fetchOrdered(servicePair string, from, to, pageSize uint64, workers int, fetch func(string, uint64, uint64) ([]*pb.IBTP, error), emit func(*pb.IBTP) error) (uint64, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	if pageSize < 1 {
+		pageSize = 1
+	}
+
+	pageEnd := func(start uint64) uint64 {
+		if to-start < pageSize {
+			return to
+		}
+		return start + pageSize - 1
+	}
+
+	// results are buffered, so the fetches still in flight after a failure
+	// finish without blocking
+	pending := make([]chan fetchResult, 0, workers)
+	next := from
+	for start := from; start <= to; start = pageEnd(start) + 1 {
+		for next <= to && len(pending) < workers {
+			resultC := make(chan fetchResult, 1)
+			go func(start, end uint64) {
+				ibtps, err := fetch(servicePair, start, end)
+				resultC <- fetchResult{ibtps: ibtps, err: err}
+			}(next, pageEnd(next))
+			pending = append(pending, resultC)
+			next = pageEnd(next) + 1
+		}
+
+		result := <-pending[0]
+		pending = pending[1:]
+		end := pageEnd(start)
+		for index := start; ; {
+			if result.err != nil {
+				return index, result.err
+			}
+			if uint64(len(result.ibtps)) > end-index+1 {
+				return index, fmt.Errorf("got %d ibtps of page [%d, %d]", len(result.ibtps), index, end)
+			}
+			for _, ibtp := range result.ibtps {
+				if ibtp.Index != index {
+					return index, fmt.Errorf("got ibtp of index %d, expect %d", ibtp.Index, index)
+				}
+				if err := emit(ibtp); err != nil {
+					return index, err
+				}
+				index++
+			}
+			if index > end {
+				break
+			}
+			if len(result.ibtps) == 0 {
+				return index, fmt.Errorf("got no ibtp of page [%d, %d]", index, end)
+			}
+			result.ibtps, result.err = fetch(servicePair, index, end)
+		}
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/stretchr/testify/require"
+)
+
+// testFetcher serves the ibtps of indexes up to last, pages are cut to limit
+// like the broker cuts them to its page size
+type testFetcher struct {
+	last  uint64
+	limit uint64
+	// extra is appended to every page
+	extra int
+	// fail fails the fetches starting at the index
+	fail map[uint64]error
+
+	mu    sync.Mutex
+	pages [][2]uint64
+}
+
+func (f *testFetcher) fetch(_ string, from, to uint64) ([]*pb.IBTP, error) {
+	f.mu.Lock()
+	f.pages = append(f.pages, [2]uint64{from, to})
+	f.mu.Unlock()
+	// later pages tend to return first
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+
+	if err, ok := f.fail[from]; ok {
+		return nil, err
+	}
+	if f.limit != 0 && to-from >= f.limit {
+		to = from + f.limit - 1
+	}
+	if to > f.last {
+		to = f.last
+	}
+	var ibtps []*pb.IBTP
+	for i := from; i <= to+uint64(f.extra); i++ {
+		ibtps = append(ibtps, &pb.IBTP{Index: i})
+	}
+	return ibtps, nil
+}
+
+type testEmitter struct {
+	indexes []uint64
+	fail    uint64
+}
+
+func (e *testEmitter) emit(ibtp *pb.IBTP) error {
+	if ibtp.Index == e.fail {
+		return fmt.Errorf("emit %d", ibtp.Index)
+	}
+	e.indexes = append(e.indexes, ibtp.Index)
+	return nil
+}
+
+func indexes(from, to uint64) []uint64 {
+	var ret []uint64
+	for i := from; i <= to; i++ {
+		ret = append(ret, i)
+	}
+	return ret
+}
+
+func TestFetchOrdered(t *testing.T) {
+	f := &testFetcher{last: 10}
+	e := &testEmitter{}
+	failed, err := fetchOrdered("pair", 1, 10, 3, 4, f.fetch, e.emit)
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), failed)
+	require.Equal(t, indexes(1, 10), e.indexes)
+	require.ElementsMatch(t, [][2]uint64{{1, 3}, {4, 6}, {7, 9}, {10, 10}}, f.pages)
+
+	// one page of the whole range
+	f = &testFetcher{last: 10}
+	e = &testEmitter{}
+	_, err = fetchOrdered("pair", 3, 7, 100, 4, f.fetch, e.emit)
+	require.Nil(t, err)
+	require.Equal(t, indexes(3, 7), e.indexes)
+	require.Equal(t, [][2]uint64{{3, 7}}, f.pages)
+}
+
+func TestFetchOrderedShortPage(t *testing.T) {
+	// the rest of a page cut short is fetched again
+	f := &testFetcher{last: 10, limit: 2}
+	e := &testEmitter{}
+	_, err := fetchOrdered("pair", 1, 10, 5, 2, f.fetch, e.emit)
+	require.Nil(t, err)
+	require.Equal(t, indexes(1, 10), e.indexes)
+	require.ElementsMatch(t, [][2]uint64{{1, 5}, {3, 5}, {5, 5}, {6, 10}, {8, 10}, {10, 10}}, f.pages)
+
+	// the messages end before the range
+	f = &testFetcher{last: 7}
+	e = &testEmitter{}
+	failed, err := fetchOrdered("pair", 1, 10, 5, 2, f.fetch, e.emit)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "got no ibtp of page [8, 10]")
+	require.Equal(t, uint64(8), failed)
+	require.Equal(t, indexes(1, 7), e.indexes)
+}
+
+func TestFetchOrderedOversizedPage(t *testing.T) {
+	f := &testFetcher{last: 10, extra: 1}
+	e := &testEmitter{}
+	failed, err := fetchOrdered("pair", 1, 10, 5, 2, f.fetch, e.emit)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "got 6 ibtps of page [1, 5]")
+	require.Equal(t, uint64(1), failed)
+	require.Empty(t, e.indexes)
+}
+
+func TestFetchOrderedFailure(t *testing.T) {
+	// the pages before a failed fetch are emitted
+	f := &testFetcher{last: 10, fail: map[uint64]error{4: fmt.Errorf("fetch")}}
+	e := &testEmitter{}
+	failed, err := fetchOrdered("pair", 1, 10, 3, 4, f.fetch, e.emit)
+	require.NotNil(t, err)
+	require.Equal(t, uint64(4), failed)
+	require.Equal(t, indexes(1, 3), e.indexes)
+
+	// the ibtps before a failed emit are emitted
+	f = &testFetcher{last: 10}
+	e = &testEmitter{fail: 5}
+	failed, err = fetchOrdered("pair", 1, 10, 3, 4, f.fetch, e.emit)
+	require.NotNil(t, err)
+	require.Equal(t, uint64(5), failed)
+	require.Equal(t, indexes(1, 4), e.indexes)
+
+	// a page out of order
+	e = &testEmitter{}
+	fetch := func(servicePair string, from, to uint64) ([]*pb.IBTP, error) {
+		return []*pb.IBTP{{Index: from + 1}}, nil
+	}
+	failed, err = fetchOrdered("pair", 1, 10, 3, 4, fetch, e.emit)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "got ibtp of index 2, expect 1")
+	require.Equal(t, uint64(1), failed)
+	require.Empty(t, e.indexes)
+}
@@ -3,7 +3,7 @@ module github.com/meshplus/pier-client-fabric
 go 1.13
 
 require (
-	github.com/Rican7/retry v0.1.0
+	github.com/btcsuite/btcd v0.21.0-beta
 	github.com/cloudflare/cfssl v1.4.1
 	github.com/ethereum/go-ethereum v1.10.4
 	github.com/fatih/color v1.9.0
@@ -23,7 +23,10 @@ require (
 	github.com/meshplus/bitxhub-model v1.2.1-0.20220803022708-9ab7a71abdbf
 	github.com/meshplus/pier v1.24.1-0.20220803023357-8533944f0d08
 	github.com/spf13/viper v1.7.1
+	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli v1.22.1
+	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 replace (
@@ -0,0 +1,35 @@
+// Package testutil plays the part of bitxhub for the tests and the simulate
+// command, which have to sign ibtps the way bitxhub validators do.
+package testutil
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+// SignIBTP signs the message the broker checks for an ibtp, which is packed
+// from the service pair, the index, the type, the hash of the content and the
+// status of the transaction on bitxhub
+func SignIBTP(key *ecdsa.PrivateKey, from, to string, index uint64, typ pb.IBTP_Type, content [][]byte, txStatus pb.TransactionStatus) ([]byte, error) {
+	var packed, contentPacked []byte
+	packed = append(packed, []byte(from)...)
+	packed = append(packed, []byte(to)...)
+	packed = append(packed, uint64Bytes(index)...)
+	packed = append(packed, uint64Bytes(uint64(typ))...)
+	for _, c := range content {
+		contentPacked = append(contentPacked, c...)
+	}
+	packed = append(packed, crypto.Keccak256(contentPacked)...)
+	packed = append(packed, uint64Bytes(uint64(txStatus))...)
+
+	return crypto.Sign(crypto.Keccak256(packed), key)
+}
+
+func uint64Bytes(i uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, i)
+	return b
+}
@@ -6,17 +6,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"strconv"
 	"time"
 
 	"github.com/fatih/color"
 	"github.com/gobuffalo/packd"
 	"github.com/gobuffalo/packr"
 	"github.com/hashicorp/go-plugin"
-	"github.com/hyperledger/fabric-sdk-go/pkg/client/ledger"
-	"github.com/hyperledger/fabric-sdk-go/pkg/core/config"
-	"github.com/hyperledger/fabric-sdk-go/pkg/fabsdk"
-	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
 	"github.com/meshplus/pier/pkg/plugins"
 	"github.com/urfave/cli"
 )
@@ -30,9 +25,16 @@ var initCMD = cli.Command{
 			Usage:    "Specify where to put the default configuration files",
 			Required: false,
 		},
+		cli.BoolFlag{
+			Name:  "instantiate-args",
+			Usage: "Print the instantiate args of broker and transaction chaincodes from the configuration under target instead",
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		target := ctx.String("target")
+		if ctx.Bool("instantiate-args") {
+			return printInstantiateArgs(target)
+		}
 		box := packr.NewBox("config")
 
 		if err := box.Walk(func(s string, file packd.File) error {
@@ -53,15 +55,51 @@ var initCMD = cli.Command{
 	},
 }
 
-var getValidator = cli.Command{
+// printInstantiateArgs prints the args matching the configuration under
+// configPath, they are passed to peer chaincode instantiate by -c
+func printInstantiateArgs(configPath string) error {
+	config, err := UnmarshalConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("unmarshal config for plugin :%w", err)
+	}
+
+	for _, cc := range []struct {
+		name string
+		args []string
+	}{
+		{config.Fabric.CCID, config.BrokerInstantiateArgs()},
+		{config.Broker.TransactionContract, config.TransactionInstantiateArgs()},
+	} {
+		args, err := json.Marshal(map[string][]string{"Args": cc.args})
+		if err != nil {
+			return err
+		}
+		color.Green("Instantiate args of chaincode %s:", cc.name)
+		fmt.Println(string(args))
+	}
+
+	return nil
+}
+
+var validatorCMD = cli.Command{
 	Name:  "validator",
-	Usage: "Get fabric validator info",
+	Usage: "Generate the validators file used to register fabric appchain",
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name:     "config",
 			Usage:    "Specify config addr",
 			Required: true,
 		},
+		cli.StringFlag{
+			Name:     "policy",
+			Usage:    "Specify endorsement policy of broker chaincode, e.g. AND('Org1MSP.peer','Org2MSP.peer'), read from chaincode definition if not set",
+			Required: false,
+		},
+		cli.StringFlag{
+			Name:     "output",
+			Usage:    "Specify where to put the validators file, default to fabric.validators under config addr",
+			Required: false,
+		},
 	},
 	Action: func(ctx *cli.Context) error {
 		configPath := ctx.String("config")
@@ -76,59 +114,34 @@ var getValidator = cli.Command{
 			ChannelID: fabricConfig.ChannelId,
 			ORG:       fabricConfig.Org,
 		}
-		configProvider := config.FromFile(filepath.Join(configPath, "config.yaml"))
-		sdk, err := fabsdk.New(configProvider)
-		if err != nil {
-			return fmt.Errorf("create sdk fail: %s\n", err)
-		}
-
-		channelProvider := sdk.ChannelContext(contractmeta.ChannelID, fabsdk.WithUser(contractmeta.Username), fabsdk.WithOrg(contractmeta.ORG))
-
-		l, err := ledger.New(channelProvider)
+		backend, err := newSDKBackend(configPath, contractmeta)
 		if err != nil {
 			return err
 		}
-		// Get Fabric Channel Config
-		conf, err := l.QueryConfig()
-		if err != nil {
-			return err
-		}
-		// Generate Policy Bytes
-		policy, err := cauthdsl.FromString("AND('Org2MSP.peer', 'Org1MSP.peer')")
-		if err != nil {
-			return err
+		defer backend.Close()
+
+		policy := ctx.String("policy")
+		if policy == "" {
+			policy = fabricConfig.Policy
 		}
-		siz := policy.XXX_Size()
-		b := make([]byte, 0, siz)
-		pBytes, err := policy.XXX_Marshal(b, false)
+		validator, err := queryValidator(backend, contractmeta.ChannelID, contractmeta.CCID, policy, fabricConfig.OrdererPolicy)
 		if err != nil {
 			return err
 		}
-		if err := ioutil.WriteFile("policy", []byte(string(pBytes)), 777); err != nil {
-			return err
-		}
-		validator := &Validator{
-			Cid:     contractmeta.CCID,
-			ChainId: "",
-			Policy:  string(pBytes),
-		}
-		// Generate MSP config bytes
-		var confStrs []string
-		for i, value := range conf.MSPs() {
-			confStrs = append(confStrs, value.String())
-			err := ioutil.WriteFile("conf"+strconv.Itoa(i), []byte(value.String()), 777)
-			if err != nil {
-				return err
-			}
-		}
-		validator.ConfByte = confStrs
 		validatorBytes, err := json.Marshal(validator)
 		if err != nil {
 			return err
 		}
-		if err := ioutil.WriteFile("validator", validatorBytes, 777); err != nil {
+
+		output := ctx.String("output")
+		if output == "" {
+			output = filepath.Join(configPath, "fabric.validators")
+		}
+		if err := ioutil.WriteFile(output, validatorBytes, 0644); err != nil {
 			return err
 		}
+		color.Green("Validators of chaincode %s is written to %s", contractmeta.CCID, output)
+
 		return nil
 	},
 }
@@ -161,6 +174,8 @@ func main() {
 	app.Commands = []cli.Command{
 		initCMD,
 		startCMD,
+		validatorCMD,
+		simulateCMD,
 	}
 
 	err := app.Run(os.Args)
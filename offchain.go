@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+var ErrDataOutOfSize = errors.New("off-chain data out of size")
+
+// DataStore keeps the data exchanged through off-chain data transmission.
+// The plugin serves remote requests from one store and saves the data it
+// receives into another, so received data is never served back.
+type DataStore interface {
+	// Get gets the data of key, ErrDataOutOfSize is returned if it exceeds the limit
+	Get(key string) ([]byte, error)
+
+	// Put stores data under key and returns the location of it
+	Put(key string, data []byte) (string, error)
+}
+
+type OffChainDataRequest struct {
+	Index    uint64 `json:"index"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Req      []byte `json:"req"`
+	CallBack string `json:"callback"`
+}
+
+// FileStore is a DataStore backed by a local directory
+type FileStore struct {
+	root    string
+	maxSize int64
+}
+
+func NewFileStore(root string, maxSize int64) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("create off-chain data directory: %w", err)
+	}
+
+	return &FileStore{
+		root:    root,
+		maxSize: maxSize,
+	}, nil
+}
+
+func (s *FileStore) Get(key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("off-chain data %s is a directory", key)
+	}
+	if s.maxSize > 0 && info.Size() > s.maxSize {
+		return nil, ErrDataOutOfSize
+	}
+
+	return ioutil.ReadFile(p)
+}
+
+func (s *FileStore) Put(key string, data []byte) (string, error) {
+	if s.maxSize > 0 && int64(len(data)) > s.maxSize {
+		return "", ErrDataOutOfSize
+	}
+
+	p, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return "", err
+	}
+
+	// write to a temporary file first so that readers never see partial data
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return "", err
+	}
+
+	return p, nil
+}
+
+// path resolves key inside root and rejects keys escaping from it
+func (s *FileStore) path(key string) (string, error) {
+	if key == "" || filepath.IsAbs(key) {
+		return "", fmt.Errorf("invalid off-chain data key: %s", key)
+	}
+	p := filepath.Join(s.root, filepath.Clean(key))
+	rel, err := filepath.Rel(s.root, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid off-chain data key: %s", key)
+	}
+
+	return p, nil
+}
+
+func (c *Client) GetOffChainData(request *pb.GetDataRequest) (*pb.GetDataResponse, error) {
+	ret := &pb.GetDataResponse{
+		Index: request.Index,
+		From:  request.From,
+		To:    request.To,
+		Type:  pb.GetDataResponse_DATA_GET_SUCCESS,
+	}
+
+	data, err := c.dataStore.Get(string(request.Req))
+	if err != nil {
+		if errors.Is(err, ErrDataOutOfSize) {
+			ret.Type = pb.GetDataResponse_DATA_OUT_OF_SIZE
+		} else {
+			ret.Type = pb.GetDataResponse_DATA_GET_INTERNAL_ERR
+		}
+		ret.Msg = err.Error()
+		return ret, nil
+	}
+	ret.Data = data
+
+	return ret, nil
+}
+
+func (c *Client) GetOffChainDataReq() chan *pb.GetDataRequest {
+	return c.dataReqC
+}
+
+func (c *Client) SubmitOffChainData(response *pb.GetDataResponse) error {
+	var (
+		path string
+		hash string
+		size int
+		msg  = response.Msg
+	)
+	if response.Type == pb.GetDataResponse_DATA_GET_SUCCESS {
+		sum := sha256.Sum256(response.Data)
+		hash = hex.EncodeToString(sum[:])
+		size = len(response.Data)
+
+		key := filepath.Join(offChainDataDir(response.From, response.To), strconv.FormatUint(response.Index, 10))
+		p, err := c.receiveStore.Put(key, response.Data)
+		if err != nil {
+			return fmt.Errorf("store off-chain data: %w", err)
+		}
+		path = p
+	}
+
+	args := util.ToChaincodeArgs(response.From, response.To, strconv.FormatUint(response.Index, 10),
+		strconv.FormatUint(uint64(response.Type), 10), msg, path, hash, strconv.Itoa(size))
+	request := channel.Request{
+		ChaincodeID: c.meta.CCID,
+		Fcn:         SubmitOffChainDataMethod,
+		Args:        args,
+	}
+
+	resp := &Response{}
+	res, err := c.execute(retrySubmitOffChain, request)
+	if err != nil {
+		rejected, ok := rejection(err)
+		if !ok {
+			return fmt.Errorf("execute request: %w", err)
+		}
+		resp = rejected
+	} else if err := json.Unmarshal(res.Payload, resp); err != nil {
+		return err
+	}
+
+	// a retried submit finds the response recorded by an earlier attempt
+	done, msg := submitStatus(resp)
+	if !done {
+		return fmt.Errorf("submit off-chain data: %s", msg)
+	}
+	if !resp.OK {
+		logger.Info("Off-chain data is submitted already", "from", response.From, "to", response.To, "index", response.Index)
+	}
+
+	return nil
+}
+
+func (c *Client) GetOffChainDataMeta() (map[string]uint64, error) {
+	request := channel.Request{
+		ChaincodeID: c.meta.CCID,
+		Fcn:         GetOffChainDataMetaMethod,
+	}
+
+	response, err := c.backend.Query(request)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.unpackMap(response)
+}
+
+func (c *Client) GetOffChainDataRequest(servicePair string, index uint64) (*pb.GetDataRequest, error) {
+	request := channel.Request{
+		ChaincodeID: c.meta.CCID,
+		Fcn:         GetOffChainDataRequestMethod,
+		Args:        util.ToChaincodeArgs(servicePair, strconv.FormatUint(index, 10)),
+	}
+
+	response, err := c.backend.Query(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Payload == nil {
+		return nil, fmt.Errorf("off-chain data request %s-%d not found", servicePair, index)
+	}
+
+	req := &OffChainDataRequest{}
+	if err := json.Unmarshal(response.Payload, req); err != nil {
+		return nil, err
+	}
+
+	return &pb.GetDataRequest{
+		Index: req.Index,
+		From:  req.From,
+		To:    req.To,
+		Req:   req.Req,
+	}, nil
+}
+
+// pollingOffChain sends the off-chain data requests apart from polling, so a
+// pier slow to take them does not hold back the delivery of ibtps
+func (c *Client) pollingOffChain() {
+	ticker := time.NewTicker(c.config.Fabric.PollingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.pollOffChainDataReq()
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// pollOffChainDataReq sends the off-chain data requests emitted since last
+// round, a request is only checkpointed once pier takes it
+func (c *Client) pollOffChainDataReq() {
+	meta, err := c.GetOffChainDataMeta()
+	if err != nil {
+		logger.Error("Polling off-chain data meta", "error", err.Error())
+		return
+	}
+
+	for servicePair, index := range meta {
+		for i := c.offChainMeta[servicePair] + 1; i <= index; i++ {
+			req, err := c.GetOffChainDataRequest(servicePair, i)
+			if err != nil {
+				logger.Error("Polling off-chain data request",
+					"servicePair", servicePair,
+					"index", i,
+					"error", err.Error())
+				break
+			}
+
+			select {
+			case c.dataReqC <- req:
+			case <-c.ctx.Done():
+				return
+			}
+			c.offChainMeta[servicePair] = i
+			c.checkpoint.SetOffChain(servicePair, i)
+		}
+	}
+}
+
+func offChainDataDir(from, to string) string {
+	replacer := strings.NewReplacer(":", "_", "&", "_", string(filepath.Separator), "_")
+	return replacer.Replace(genServicePair(from, to))
+}
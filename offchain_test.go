@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore(t *testing.T) {
+	root := t.TempDir()
+	store, err := NewFileStore(root, 4)
+	require.Nil(t, err)
+
+	p, err := store.Put("pair/1", []byte("data"))
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(root, "pair", "1"), p)
+	data, err := store.Get("pair/1")
+	require.Nil(t, err)
+	require.Equal(t, []byte("data"), data)
+
+	// putting again replaces the data
+	_, err = store.Put("pair/1", []byte("new"))
+	require.Nil(t, err)
+	data, err = store.Get("pair/1")
+	require.Nil(t, err)
+	require.Equal(t, []byte("new"), data)
+
+	_, err = store.Get("pair/2")
+	require.True(t, os.IsNotExist(err), err)
+	_, err = store.Get("pair")
+	require.NotNil(t, err)
+
+	_, err = store.Put("pair/2", []byte("large"))
+	require.Equal(t, ErrDataOutOfSize, err)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, "large"), []byte("large"), 0644))
+	_, err = store.Get("large")
+	require.Equal(t, ErrDataOutOfSize, err)
+
+	for _, key := range []string{"", ".", "../outside", "/etc/passwd"} {
+		_, err = store.Put(key, []byte("data"))
+		require.NotNil(t, err, key)
+		_, err = store.Get(key)
+		require.NotNil(t, err, key)
+	}
+}
+
+func TestPollOffChainDataReq(t *testing.T) {
+	n := newTestNetwork(t)
+	for i := 0; i < 3; i++ {
+		_, err := n.fabric.InvokeFrom(testServiceName, channel.Request{
+			ChaincodeID: "broker",
+			Fcn:         "EmitOffChainDataRequest",
+			Args:        util.ToChaincodeArgs(testRemote, "file", "callback"),
+		})
+		require.Nil(t, err)
+	}
+	servicePair := genServicePair(testLocalService, testRemote)
+
+	// the requests after the checkpoint are sent again after a restart
+	c := newTestClient(t, n)
+	c.dataReqC = make(chan *pb.GetDataRequest, 3)
+	c.checkpoint.SetOffChain(servicePair, 1)
+	require.Nil(t, c.initServiceMeta())
+	c.pollOffChainDataReq()
+
+	require.Len(t, c.dataReqC, 2)
+	for i := uint64(2); i <= 3; i++ {
+		req := <-c.dataReqC
+		require.Equal(t, i, req.Index)
+		require.Equal(t, []byte("file"), req.Req)
+	}
+	require.Equal(t, uint64(3), c.checkpoint.OffChains()[servicePair])
+
+	// pairs never delivered start from the index on chain
+	c = newTestClient(t, n)
+	c.dataReqC = make(chan *pb.GetDataRequest, 3)
+	require.Nil(t, c.initServiceMeta())
+	c.pollOffChainDataReq()
+	require.Len(t, c.dataReqC, 0)
+	require.Equal(t, uint64(3), c.checkpoint.OffChains()[servicePair])
+}
+
+func TestPollingOffChainUnread(t *testing.T) {
+	n := newTestNetwork(t)
+	c := newTestClient(t, n)
+	c.config.Fabric.PollingInterval = 10 * time.Millisecond
+	c.dataReqC = make(chan *pb.GetDataRequest)
+	require.Nil(t, c.initServiceMeta())
+	c.run(c.polling)
+	c.run(c.pollingOffChain)
+
+	// nobody reads the request
+	_, err := n.fabric.InvokeFrom(testServiceName, channel.Request{
+		ChaincodeID: "broker",
+		Fcn:         "EmitOffChainDataRequest",
+		Args:        util.ToChaincodeArgs(testRemote, "file", "callback"),
+	})
+	require.Nil(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	// ibtps are still delivered
+	for i := uint64(1); i <= 2; i++ {
+		n.emit(t, testRemote)
+		require.Equal(t, i, receiveIBTP(t, c).Index)
+	}
+	servicePair := genServicePair(testLocalService, testRemote)
+	require.Equal(t, uint64(0), c.checkpoint.OffChains()[servicePair])
+
+	select {
+	case req := <-c.GetOffChainDataReq():
+		require.Equal(t, uint64(1), req.Index)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no off-chain data request is sent")
+	}
+	require.Eventually(t, func() bool {
+		return c.checkpoint.OffChains()[servicePair] == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSubmitOffChainData(t *testing.T) {
+	n := newTestNetwork(t)
+	_, err := n.fabric.InvokeFrom(testServiceName, channel.Request{
+		ChaincodeID: "broker",
+		Fcn:         "EmitOffChainDataRequest",
+		Args:        util.ToChaincodeArgs(testRemote, "file", "callback"),
+	})
+	require.Nil(t, err)
+	c := newTestClient(t, n)
+
+	response := &pb.GetDataResponse{
+		Index: 1,
+		From:  testLocalService,
+		To:    testRemote,
+		Type:  pb.GetDataResponse_DATA_GET_INTERNAL_ERR,
+		Msg:   "not found",
+	}
+	require.Nil(t, c.SubmitOffChainData(response))
+	require.True(t, n.business.called("callback"))
+
+	// a submit retried after its first attempt committed is done
+	require.Nil(t, c.SubmitOffChainData(response))
+
+	response.Index = 2
+	err = c.SubmitOffChainData(response)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), CodeInvalidArgs)
+}
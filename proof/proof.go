@@ -0,0 +1,330 @@
+// Package proof builds and verifies the proof that a transaction is ordered
+// and endorsed on fabric. It only depends on fabric libraries, so the verifier
+// can also be compiled into the validating rule of the appchain.
+//
+// The validation code of a transaction is set by the peer committing it and is
+// signed by no one, the verifier has to trust the peer serving the block for
+// it. A proof therefore shows that the transaction was endorsed and ordered,
+// not that it passed the MVCC check.
+package proof
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	mspprotos "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric/protoutil"
+)
+
+// Proof is the bundle proving a transaction is committed. The endorsements are
+// carried by the envelope, and the block header is bound to the chain by the
+// signatures of the orderers. Fabric hashes the data of a block as a whole
+// instead of a merkle tree, so the whole block data is needed to recompute the
+// data hash of the header.
+type Proof struct {
+	Envelope    []byte   `json:"envelope"`
+	TxIndex     uint64   `json:"tx_index"`
+	BlockHeader []byte   `json:"block_header"`
+	BlockData   [][]byte `json:"block_data"`
+	// Signatures is the signatures metadata of the block
+	Signatures []byte `json:"signatures"`
+	// ValidationCode is reported by the committing peer, see the package doc
+	ValidationCode int32 `json:"validation_code"`
+}
+
+// EndorserTx is the first action of an endorser transaction
+type EndorserTx struct {
+	TxID                    string
+	ChaincodeAction         *peer.ChaincodeAction
+	ProposalResponsePayload []byte
+	Endorsements            []*peer.Endorsement
+}
+
+// New builds the proof of the transaction at txIndex of block
+func New(block *common.Block, txIndex int) (*Proof, error) {
+	if block.Header == nil || block.Data == nil || block.Metadata == nil {
+		return nil, fmt.Errorf("incomplete block")
+	}
+	if txIndex < 0 || txIndex >= len(block.Data.Data) {
+		return nil, fmt.Errorf("tx index %d out of range of block %d", txIndex, block.Header.Number)
+	}
+
+	header, err := proto.Marshal(block.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	var signatures []byte
+	if len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_SIGNATURES) {
+		signatures = block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES]
+	}
+	code := peer.TxValidationCode_NOT_VALIDATED
+	if len(block.Metadata.Metadata) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		filter := block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+		if txIndex < len(filter) {
+			code = peer.TxValidationCode(filter[txIndex])
+		}
+	}
+
+	return &Proof{
+		Envelope:       block.Data.Data[txIndex],
+		TxIndex:        uint64(txIndex),
+		BlockHeader:    header,
+		BlockData:      block.Data.Data,
+		Signatures:     signatures,
+		ValidationCode: int32(code),
+	}, nil
+}
+
+// Find builds the proof of transaction txID in block
+func Find(block *common.Block, txID string) (*Proof, error) {
+	for i, data := range block.Data.Data {
+		tx, err := ParseEndorserTx(data)
+		if err != nil || tx == nil || tx.TxID != txID {
+			continue
+		}
+		return New(block, i)
+	}
+
+	return nil, fmt.Errorf("transaction %s not found in block %d", txID, block.Header.Number)
+}
+
+func (p *Proof) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+func Unmarshal(data []byte) (*Proof, error) {
+	p := &Proof{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("unmarshal proof: %w", err)
+	}
+	return p, nil
+}
+
+// Verify checks that the block header is signed by the orderers under
+// ordererPolicy, that the proven transaction is included by the header and
+// writes to chaincode cid, and that its endorsements satisfy policy. The MSPs
+// of both policies are set up from confs. The chaincode action of the
+// transaction is returned for the caller to check the content.
+//
+// The validation code in the proof is only checked as reported by the peer,
+// see the package doc.
+func Verify(data, policy, ordererPolicy []byte, confs []string, cid string) (*peer.ChaincodeAction, error) {
+	p, err := Unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if peer.TxValidationCode(p.ValidationCode) != peer.TxValidationCode_VALID {
+		return nil, fmt.Errorf("transaction is not valid: %s", peer.TxValidationCode(p.ValidationCode))
+	}
+
+	header := &common.BlockHeader{}
+	if err := proto.Unmarshal(p.BlockHeader, header); err != nil {
+		return nil, fmt.Errorf("unmarshal block header: %w", err)
+	}
+	mgr, err := newMSPManager(confs)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlockSignatures(mgr, ordererPolicy, header, p.Signatures); err != nil {
+		return nil, fmt.Errorf("verify signatures of block %d: %w", header.Number, err)
+	}
+	if !bytes.Equal(protoutil.BlockDataHash(&common.BlockData{Data: p.BlockData}), header.DataHash) {
+		return nil, fmt.Errorf("block data does not match header of block %d", header.Number)
+	}
+	if p.TxIndex >= uint64(len(p.BlockData)) || !bytes.Equal(p.BlockData[p.TxIndex], p.Envelope) {
+		return nil, fmt.Errorf("envelope is not at index %d of block %d", p.TxIndex, header.Number)
+	}
+
+	tx, err := ParseEndorserTx(p.Envelope)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("not an endorser transaction")
+	}
+	if !WritesNamespace(tx.ChaincodeAction.Results, cid) {
+		return nil, fmt.Errorf("transaction %s does not write to chaincode %s", tx.TxID, cid)
+	}
+
+	if err := verifyEndorsements(mgr, policy, tx); err != nil {
+		return nil, fmt.Errorf("verify endorsements of transaction %s: %w", tx.TxID, err)
+	}
+
+	return tx.ChaincodeAction, nil
+}
+
+// verifyBlockSignatures checks the signatures of the orderers over header the
+// way peers check a block delivered to them
+func verifyBlockSignatures(mgr msp.MSPManager, policy []byte, header *common.BlockHeader, signatures []byte) error {
+	metadata := &common.Metadata{}
+	if err := proto.Unmarshal(signatures, metadata); err != nil {
+		return fmt.Errorf("unmarshal signatures metadata: %w", err)
+	}
+	if len(metadata.Signatures) == 0 {
+		return fmt.Errorf("block is not signed")
+	}
+
+	headerBytes := protoutil.BlockHeaderBytes(header)
+	signatureSet := make([]*protoutil.SignedData, 0, len(metadata.Signatures))
+	for _, signature := range metadata.Signatures {
+		shdr, err := protoutil.UnmarshalSignatureHeader(signature.SignatureHeader)
+		if err != nil {
+			return err
+		}
+		signatureSet = append(signatureSet, &protoutil.SignedData{
+			Data:      util.ConcatenateBytes(metadata.Value, signature.SignatureHeader, headerBytes),
+			Identity:  shdr.Creator,
+			Signature: signature.Signature,
+		})
+	}
+
+	return evaluate(mgr, policy, signatureSet)
+}
+
+func verifyEndorsements(mgr msp.MSPManager, policy []byte, tx *EndorserTx) error {
+	signatureSet := make([]*protoutil.SignedData, 0, len(tx.Endorsements))
+	for _, endorsement := range tx.Endorsements {
+		data := make([]byte, len(tx.ProposalResponsePayload)+len(endorsement.Endorser))
+		copy(data, tx.ProposalResponsePayload)
+		copy(data[len(tx.ProposalResponsePayload):], endorsement.Endorser)
+		signatureSet = append(signatureSet, &protoutil.SignedData{
+			Data:      data,
+			Identity:  endorsement.Endorser,
+			Signature: endorsement.Signature,
+		})
+	}
+
+	return evaluate(mgr, policy, signatureSet)
+}
+
+// evaluate checks signatureSet against the signature policy envelope policy
+func evaluate(mgr msp.MSPManager, policy []byte, signatureSet []*protoutil.SignedData) error {
+	pp, _, err := cauthdsl.NewPolicyProvider(mgr).NewPolicy(policy)
+	if err != nil {
+		return fmt.Errorf("parse policy: %w", err)
+	}
+
+	return pp.EvaluateSignedData(signatureSet)
+}
+
+// newMSPManager sets up the MSPs from the configs kept in the validator, which
+// are in proto text format
+func newMSPManager(confs []string) (msp.MSPManager, error) {
+	msps := make([]msp.MSP, 0, len(confs))
+	for _, conf := range confs {
+		mspConf := &mspprotos.MSPConfig{}
+		if err := proto.UnmarshalText(conf, mspConf); err != nil {
+			return nil, fmt.Errorf("unmarshal msp config: %w", err)
+		}
+
+		inst, err := msp.New(msp.Options[msp.ProviderTypeToString(msp.ProviderType(mspConf.Type))], factory.GetDefault())
+		if err != nil {
+			return nil, err
+		}
+		if err := inst.Setup(mspConf); err != nil {
+			return nil, fmt.Errorf("setup msp: %w", err)
+		}
+		msps = append(msps, inst)
+	}
+
+	mgr := msp.NewMSPManager()
+	if err := mgr.Setup(msps); err != nil {
+		return nil, err
+	}
+	return mgr, nil
+}
+
+// ParseEndorserTx parses the first action of an endorser transaction, nil is
+// returned if the envelope holds another type of transaction
+func ParseEndorserTx(envelope []byte) (*EndorserTx, error) {
+	env, err := protoutil.UnmarshalEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	pd, err := protoutil.UnmarshalPayload(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if pd.Header == nil {
+		return nil, fmt.Errorf("missing payload header")
+	}
+	chdr, err := protoutil.UnmarshalChannelHeader(pd.Header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+	if common.HeaderType(chdr.Type) != common.HeaderType_ENDORSER_TRANSACTION {
+		return nil, nil
+	}
+	tx, err := protoutil.UnmarshalTransaction(pd.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(tx.Actions) == 0 {
+		return nil, fmt.Errorf("transaction %s has no action", chdr.TxId)
+	}
+	ccPayload, err := protoutil.UnmarshalChaincodeActionPayload(tx.Actions[0].Payload)
+	if err != nil {
+		return nil, err
+	}
+	if ccPayload.Action == nil {
+		return nil, fmt.Errorf("missing chaincode endorsed action")
+	}
+	prp, err := protoutil.UnmarshalProposalResponsePayload(ccPayload.Action.ProposalResponsePayload)
+	if err != nil {
+		return nil, err
+	}
+	ccAction, err := protoutil.UnmarshalChaincodeAction(prp.Extension)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EndorserTx{
+		TxID:                    chdr.TxId,
+		ChaincodeAction:         ccAction,
+		ProposalResponsePayload: ccPayload.Action.ProposalResponsePayload,
+		Endorsements:            ccPayload.Action.Endorsements,
+	}, nil
+}
+
+// WritesNamespace tells whether the read write set writes to the namespace
+func WritesNamespace(results []byte, namespace string) bool {
+	writes, err := NamespaceWrites(results, namespace)
+	return err == nil && len(writes) != 0
+}
+
+// NamespaceWrites returns the values the read write set writes to the
+// namespace by key, deleted keys are left out
+func NamespaceWrites(results []byte, namespace string) (map[string][]byte, error) {
+	txRWSet := &rwset.TxReadWriteSet{}
+	if err := proto.Unmarshal(results, txRWSet); err != nil {
+		return nil, fmt.Errorf("unmarshal read write set: %w", err)
+	}
+	writes := make(map[string][]byte)
+	for _, nsRWSet := range txRWSet.NsRwset {
+		if nsRWSet.Namespace != namespace {
+			continue
+		}
+		kvRWSet := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(nsRWSet.Rwset, kvRWSet); err != nil {
+			return nil, fmt.Errorf("unmarshal read write set of %s: %w", namespace, err)
+		}
+		for _, write := range kvRWSet.Writes {
+			if !write.IsDelete {
+				writes[write.Key] = write.Value
+			}
+		}
+	}
+	return writes, nil
+}
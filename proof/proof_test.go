@@ -0,0 +1,317 @@
+package proof
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	mspprotos "github.com/hyperledger/fabric-protos-go/msp"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/common/policydsl"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testChannel   = "mychannel"
+	testCid       = "broker"
+	testPolicy    = "AND('Org1MSP.member', 'Org2MSP.member')"
+	testOrdPolicy = "OR('OrdererMSP.member')"
+)
+
+// org is an MSP with its own CA
+type org struct {
+	mspID  string
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+	admin  []byte
+}
+
+// signer is an identity issued by the CA of an org
+type signer struct {
+	identity []byte
+	key      *ecdsa.PrivateKey
+}
+
+func newOrg(t *testing.T, mspID string) *org {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca." + mspID},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          []byte(mspID),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+
+	o := &org{mspID: mspID, cert: cert, key: key, serial: 1}
+	o.admin, _ = o.issue(t, "admin."+mspID)
+	return o
+}
+
+// conf returns the MSP config of the org the way the validator keeps it
+func (o *org) conf(t *testing.T) string {
+	fabricConf, err := proto.Marshal(&mspprotos.FabricMSPConfig{
+		Name:      o.mspID,
+		RootCerts: [][]byte{pemCert(o.cert)},
+		Admins:    [][]byte{o.admin},
+		CryptoConfig: &mspprotos.FabricCryptoConfig{
+			SignatureHashFamily:            "SHA2",
+			IdentityIdentifierHashFunction: "SHA256",
+		},
+	})
+	require.Nil(t, err)
+
+	return proto.CompactTextString(&mspprotos.MSPConfig{Config: fabricConf})
+}
+
+func (o *org) newSigner(t *testing.T) *signer {
+	cert, key := o.issue(t, "peer."+o.mspID)
+	identity, err := proto.Marshal(&mspprotos.SerializedIdentity{Mspid: o.mspID, IdBytes: cert})
+	require.Nil(t, err)
+
+	return &signer{identity: identity, key: key}
+}
+
+// issue issues a PEM certificate of name by the CA of the org
+func (o *org) issue(t *testing.T, name string) ([]byte, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	o.serial++
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(o.serial),
+		Subject:        pkix.Name{CommonName: name},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		KeyUsage:       x509.KeyUsageDigitalSignature,
+		AuthorityKeyId: o.cert.SubjectKeyId,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, o.cert, &key.PublicKey, o.key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+
+	return pemCert(cert), key
+}
+
+// sign signs msg with a low-S signature as fabric requires
+func (s *signer) sign(t *testing.T, msg []byte) []byte {
+	digest := sha256.Sum256(msg)
+	r, sig, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	require.Nil(t, err)
+	halfOrder := new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+	if sig.Cmp(halfOrder) > 0 {
+		sig.Sub(elliptic.P256().Params().N, sig)
+	}
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{r, sig})
+	require.Nil(t, err)
+
+	return der
+}
+
+func pemCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func marshal(t *testing.T, msg proto.Message) []byte {
+	data, err := proto.Marshal(msg)
+	require.Nil(t, err)
+	return data
+}
+
+// endorserTx builds the envelope of a transaction writing to namespace,
+// endorsed by endorsers
+func endorserTx(t *testing.T, txID, namespace string, endorsers ...*signer) []byte {
+	kvRWSet := marshal(t, &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "key", Value: []byte("value")}}})
+	results := marshal(t, &rwset.TxReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsRwset:   []*rwset.NsReadWriteSet{{Namespace: namespace, Rwset: kvRWSet}},
+	})
+	prp := marshal(t, &peer.ProposalResponsePayload{
+		ProposalHash: []byte(txID),
+		Extension:    marshal(t, &peer.ChaincodeAction{Results: results}),
+	})
+	endorsements := make([]*peer.Endorsement, 0, len(endorsers))
+	for _, endorser := range endorsers {
+		endorsements = append(endorsements, &peer.Endorsement{
+			Endorser:  endorser.identity,
+			Signature: endorser.sign(t, util.ConcatenateBytes(prp, endorser.identity)),
+		})
+	}
+	ccPayload := marshal(t, &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: prp, Endorsements: endorsements},
+	})
+	tx := marshal(t, &peer.Transaction{Actions: []*peer.TransactionAction{{Payload: ccPayload}}})
+
+	return envelope(t, common.HeaderType_ENDORSER_TRANSACTION, txID, tx)
+}
+
+func envelope(t *testing.T, typ common.HeaderType, txID string, data []byte) []byte {
+	chdr := marshal(t, &common.ChannelHeader{Type: int32(typ), ChannelId: testChannel, TxId: txID})
+	payload := marshal(t, &common.Payload{Header: &common.Header{ChannelHeader: chdr}, Data: data})
+
+	return marshal(t, &common.Envelope{Payload: payload})
+}
+
+// newBlock builds block number of data, signed by orderers, with every
+// transaction valid
+func newBlock(t *testing.T, number uint64, data [][]byte, orderers ...*signer) *common.Block {
+	block := protoutil.NewBlock(number, []byte("previous hash"))
+	block.Data.Data = data
+	block.Header.DataHash = protoutil.BlockDataHash(block.Data)
+
+	metadata := &common.Metadata{Value: []byte("last config")}
+	for _, orderer := range orderers {
+		shdr := marshal(t, &common.SignatureHeader{Creator: orderer.identity, Nonce: []byte("nonce")})
+		metadata.Signatures = append(metadata.Signatures, &common.MetadataSignature{
+			SignatureHeader: shdr,
+			Signature:       orderer.sign(t, util.ConcatenateBytes(metadata.Value, shdr, protoutil.BlockHeaderBytes(block.Header))),
+		})
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_SIGNATURES] = marshal(t, metadata)
+	filter := make([]byte, len(data))
+	for i := range filter {
+		filter[i] = byte(peer.TxValidationCode_VALID)
+	}
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = filter
+
+	return block
+}
+
+func policy(t *testing.T, rule string) []byte {
+	envelope, err := policydsl.FromString(rule)
+	require.Nil(t, err)
+	return marshal(t, envelope)
+}
+
+func TestVerify(t *testing.T) {
+	org1 := newOrg(t, "Org1MSP")
+	org2 := newOrg(t, "Org2MSP")
+	ordererOrg := newOrg(t, "OrdererMSP")
+	confs := []string{org1.conf(t), org2.conf(t), ordererOrg.conf(t)}
+	peer1, peer2, orderer := org1.newSigner(t), org2.newSigner(t), ordererOrg.newSigner(t)
+
+	data := [][]byte{
+		envelope(t, common.HeaderType_CONFIG, "", []byte("config")),
+		endorserTx(t, "tx1", testCid, peer1, peer2),
+		endorserTx(t, "tx2", testCid, peer1),
+		endorserTx(t, "tx3", "transfer", peer1, peer2),
+	}
+	block := newBlock(t, 5, data, orderer)
+
+	build := func(block *common.Block, txIndex int) *Proof {
+		p, err := New(block, txIndex)
+		require.Nil(t, err)
+		return p
+	}
+	verify := func(p *Proof) error {
+		data, err := p.Marshal()
+		require.Nil(t, err)
+		_, err = Verify(data, policy(t, testPolicy), policy(t, testOrdPolicy), confs, testCid)
+		return err
+	}
+
+	p, err := Find(block, "tx1")
+	require.Nil(t, err)
+	data1, err := p.Marshal()
+	require.Nil(t, err)
+	action, err := Verify(data1, policy(t, testPolicy), policy(t, testOrdPolicy), confs, testCid)
+	require.Nil(t, err)
+	writes, err := NamespaceWrites(action.Results, testCid)
+	require.Nil(t, err)
+	require.Equal(t, map[string][]byte{"key": []byte("value")}, writes)
+
+	t.Run("bad bundle", func(t *testing.T) {
+		_, err := Verify([]byte("{"), policy(t, testPolicy), policy(t, testOrdPolicy), confs, testCid)
+		require.NotNil(t, err)
+	})
+
+	t.Run("invalid transaction", func(t *testing.T) {
+		p := build(block, 1)
+		p.ValidationCode = int32(peer.TxValidationCode_MVCC_READ_CONFLICT)
+		require.Contains(t, verify(p).Error(), "not valid")
+	})
+
+	t.Run("bad header", func(t *testing.T) {
+		p := build(block, 1)
+		p.BlockHeader = []byte("header")
+		require.Contains(t, verify(p).Error(), "unmarshal block header")
+	})
+
+	t.Run("unsigned block", func(t *testing.T) {
+		require.Contains(t, verify(build(newBlock(t, 5, data), 1)).Error(), "not signed")
+	})
+
+	t.Run("signed by peer", func(t *testing.T) {
+		require.Contains(t, verify(build(newBlock(t, 5, data, peer1), 1)).Error(), "verify signatures of block 5")
+	})
+
+	t.Run("tampered header", func(t *testing.T) {
+		p := build(block, 1)
+		header := &common.BlockHeader{}
+		require.Nil(t, proto.Unmarshal(p.BlockHeader, header))
+		header.Number = 6
+		p.BlockHeader = marshal(t, header)
+		require.Contains(t, verify(p).Error(), "verify signatures of block 6")
+	})
+
+	t.Run("tampered data", func(t *testing.T) {
+		p := build(block, 1)
+		p.BlockData = append([][]byte{}, p.BlockData...)
+		p.BlockData[2] = endorserTx(t, "tx2", testCid, peer1, peer2)
+		require.Contains(t, verify(p).Error(), "does not match header")
+	})
+
+	t.Run("wrong index", func(t *testing.T) {
+		p := build(block, 1)
+		p.TxIndex = 2
+		require.Contains(t, verify(p).Error(), "not at index 2")
+		p.TxIndex = 4
+		require.Contains(t, verify(p).Error(), "not at index 4")
+	})
+
+	t.Run("config transaction", func(t *testing.T) {
+		require.Contains(t, verify(build(block, 0)).Error(), "not an endorser transaction")
+	})
+
+	t.Run("other chaincode", func(t *testing.T) {
+		require.Contains(t, verify(build(block, 3)).Error(), "does not write to chaincode broker")
+	})
+
+	t.Run("policy not met", func(t *testing.T) {
+		require.Contains(t, verify(build(block, 2)).Error(), "verify endorsements of transaction tx2")
+	})
+}
+
+func TestNew(t *testing.T) {
+	block := protoutil.NewBlock(1, nil)
+	block.Data.Data = [][]byte{[]byte("tx")}
+
+	_, err := New(block, 1)
+	require.Contains(t, err.Error(), "out of range")
+
+	block.Metadata = nil
+	_, err = New(block, 0)
+	require.Contains(t, err.Error(), "incomplete block")
+}
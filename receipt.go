@@ -5,7 +5,7 @@ import (
 	"github.com/meshplus/bitxhub-model/pb"
 )
 
-func (c *Client) generateReceipt(from, to string, idx uint64, args [][]byte, proof []byte, status, encrypt bool, typ uint64) (*pb.IBTP, error) {
+func generateReceipt(from, to string, idx uint64, args [][]byte, proof []byte, status, encrypt bool, typ uint64) (*pb.IBTP, error) {
 	result := &pb.Result{Data: args}
 	content, err := result.Marshal()
 	if err != nil {
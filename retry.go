@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+)
+
+// operations with their own retry policy in the [retry.operations] section
+const (
+	retryInvokeInterchain  = "invoke_interchain"
+	retryInvokeInterchains = "invoke_interchains"
+	retryInvokeReceipt     = "invoke_receipt"
+	retryInvokeReceipts    = "invoke_receipts"
+	retryGetProof          = "get_proof"
+	retryInvokeIndexUpdate = "invoke_index_update"
+	retrySubmitOffChain    = "submit_offchain_data"
+)
+
+// retry calls f under the retry policy of operation op. Terminal errors and
+// the error of the last attempt are returned at once, and retrying stops
+// once the client is stopped.
+func (c *Client) retry(op string, f func() error) error {
+	policy := c.config.Retry.Policy(op)
+	for attempt := uint64(1); ; attempt++ {
+		err := f()
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("%s failed after %d attempts: %w", op, attempt, err)
+		}
+
+		wait := policy.backoff(attempt)
+		logger.Warn("Retry request to fabric",
+			"operation", op,
+			"attempt", attempt,
+			"wait", wait.String(),
+			"error", err.Error())
+		select {
+		case <-time.After(wait):
+		case <-c.ctx.Done():
+			return err
+		}
+	}
+}
+
+// execute sends request to fabric under the retry policy of operation op
+func (c *Client) execute(op string, request channel.Request) (channel.Response, error) {
+	var res channel.Response
+	err := c.retry(op, func() error {
+		var err error
+		res, err = c.backend.Execute(request)
+		return err
+	})
+	return res, err
+}
+
+// backoff doubles the wait after each attempt up to MaxBackoff, then picks it
+// at random in its upper half so that clients retrying together spread out
+func (p RetryPolicy) backoff(attempt uint64) time.Duration {
+	wait := p.Backoff
+	for i := uint64(1); i < attempt && wait < p.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait <= 1 {
+		return wait
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// isRetryable tells whether another attempt of a failed request may succeed.
+// Rejections by the chaincode, an unknown chaincode and invalid credentials
+// are terminal, conflicts with concurrent transactions and failures of the
+// network are retryable.
+func isRetryable(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return true
+	}
+
+	switch s.Group {
+	case status.ChaincodeStatus:
+		return false
+	case status.EventServerStatus:
+		code := peer.TxValidationCode(s.Code)
+		return code == peer.TxValidationCode_MVCC_READ_CONFLICT || code == peer.TxValidationCode_PHANTOM_READ_CONFLICT
+	case status.EndorserClientStatus, status.ClientStatus:
+		switch status.Code(s.Code) {
+		case status.ChaincodeNameNotFound, status.SignatureVerificationFailed, status.EmptyCert:
+			return false
+		case status.MultipleErrors:
+			// the endorsers fail on their own, one terminal failure is enough
+			for _, detail := range s.Details {
+				if e, ok := detail.(error); ok && !isRetryable(e) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
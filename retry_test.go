@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/errors/status"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryable(t *testing.T) {
+	chaincodeErr := status.New(status.ChaincodeStatus, 500, `{"ok":false,"code":"INDEX_MISMATCH"}`, nil)
+	connectionErr := status.New(status.EndorserClientStatus, int32(status.ConnectionFailed), "connection refused", nil)
+	multiple := func(details ...interface{}) error {
+		return status.New(status.EndorserClientStatus, int32(status.MultipleErrors), "multiple errors", details)
+	}
+
+	for name, c := range map[string]struct {
+		err       error
+		retryable bool
+	}{
+		"plain error":           {fmt.Errorf("timeout"), true},
+		"chaincode rejection":   {chaincodeErr, false},
+		"mvcc conflict":         {status.New(status.EventServerStatus, int32(peer.TxValidationCode_MVCC_READ_CONFLICT), "", nil), true},
+		"phantom read":          {status.New(status.EventServerStatus, int32(peer.TxValidationCode_PHANTOM_READ_CONFLICT), "", nil), true},
+		"policy failure":        {status.New(status.EventServerStatus, int32(peer.TxValidationCode_ENDORSEMENT_POLICY_FAILURE), "", nil), false},
+		"unknown chaincode":     {status.New(status.EndorserClientStatus, int32(status.ChaincodeNameNotFound), "", nil), false},
+		"bad signature":         {status.New(status.ClientStatus, int32(status.SignatureVerificationFailed), "", nil), false},
+		"connection failure":    {connectionErr, true},
+		"endorser rejection":    {multiple(connectionErr, chaincodeErr), false},
+		"endorsers unreachable": {multiple(connectionErr, connectionErr), true},
+	} {
+		require.Equal(t, c.retryable, isRetryable(c.err), name)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range map[uint64]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		4: 5 * time.Second,
+		9: 5 * time.Second,
+	} {
+		for i := 0; i < 20; i++ {
+			wait := p.backoff(attempt)
+			require.True(t, wait >= want/2 && wait <= want, "attempt %d waits %s", attempt, wait)
+		}
+	}
+
+	require.Equal(t, time.Duration(0), RetryPolicy{}.backoff(3))
+}
+
+func TestRetry(t *testing.T) {
+	config := DefaultConfig()
+	config.Retry.RetryPolicy = RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	config.Retry.Operations = map[string]RetryPolicy{retryGetProof: {MaxAttempts: 1}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &Client{config: config, ctx: ctx}
+
+	var attempts int
+	failing := func(err error, times int) func() error {
+		attempts = 0
+		return func() error {
+			attempts++
+			if attempts <= times {
+				return err
+			}
+			return nil
+		}
+	}
+
+	require.Nil(t, c.retry(retryInvokeInterchain, failing(fmt.Errorf("timeout"), 2)))
+	require.Equal(t, 3, attempts)
+
+	err := c.retry(retryInvokeInterchain, failing(fmt.Errorf("timeout"), 3))
+	require.Contains(t, err.Error(), "invoke_interchain failed after 3 attempts")
+	require.Equal(t, 3, attempts)
+
+	// rejections are returned at once
+	rejected := status.New(status.ChaincodeStatus, 500, "rejected", nil)
+	require.Equal(t, rejected, c.retry(retryInvokeInterchain, failing(rejected, 3)))
+	require.Equal(t, 1, attempts)
+
+	require.NotNil(t, c.retry(retryGetProof, failing(fmt.Errorf("timeout"), 1)))
+	require.Equal(t, 1, attempts)
+
+	// a stopped client gives up waiting
+	config.Retry.Backoff = time.Hour
+	config.Retry.MaxBackoff = time.Hour
+	cancel()
+	require.NotNil(t, c.retry(retryInvokeInterchain, failing(fmt.Errorf("timeout"), 3)))
+	require.Equal(t, 1, attempts)
+}
@@ -0,0 +1,29 @@
+#!/usr/bin/env bash
+# Mirrors the transaction, transfer and data_swapper chaincodes into the broker
+# module, so that the broker tests deploy them next to the broker in one mock
+# peer. Each chaincode is a main package of its own module, so it is mirrored
+# as a library package which is only imported by the tests.
+
+set -e
+
+CURRENT_PATH=$(cd "$(dirname "$0")" && pwd)
+CONTRACTS=${CURRENT_PATH}/../example/contracts/src
+DST=${CONTRACTS}/broker/internal
+
+for chaincode in transaction transfer data_swapper; do
+  pkg=${chaincode//_/}
+  mkdir -p "${DST}/${chaincode}"
+  rm -f "${DST}/${chaincode}"/*.go
+  for file in "${CONTRACTS}/${chaincode}"/*.go; do
+    name=$(basename "${file}")
+    case ${name} in
+    *_test.go) continue ;;
+    esac
+    {
+      echo "// Code generated by scripts/gen_broker_test_chaincodes.sh from example/contracts/src/${chaincode}/${name}. DO NOT EDIT."
+      echo
+      sed -e "s#^package main\$#package ${pkg}#" "${file}"
+    } >"${DST}/${chaincode}/${name}"
+  done
+done
+gofmt -w "${DST}"
@@ -0,0 +1,36 @@
+#!/usr/bin/env bash
+# Mirrors the broker chaincode into fakefabric/broker, so that the fake fabric
+# of the plugin tests runs the real broker in process. The transfer and
+# data_swapper chaincodes are mirrored as well for the simulations of the fake
+# backend. The chaincodes are built against the fabric 1.4 shim, which can not
+# live in the module of the plugin, so their imports are moved to the fabric
+# 2.x chaincode libraries.
+
+set -e
+
+CURRENT_PATH=$(cd "$(dirname "$0")" && pwd)
+CONTRACTS=${CURRENT_PATH}/../example/contracts/src
+FAKE=${CURRENT_PATH}/../fakefabric
+
+for chaincode in broker transfer data_swapper; do
+  pkg=${chaincode//_/}
+  mkdir -p "${FAKE}/${chaincode}"
+  rm -f "${FAKE}/${chaincode}"/*.go
+  for file in "${CONTRACTS}/${chaincode}"/*.go; do
+    name=$(basename "${file}")
+    case ${name} in
+    *_test.go) continue ;;
+    esac
+    {
+      echo "// Code generated by scripts/gen_fake_broker.sh from example/contracts/src/${chaincode}/${name}. DO NOT EDIT."
+      echo
+      sed -e "s#^package main\$#package ${pkg}#" \
+        -e 's#"github.com/hyperledger/fabric/core/chaincode/shim"#"github.com/hyperledger/fabric-chaincode-go/shim"#' \
+        -e 's#"github.com/hyperledger/fabric/core/chaincode/lib/cid"#"github.com/hyperledger/fabric-chaincode-go/pkg/cid"#' \
+        -e 's#"github.com/hyperledger/fabric/protos/peer"#"github.com/hyperledger/fabric-protos-go/peer"#' \
+        -e 's#"github.com/hyperledger/fabric/protos/msp"#"github.com/hyperledger/fabric-protos-go/msp"#' \
+        "${file}"
+    } >"${FAKE}/${chaincode}/${name}"
+  done
+done
+gofmt -w "${FAKE}"
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/fatih/color"
+	"github.com/hashicorp/go-plugin"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/pier-client-fabric/internal/testutil"
+	"github.com/meshplus/pier/pkg/plugins"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+const defaultStepTimeout = 10 * time.Second
+
+var simulateCMD = cli.Command{
+	Name:  "simulate",
+	Usage: "Run the plugin like pier does and drive it with a scenario",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:     "scenario",
+			Usage:    "Specify the scenario file",
+			Required: true,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		scenario, err := loadScenario(ctx.String("scenario"))
+		if err != nil {
+			return err
+		}
+
+		s, err := newSimulator(scenario)
+		if err != nil {
+			return err
+		}
+		defer s.close()
+
+		if err := s.run(); err != nil {
+			return err
+		}
+		color.Green("Scenario %s passed", ctx.String("scenario"))
+
+		return nil
+	},
+}
+
+// Scenario is a run of the plugin, which is started and driven the way pier
+// does. The steps submit ibtps and receipts as pier does when it relays them
+// from bitxhub, and wait for the ibtps the plugin delivers.
+type Scenario struct {
+	// Plugin is the plugin binary, the running binary if empty
+	Plugin string `yaml:"plugin"`
+	// Config is the config directory of the plugin
+	Config string `yaml:"config"`
+	Mode   string `yaml:"mode"`
+	// Validators are the hex encoded private keys of the bitxhub validators
+	// signing the proofs of submitted ibtps
+	Validators []string `yaml:"validators"`
+	// Timeout bounds the wait of every step
+	Timeout time.Duration `yaml:"timeout"`
+	Steps   []Step        `yaml:"steps"`
+}
+
+// Step sets exactly one of its fields
+type Step struct {
+	SubmitIBTP    *SubmitIBTPStep    `yaml:"submit_ibtp"`
+	SubmitReceipt *SubmitReceiptStep `yaml:"submit_receipt"`
+	ExpectIBTP    *ExpectIBTPStep    `yaml:"expect_ibtp"`
+}
+
+// SubmitIBTPStep calls SubmitIBTP with an interchain request from a remote
+// service to the local service ServiceID
+type SubmitIBTPStep struct {
+	From      string   `yaml:"from"`
+	Index     uint64   `yaml:"index"`
+	ServiceID string   `yaml:"service_id"`
+	Type      string   `yaml:"type"`
+	Func      string   `yaml:"func"`
+	Args      []string `yaml:"args"`
+	TxStatus  string   `yaml:"tx_status"`
+	Encrypted bool     `yaml:"encrypted"`
+	Expect    Expect   `yaml:"expect"`
+}
+
+// SubmitReceiptStep calls SubmitReceipt with the receipt of the request of
+// the local service ServiceID to the remote service To
+type SubmitReceiptStep struct {
+	To        string   `yaml:"to"`
+	Index     uint64   `yaml:"index"`
+	ServiceID string   `yaml:"service_id"`
+	Type      string   `yaml:"type"`
+	Results   []string `yaml:"results"`
+	TxStatus  string   `yaml:"tx_status"`
+	Expect    Expect   `yaml:"expect"`
+}
+
+// Expect is the response expected by a submit step, a successful one if the
+// status is not set. Message is looked up in the message of the response.
+type Expect struct {
+	Status  *bool  `yaml:"status"`
+	Message string `yaml:"message"`
+}
+
+// ExpectIBTPStep waits until the plugin delivers a matching ibtp, the fields
+// left empty match any ibtp
+type ExpectIBTPStep struct {
+	From  string `yaml:"from"`
+	To    string `yaml:"to"`
+	Index uint64 `yaml:"index"`
+	Type  string `yaml:"type"`
+}
+
+// loadScenario reads the scenario file path, the relative paths in it are
+// resolved from the directory of the file
+func loadScenario(path string) (*Scenario, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario := &Scenario{
+		Mode:    "relay",
+		Timeout: defaultStepTimeout,
+	}
+	if err := yaml.UnmarshalStrict(data, scenario); err != nil {
+		return nil, fmt.Errorf("unmarshal scenario %s: %w", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	if scenario.Plugin == "" {
+		if scenario.Plugin, err = os.Executable(); err != nil {
+			return nil, err
+		}
+	} else if !filepath.IsAbs(scenario.Plugin) {
+		scenario.Plugin = filepath.Join(dir, scenario.Plugin)
+	}
+	if !filepath.IsAbs(scenario.Config) {
+		scenario.Config = filepath.Join(dir, scenario.Config)
+	}
+	if scenario.Config, err = filepath.Abs(scenario.Config); err != nil {
+		return nil, err
+	}
+
+	return scenario, nil
+}
+
+// simulator hosts the plugin process
+type simulator struct {
+	scenario   *Scenario
+	client     *plugin.Client
+	appchain   plugins.Client
+	validators []*ecdsa.PrivateKey
+	bxhID      string
+	appchainID string
+
+	lock     sync.Mutex
+	received []*pb.IBTP
+	notify   chan struct{}
+}
+
+// newSimulator launches the plugin, then initializes and starts it
+func newSimulator(scenario *Scenario) (*simulator, error) {
+	s := &simulator{
+		scenario: scenario,
+		notify:   make(chan struct{}, 1),
+	}
+	for _, key := range scenario.Validators {
+		validator, err := crypto.HexToECDSA(strings.TrimPrefix(key, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("parse validator key: %w", err)
+		}
+		s.validators = append(s.validators, validator)
+	}
+
+	s.client = plugin.NewClient(&plugin.ClientConfig{
+		HandshakeConfig:  plugins.Handshake,
+		Plugins:          plugins.PluginMap,
+		Cmd:              exec.Command("sh", "-c", fmt.Sprintf("%s start", scenario.Plugin)),
+		Logger:           logger,
+		AllowedProtocols: []plugin.Protocol{plugin.ProtocolGRPC},
+	})
+	rpcClient, err := s.client.Client()
+	if err != nil {
+		s.client.Kill()
+		return nil, fmt.Errorf("connect via rpc: %w", err)
+	}
+	raw, err := rpcClient.Dispense(plugins.PluginName)
+	if err != nil {
+		s.client.Kill()
+		return nil, fmt.Errorf("dispense plugin %s: %w", plugins.PluginName, err)
+	}
+	appchain, ok := raw.(*plugins.GRPCClient)
+	if !ok {
+		s.client.Kill()
+		return nil, fmt.Errorf("unsupported client type")
+	}
+	s.appchain = appchain
+
+	if err := s.appchain.Initialize(scenario.Config, nil, scenario.Mode); err != nil {
+		s.client.Kill()
+		return nil, fmt.Errorf("initialize plugin: %w", err)
+	}
+	if err := s.appchain.Start(); err != nil {
+		s.client.Kill()
+		return nil, fmt.Errorf("start plugin: %w", err)
+	}
+	if s.bxhID, s.appchainID, err = s.appchain.GetChainID(); err != nil {
+		s.close()
+		return nil, fmt.Errorf("get chain id: %w", err)
+	}
+	if err := s.recover(); err != nil {
+		s.close()
+		return nil, err
+	}
+	go s.consume(s.appchain.GetIBTPCh())
+
+	return s, nil
+}
+
+func (s *simulator) close() {
+	if err := s.appchain.Stop(); err != nil {
+		logger.Warn("Stop plugin", "error", err.Error())
+	}
+	s.client.Kill()
+}
+
+// recover fetches the interchain requests sent before the plugin started,
+// like pier does for the indexes it has not relayed yet
+func (s *simulator) recover() error {
+	outMeta, err := s.appchain.GetOutMeta()
+	if err != nil {
+		return fmt.Errorf("get out meta: %w", err)
+	}
+	for servicePair, index := range outMeta {
+		for i := uint64(1); i <= index; i++ {
+			ibtp, err := s.appchain.GetOutMessage(servicePair, i)
+			if err != nil {
+				return fmt.Errorf("get out message %s#%d: %w", servicePair, i, err)
+			}
+			s.received = append(s.received, ibtp)
+		}
+	}
+	return nil
+}
+
+// consume keeps the ibtps delivered by the plugin until a step expects them
+func (s *simulator) consume(ibtpCh chan *pb.IBTP) {
+	for ibtp := range ibtpCh {
+		logger.Info("Receive ibtp", "id", ibtp.ID(), "type", ibtp.Type)
+		s.lock.Lock()
+		s.received = append(s.received, ibtp)
+		s.lock.Unlock()
+
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *simulator) run() error {
+	for i, step := range s.scenario.Steps {
+		var (
+			desc string
+			err  error
+		)
+		switch {
+		case step.SubmitIBTP != nil:
+			desc = fmt.Sprintf("submit ibtp %s#%d", step.SubmitIBTP.From, step.SubmitIBTP.Index)
+			err = s.submitIBTP(step.SubmitIBTP)
+		case step.SubmitReceipt != nil:
+			desc = fmt.Sprintf("submit receipt %s#%d", step.SubmitReceipt.To, step.SubmitReceipt.Index)
+			err = s.submitReceipt(step.SubmitReceipt)
+		case step.ExpectIBTP != nil:
+			desc = fmt.Sprintf("expect ibtp %s#%d", step.ExpectIBTP.From, step.ExpectIBTP.Index)
+			err = s.expectIBTP(step.ExpectIBTP)
+		default:
+			return fmt.Errorf("step %d: nothing to do", i+1)
+		}
+		if err != nil {
+			color.Red("Step %d %s: %s", i+1, desc, err)
+			return fmt.Errorf("step %d failed", i+1)
+		}
+		color.Green("Step %d %s", i+1, desc)
+	}
+	return nil
+}
+
+func (s *simulator) submitIBTP(step *SubmitIBTPStep) error {
+	typ, err := parseIBTPType(step.Type, pb.IBTP_INTERCHAIN)
+	if err != nil {
+		return err
+	}
+	txStatus, err := parseTxStatus(step.TxStatus, pb.TransactionStatus_BEGIN)
+	if err != nil {
+		return err
+	}
+
+	content := &pb.Content{Func: step.Func}
+	for _, arg := range step.Args {
+		content.Args = append(content.Args, []byte(arg))
+	}
+	to := s.fullID(step.ServiceID)
+	multiSign := s.sign(step.From, to, step.Index, typ, append([][]byte{[]byte(content.Func)}, content.Args...), txStatus)
+
+	resp, err := s.appchain.SubmitIBTP(step.From, step.Index, step.ServiceID, typ, content,
+		&pb.BxhProof{TxStatus: txStatus, MultiSign: multiSign}, step.Encrypted)
+	if err != nil {
+		return err
+	}
+	return step.Expect.check(resp)
+}
+
+func (s *simulator) submitReceipt(step *SubmitReceiptStep) error {
+	typ, err := parseIBTPType(step.Type, pb.IBTP_RECEIPT_SUCCESS)
+	if err != nil {
+		return err
+	}
+	txStatus, err := parseTxStatus(step.TxStatus, pb.TransactionStatus_SUCCESS)
+	if err != nil {
+		return err
+	}
+
+	result := &pb.Result{}
+	for _, r := range step.Results {
+		result.Data = append(result.Data, []byte(r))
+	}
+	from := s.fullID(step.ServiceID)
+	multiSign := s.sign(from, step.To, step.Index, typ, result.Data, txStatus)
+
+	resp, err := s.appchain.SubmitReceipt(step.To, step.Index, step.ServiceID, typ, result,
+		&pb.BxhProof{TxStatus: txStatus, MultiSign: multiSign})
+	if err != nil {
+		return err
+	}
+	return step.Expect.check(resp)
+}
+
+func (s *simulator) expectIBTP(step *ExpectIBTPStep) error {
+	var typ *pb.IBTP_Type
+	if step.Type != "" {
+		t, err := parseIBTPType(step.Type, pb.IBTP_INTERCHAIN)
+		if err != nil {
+			return err
+		}
+		typ = &t
+	}
+	match := func(ibtp *pb.IBTP) bool {
+		return (step.From == "" || ibtp.From == step.From) &&
+			(step.To == "" || ibtp.To == step.To) &&
+			(step.Index == 0 || ibtp.Index == step.Index) &&
+			(typ == nil || ibtp.Type == *typ)
+	}
+
+	timeout := time.After(s.scenario.Timeout)
+	for {
+		s.lock.Lock()
+		for i, ibtp := range s.received {
+			if match(ibtp) {
+				s.received = append(s.received[:i], s.received[i+1:]...)
+				s.lock.Unlock()
+				return nil
+			}
+		}
+		s.lock.Unlock()
+
+		select {
+		case <-s.notify:
+		case <-timeout:
+			return fmt.Errorf("no matching ibtp in %s", s.scenario.Timeout)
+		}
+	}
+}
+
+func (s *simulator) fullID(serviceID string) string {
+	return s.bxhID + ":" + s.appchainID + ":" + serviceID
+}
+
+func (s *simulator) sign(from, to string, index uint64, typ pb.IBTP_Type, content [][]byte, txStatus pb.TransactionStatus) [][]byte {
+	multiSign := make([][]byte, 0, len(s.validators))
+	for _, validator := range s.validators {
+		sig, err := testutil.SignIBTP(validator, from, to, index, typ, content, txStatus)
+		if err != nil {
+			logger.Warn("Sign ibtp", "error", err.Error())
+			continue
+		}
+		multiSign = append(multiSign, sig)
+	}
+	return multiSign
+}
+
+func (e Expect) check(resp *pb.SubmitIBTPResponse) error {
+	status := true
+	if e.Status != nil {
+		status = *e.Status
+	}
+	if resp.Status != status {
+		return fmt.Errorf("status is %t: %s", resp.Status, resp.Message)
+	}
+	if !strings.Contains(resp.Message, e.Message) {
+		return fmt.Errorf("message %q does not contain %q", resp.Message, e.Message)
+	}
+	return nil
+}
+
+func parseIBTPType(name string, def pb.IBTP_Type) (pb.IBTP_Type, error) {
+	if name == "" {
+		return def, nil
+	}
+	typ, ok := pb.IBTP_Type_value[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown ibtp type %s", name)
+	}
+	return pb.IBTP_Type(typ), nil
+}
+
+func parseTxStatus(name string, def pb.TransactionStatus) (pb.TransactionStatus, error) {
+	if name == "" {
+		return def, nil
+	}
+	status, ok := pb.TransactionStatus_value[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown transaction status %s", name)
+	}
+	return pb.TransactionStatus(status), nil
+}
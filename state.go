@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/meshplus/bitxhub-model/pb"
+)
+
+// ServiceMeta keeps the index of the last ibtp delivered to pier for each
+// service pair. It is written by the polling goroutine and read by the calls
+// of pier, so every access goes through its lock.
+type ServiceMeta struct {
+	lock  sync.RWMutex
+	metas map[string]*pb.Interchain
+}
+
+func NewServiceMeta() *ServiceMeta {
+	return &ServiceMeta{
+		metas: make(map[string]*pb.Interchain),
+	}
+}
+
+// Index returns the last delivered index of servicePair, interchain ibtps and
+// receipts are counted apart
+func (m *ServiceMeta) Index(typ pb.IBTP_Type, servicePair string) (uint64, error) {
+	src, dst, err := parseServicePair(servicePair)
+	if err != nil {
+		return 0, err
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	meta, ok := m.metas[src]
+	if !ok {
+		return 0, nil
+	}
+	return counterOf(meta, typ)[dst], nil
+}
+
+func (m *ServiceMeta) SetIndex(typ pb.IBTP_Type, servicePair string, index uint64) error {
+	src, dst, err := parseServicePair(servicePair)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	meta, ok := m.metas[src]
+	if !ok {
+		meta = &pb.Interchain{
+			ID:                      src,
+			InterchainCounter:       make(map[string]uint64),
+			ReceiptCounter:          make(map[string]uint64),
+			SourceInterchainCounter: make(map[string]uint64),
+			SourceReceiptCounter:    make(map[string]uint64),
+		}
+		m.metas[src] = meta
+	}
+	counterOf(meta, typ)[dst] = index
+	return nil
+}
+
+// Snapshot returns a copy of the metas keyed by source service, it is safe to
+// use after the metas change
+func (m *ServiceMeta) Snapshot() map[string]*pb.Interchain {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	snapshot := make(map[string]*pb.Interchain, len(m.metas))
+	for src, meta := range m.metas {
+		snapshot[src] = &pb.Interchain{
+			ID:                      meta.ID,
+			InterchainCounter:       copyCounter(meta.InterchainCounter),
+			ReceiptCounter:          copyCounter(meta.ReceiptCounter),
+			SourceInterchainCounter: copyCounter(meta.SourceInterchainCounter),
+			SourceReceiptCounter:    copyCounter(meta.SourceReceiptCounter),
+		}
+	}
+	return snapshot
+}
+
+func counterOf(meta *pb.Interchain, typ pb.IBTP_Type) map[string]uint64 {
+	if typ == pb.IBTP_INTERCHAIN {
+		return meta.InterchainCounter
+	}
+	return meta.ReceiptCounter
+}
+
+func copyCounter(counter map[string]uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(counter))
+	for k, v := range counter {
+		c[k] = v
+	}
+	return c
+}
+
+// chainIDs caches the bitxhub id and appchain id kept by the broker, they are
+// resolved on first use and shared by concurrent calls of pier
+type chainIDs struct {
+	lock       sync.Mutex
+	bitxhubID  string
+	appchainID string
+	resolve    func() (string, string, error)
+}
+
+func (ids *chainIDs) get() (string, string, error) {
+	ids.lock.Lock()
+	defer ids.lock.Unlock()
+
+	if ids.bitxhubID == "" || ids.appchainID == "" {
+		bitxhubID, appchainID, err := ids.resolve()
+		if err != nil {
+			return "", "", err
+		}
+		if bitxhubID == "" || appchainID == "" {
+			return "", "", fmt.Errorf("broker is not initialized with chain ids")
+		}
+		ids.bitxhubID, ids.appchainID = bitxhubID, appchainID
+	}
+	return ids.bitxhubID, ids.appchainID, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testOutPair = "1356:chain0:mychannel&transfer-1356:chain1:mychannel&transfer"
+	testInPair  = "1356:chain1:mychannel&transfer-1356:chain0:mychannel&transfer"
+)
+
+func TestServiceMeta(t *testing.T) {
+	meta := NewServiceMeta()
+
+	index, err := meta.Index(pb.IBTP_INTERCHAIN, testOutPair)
+	require.Nil(t, err)
+	require.Equal(t, uint64(0), index)
+
+	require.Nil(t, meta.SetIndex(pb.IBTP_INTERCHAIN, testOutPair, 3))
+	require.Nil(t, meta.SetIndex(pb.IBTP_RECEIPT_SUCCESS, testOutPair, 2))
+
+	index, err = meta.Index(pb.IBTP_INTERCHAIN, testOutPair)
+	require.Nil(t, err)
+	require.Equal(t, uint64(3), index)
+	index, err = meta.Index(pb.IBTP_RECEIPT_FAILURE, testOutPair)
+	require.Nil(t, err)
+	require.Equal(t, uint64(2), index)
+
+	snapshot := meta.Snapshot()
+	require.Equal(t, uint64(3), snapshot["1356:chain0:mychannel&transfer"].InterchainCounter["1356:chain1:mychannel&transfer"])
+
+	// the snapshot does not follow later changes
+	require.Nil(t, meta.SetIndex(pb.IBTP_INTERCHAIN, testOutPair, 4))
+	require.Equal(t, uint64(3), snapshot["1356:chain0:mychannel&transfer"].InterchainCounter["1356:chain1:mychannel&transfer"])
+
+	_, err = meta.Index(pb.IBTP_INTERCHAIN, "invalid")
+	require.NotNil(t, err)
+	require.NotNil(t, meta.SetIndex(pb.IBTP_INTERCHAIN, "invalid", 1))
+}
+
+func TestChainIDs(t *testing.T) {
+	var calls int32
+	ids := &chainIDs{resolve: func() (string, string, error) {
+		atomic.AddInt32(&calls, 1)
+		return "1356", "chain0", nil
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bitxhubID, appchainID, err := ids.get()
+			require.Nil(t, err)
+			require.Equal(t, "1356", bitxhubID)
+			require.Equal(t, "chain0", appchainID)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	ids = &chainIDs{resolve: func() (string, string, error) {
+		return "", "", nil
+	}}
+	_, _, err := ids.get()
+	require.NotNil(t, err)
+}
+
+// TestConcurrentPollingAndSubmit catches up with the broker in the polling
+// goroutine while submits resolve the chain ids and read the service meta
+func TestConcurrentPollingAndSubmit(t *testing.T) {
+	checkpoint, err := NewCheckpoint(t.TempDir())
+	require.Nil(t, err)
+	defer checkpoint.Close()
+
+	c := &Client{
+		eventC:      make(chan *pb.IBTP),
+		ctx:         context.Background(),
+		serviceMeta: NewServiceMeta(),
+		checkpoint:  checkpoint,
+		config:      DefaultConfig(),
+	}
+	c.chainIDs = &chainIDs{resolve: func() (string, string, error) {
+		return "1356", "chain0", nil
+	}}
+
+	const total = 500
+	fetch := func(typ pb.IBTP_Type) func(string, uint64, uint64) ([]*pb.IBTP, error) {
+		return func(servicePair string, from, to uint64) ([]*pb.IBTP, error) {
+			src, dst, err := parseServicePair(servicePair)
+			if err != nil {
+				return nil, err
+			}
+			ibtps := make([]*pb.IBTP, 0, to-from+1)
+			for i := from; i <= to; i++ {
+				ibtps = append(ibtps, &pb.IBTP{From: src, To: dst, Index: i, Type: typ})
+			}
+			return ibtps, nil
+		}
+	}
+
+	received := make(map[string]uint64)
+	recvDone := make(chan struct{})
+	go func() {
+		defer close(recvDone)
+		for i := 0; i < 2*total; i++ {
+			ibtp := <-c.eventC
+			servicePair := genServicePair(ibtp.From, ibtp.To)
+			require.Equal(t, received[servicePair]+1, ibtp.Index)
+			received[servicePair] = ibtp.Index
+		}
+	}()
+
+	pollDone := make(chan struct{})
+	go func() {
+		defer close(pollDone)
+		for index := uint64(50); index <= total; index += 50 {
+			require.True(t, c.catchUp(testOutPair, pb.IBTP_INTERCHAIN, index, fetch(pb.IBTP_INTERCHAIN)))
+			require.True(t, c.catchUp(testInPair, pb.IBTP_RECEIPT_SUCCESS, index, fetch(pb.IBTP_RECEIPT_SUCCESS)))
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				bitxhubID, appchainID, err := c.chainIDs.get()
+				require.Nil(t, err)
+				servicePair := genServicePair(fmt.Sprintf("1356:chain%d:mychannel&transfer", i+2), bitxhubID+":"+appchainID+":mychannel&transfer")
+				require.Nil(t, c.serviceMeta.SetIndex(pb.IBTP_RECEIPT_SUCCESS, servicePair, uint64(j+1)))
+				_, err = c.serviceMeta.Index(pb.IBTP_INTERCHAIN, testOutPair)
+				require.Nil(t, err)
+				c.serviceMeta.Snapshot()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	<-pollDone
+	<-recvDone
+
+	index, err := c.serviceMeta.Index(pb.IBTP_INTERCHAIN, testOutPair)
+	require.Nil(t, err)
+	require.Equal(t, uint64(total), index)
+	index, err = c.serviceMeta.Index(pb.IBTP_RECEIPT_SUCCESS, testInPair)
+	require.Nil(t, err)
+	require.Equal(t, uint64(total), index)
+	require.Equal(t, uint64(total), checkpoint.Interchains()[testOutPair])
+	require.Equal(t, uint64(total), checkpoint.Receipts()[testInPair])
+}
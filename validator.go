@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/channel"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+	"github.com/hyperledger/fabric-sdk-go/third_party/github.com/hyperledger/fabric/common/cauthdsl"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/meshplus/bitxhub-model/pb"
+	"github.com/meshplus/pier-client-fabric/proof"
+)
+
+const (
+	lsccName          = "lscc"
+	lsccGetCCDataFunc = "getccdata"
+)
+
+// chaincodeData mirrors the chaincode definition kept by lscc
+type chaincodeData struct {
+	Name    string `protobuf:"bytes,1,opt,name=name"`
+	Version string `protobuf:"bytes,2,opt,name=version"`
+	Escc    string `protobuf:"bytes,3,opt,name=escc"`
+	Vscc    string `protobuf:"bytes,4,opt,name=vscc"`
+	Policy  []byte `protobuf:"bytes,5,opt,name=policy,proto3"`
+}
+
+func (cd *chaincodeData) Reset()         { *cd = chaincodeData{} }
+func (cd *chaincodeData) String() string { return proto.CompactTextString(cd) }
+func (*chaincodeData) ProtoMessage()     {}
+
+// queryValidator builds the validator of the broker chaincode from the latest
+// channel config. The endorsement policy is parsed from policy, or read from
+// the chaincode definition if policy is empty. The orderers signing blocks must
+// satisfy ordererPolicy.
+func queryValidator(backend Backend, channelID, cid, policy, ordererPolicy string) (*Validator, error) {
+	var (
+		pBytes []byte
+		err    error
+	)
+	if policy != "" {
+		pBytes, err = policyFromString(policy)
+	} else {
+		pBytes, err = policyFromDefinition(backend, channelID, cid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	opBytes, err := policyFromString(ordererPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get Fabric Channel Config
+	conf, err := backend.QueryConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildValidator(cid, pBytes, opBytes, conf), nil
+}
+
+func policyFromString(policy string) ([]byte, error) {
+	envelope, err := cauthdsl.FromString(policy)
+	if err != nil {
+		return nil, fmt.Errorf("parse policy %s: %w", policy, err)
+	}
+
+	return proto.Marshal(envelope)
+}
+
+// policyFromDefinition gets the endorsement policy of chaincode cid from lscc
+func policyFromDefinition(backend Backend, channelID, cid string) ([]byte, error) {
+	response, err := backend.Query(channel.Request{
+		ChaincodeID: lsccName,
+		Fcn:         lsccGetCCDataFunc,
+		Args:        util.ToChaincodeArgs(channelID, cid),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query chaincode definition of %s: %w", cid, err)
+	}
+
+	cd := &chaincodeData{}
+	if err := proto.Unmarshal(response.Payload, cd); err != nil {
+		return nil, fmt.Errorf("unmarshal chaincode definition of %s: %w", cid, err)
+	}
+	if len(cd.Policy) == 0 {
+		return nil, fmt.Errorf("chaincode %s has no endorsement policy", cid)
+	}
+
+	return cd.Policy, nil
+}
+
+func buildValidator(cid string, policy, ordererPolicy []byte, conf fab.ChannelCfg) *Validator {
+	// Generate MSP config bytes
+	var confStrs []string
+	for _, value := range conf.MSPs() {
+		confStrs = append(confStrs, value.String())
+	}
+
+	return &Validator{
+		Cid:           cid,
+		ChainId:       "",
+		Policy:        string(policy),
+		OrdererPolicy: string(ordererPolicy),
+		ConfByte:      confStrs,
+	}
+}
+
+// VerifyProof checks the proof bundle of an ibtp against the validator and
+// returns the chaincode action of the proven transaction
+func (v *Validator) VerifyProof(p []byte) (*peer.ChaincodeAction, error) {
+	return proof.Verify(p, []byte(v.Policy), []byte(v.OrdererPolicy), v.ConfByte, v.Cid)
+}
+
+// watchValidator rebuilds the validator on every config block and pushes it
+// to pier if it differs from the last one
+func (c *Client) watchValidator(notifier <-chan *fab.BlockEvent, last []byte) {
+	for {
+		var ev *fab.BlockEvent
+		select {
+		case e, ok := <-notifier:
+			if !ok {
+				return
+			}
+			ev = e
+		case <-c.ctx.Done():
+			return
+		}
+		logger.Info("Receive config block", "number", ev.Block.Header.Number)
+
+		validator, err := queryValidator(c.backend, c.meta.ChannelID, c.meta.CCID, c.config.Fabric.Policy, c.config.Fabric.OrdererPolicy)
+		if err != nil {
+			logger.Error("Rebuild validator", "error", err.Error())
+			continue
+		}
+		data, err := json.Marshal(validator)
+		if err != nil {
+			logger.Error("Marshal validator", "error", err.Error())
+			continue
+		}
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+
+		// only the latest validator matters, drop the stale one if pier has not taken it
+		meta := &pb.UpdateMeta{Meta: data}
+		select {
+		case c.updateC <- meta:
+		default:
+			select {
+			case <-c.updateC:
+			default:
+			}
+			c.updateC <- meta
+		}
+		logger.Info("Validator updated", "number", ev.Block.Header.Number)
+	}
+}
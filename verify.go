@@ -3,121 +3,140 @@ package main
 import (
 	"context"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"math/big"
+	"net"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/meshplus/bitxhub-kit/crypto/asym/ecdsa"
 	"github.com/meshplus/bitxhub-kit/types"
 )
 
-type response struct {
-	IsPass bool   `json:"is_pass"`
-	Data   []byte `json:"data"`
+const (
+	VerifyErrInvalidRequest  = "INVALID_REQUEST"
+	VerifyErrThresholdNotMet = "THRESHOLD_NOT_MET"
+)
+
+// VerifyRequest asks whether threshold of validators signed hash
+type VerifyRequest struct {
+	Signatures [][]byte `json:"signatures"`
+	Hash       []byte   `json:"hash"`
+	Threshold  uint64   `json:"threshold"`
+	Validators []string `json:"validators"`
+}
+
+type VerifyError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type VerifyResponse struct {
+	IsPass bool         `json:"is_pass"`
+	Error  *VerifyError `json:"error,omitempty"`
 }
 
 type ValidatorServer struct {
 	router *gin.Engine
-	port   string
-
-	ctx    context.Context
-	cancel context.CancelFunc
+	server *http.Server
 }
 
+// NewValidatorServer serves multi signature verification on port of localhost,
+// it is not meant to be reached from other hosts
 func NewValidatorServer(port string) (*ValidatorServer, error) {
-	ctx, cancel := context.WithCancel(context.Background())
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	router.Use(gin.Recovery())
+	v1 := router.Group("/v1")
+	{
+		v1.POST("verify", verifyMultiSign)
+	}
+
 	return &ValidatorServer{
 		router: router,
-		port:   port,
-		ctx:    ctx,
-		cancel: cancel,
+		server: &http.Server{
+			Addr:    net.JoinHostPort("127.0.0.1", port),
+			Handler: router,
+		},
 	}, nil
 }
 
 func (g *ValidatorServer) Start() error {
-	g.router.Use(gin.Recovery())
-	v1 := g.router.Group("/v1")
-	{
-		v1.POST("verify", g.verifyMultiSign)
+	ln, err := net.Listen("tcp", g.server.Addr)
+	if err != nil {
+		return fmt.Errorf("listen on %s: %w", g.server.Addr, err)
 	}
 
 	go func() {
-		go func() {
-			err := g.router.Run(fmt.Sprintf(":%s", g.port))
-			if err != nil {
-				panic(err)
-			}
-		}()
-		<-g.ctx.Done()
+		if err := g.server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Error("Validator server stopped", "error", err.Error())
+		}
 	}()
 	return nil
 }
 
-func (g *ValidatorServer) verifyMultiSign(c *gin.Context) {
-	res := &response{}
-	signatures := c.Query("signatures")
-	hash := c.Query("hash")
-	threshold := c.Query("threshold")
-	validators := c.Query("validators")
-
-	var multiSignatures [][]byte
-	if err := json.Unmarshal([]byte(signatures), &multiSignatures); err != nil {
-		res.IsPass = false
-		res.Data = []byte("multi signatures json unmarshal error")
-		c.JSON(http.StatusOK, res)
+func (g *ValidatorServer) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return g.server.Shutdown(ctx)
+}
+
+func verifyMultiSign(c *gin.Context) {
+	req := &VerifyRequest{}
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, &VerifyResponse{
+			Error: &VerifyError{Code: VerifyErrInvalidRequest, Message: err.Error()},
+		})
 		return
 	}
-	var vList []string
-	if err := json.Unmarshal([]byte(validators), &vList); err != nil {
-		res.IsPass = false
-		res.Data = []byte("validators json unmarshal error")
-		c.JSON(http.StatusOK, res)
+	if len(req.Hash) == 0 || req.Threshold == 0 || len(req.Validators) == 0 {
+		c.JSON(http.StatusBadRequest, &VerifyResponse{
+			Error: &VerifyError{Code: VerifyErrInvalidRequest, Message: "hash, threshold and validators are required"},
+		})
 		return
 	}
-	t, err := strconv.ParseUint(threshold, 10, 64)
-	if err != nil {
-		res.IsPass = false
-		res.Data = []byte("threshold parse error")
-		c.JSON(http.StatusOK, res)
+
+	if err := checkMultiSigns(req); err != nil {
+		c.JSON(http.StatusOK, &VerifyResponse{
+			Error: &VerifyError{Code: VerifyErrThresholdNotMet, Message: err.Error()},
+		})
 		return
 	}
 
+	c.JSON(http.StatusOK, &VerifyResponse{IsPass: true})
+}
+
+// checkMultiSigns counts the distinct validators recovered from the signatures,
+// invalid signatures are skipped
+func checkMultiSigns(req *VerifyRequest) error {
 	var bxhSigners []string
-	for _, sig := range multiSignatures {
+	for _, sig := range req.Signatures {
 		if len(sig) != 65 {
 			continue
 		}
 
 		v, r, s := getRawSignature(sig)
 
-		addr, err := ecdsa.RecoverPlain([]byte(hash), r, s, v, true)
+		addr, err := ecdsa.RecoverPlain(req.Hash, r, s, v, true)
 		if err != nil {
-			res.IsPass = false
-			res.Data = []byte("recover plain error")
-			c.JSON(http.StatusOK, res)
-			return
+			continue
 		}
 
-		if addressArrayContains(vList, addr) {
+		if addressArrayContains(req.Validators, addr) {
 			if addressArrayContains(bxhSigners, addr) {
 				continue
 			}
 			bxhSigners = append(bxhSigners, types.NewAddress(addr).String())
-			if uint64(len(bxhSigners)) == t {
-				res.IsPass = true
-				c.JSON(http.StatusOK, res)
-				return
+			if uint64(len(bxhSigners)) == req.Threshold {
+				return nil
 			}
 		}
 	}
 
-	res.IsPass = false
-	c.JSON(http.StatusOK, res)
+	return fmt.Errorf("%d of %d signatures from validators", len(bxhSigners), req.Threshold)
 }
 
 func getRawSignature(sig []byte) (v, r, s *big.Int) {
@@ -129,15 +148,21 @@ func getRawSignature(sig []byte) (v, r, s *big.Int) {
 	r.SetBytes(sig[:32])
 	s = &big.Int{}
 	s.SetBytes(sig[32:64])
+	// RecoverPlain expects v in {27, 28}, while bitxhub signs with {0, 1}
 	v = &big.Int{}
 	v.SetBytes(sig[64:])
+	if v.Uint64() < 27 {
+		v.Add(v, big.NewInt(27))
+	}
 
 	return v, r, s
 }
 
+// addressArrayContains compares the addresses ignoring case, the broker keeps
+// them in lower case while types.Address is checksummed
 func addressArrayContains(addrs []string, address []byte) bool {
 	for _, addr := range addrs {
-		if addr == types.NewAddress(address).String() {
+		if strings.EqualFold(addr, types.NewAddress(address).String()) {
 			return true
 		}
 	}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatorServer(t *testing.T) {
+	srv, err := NewValidatorServer("0")
+	require.Nil(t, err)
+	require.Equal(t, "127.0.0.1:0", srv.server.Addr)
+	require.Nil(t, srv.Start())
+	require.Nil(t, srv.Stop())
+
+	key1, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	key2, err := crypto.GenerateKey()
+	require.Nil(t, err)
+	validators := []string{crypto.PubkeyToAddress(key1.PublicKey).Hex(), crypto.PubkeyToAddress(key2.PublicKey).Hex()}
+	hash := crypto.Keccak256([]byte("ibtp"))
+	sig1, err := crypto.Sign(hash, key1)
+	require.Nil(t, err)
+
+	verify := func(body []byte) (int, *VerifyResponse) {
+		w := httptest.NewRecorder()
+		srv.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/verify", bytes.NewReader(body)))
+		resp := &VerifyResponse{}
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), resp))
+		return w.Code, resp
+	}
+	request := func(threshold uint64, sigs ...[]byte) []byte {
+		data, err := json.Marshal(&VerifyRequest{Signatures: sigs, Hash: hash, Threshold: threshold, Validators: validators})
+		require.Nil(t, err)
+		return data
+	}
+
+	code, resp := verify(request(1, sig1))
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, resp.IsPass)
+
+	// the same signature twice counts once
+	code, resp = verify(request(2, sig1, sig1))
+	require.Equal(t, http.StatusOK, code)
+	require.False(t, resp.IsPass)
+	require.Equal(t, VerifyErrThresholdNotMet, resp.Error.Code)
+
+	// the broker keeps the validators in lower case
+	validators = []string{strings.ToLower(validators[0]), strings.ToLower(validators[1])}
+	code, resp = verify(request(1, sig1))
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, resp.IsPass)
+
+	code, resp = verify([]byte("{"))
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, VerifyErrInvalidRequest, resp.Error.Code)
+	code, resp = verify(request(0, sig1))
+	require.Equal(t, http.StatusBadRequest, code)
+	require.Equal(t, VerifyErrInvalidRequest, resp.Error.Code)
+}